@@ -0,0 +1,110 @@
+/* globals document fetch URL */
+
+// Client side search of the index published with an application,
+// the form is shown once the index has loaded.
+
+var FORM = document.querySelector('form.search')
+
+function escape (str) {
+  return String(str)
+    .replace(/&/g, '&amp;')
+    .replace(/</g, '&lt;')
+    .replace(/>/g, '&gt;')
+    .replace(/"/g, '&quot;')
+}
+
+function words (str) {
+  return str.toLowerCase().split(/[^\w\u00C0-\uFFFF]+/).filter((w) => w)
+}
+
+// Every word must match, matches in the title rank
+// above headings which rank above the page text
+function score (entry, terms) {
+  let title = (entry.title || '').toLowerCase()
+  let headings = (entry.headings || []).join(' ').toLowerCase()
+  let text = (entry.text || '').toLowerCase()
+  let i, term
+  let total = 0
+  for (i = 0; i < terms.length; i++) {
+    term = terms[i]
+    if (title.indexOf(term) > -1) {
+      total += 3
+    } else if (headings.indexOf(term) > -1) {
+      total += 2
+    } else if (text.indexOf(term) > -1) {
+      total += 1
+    } else {
+      return 0
+    }
+  }
+  return total
+}
+
+function search (index, base, query) {
+  let terms = words(query)
+  let results = []
+  let i, entry, value
+  if (!terms.length) {
+    return results
+  }
+  for (i = 0; i < index.length; i++) {
+    entry = index[i]
+    value = score(entry, terms)
+    if (value > 0) {
+      results.push({entry: entry, score: value, url: new URL(entry.url, base).href})
+    }
+  }
+  results.sort((a, b) => b.score - a.score)
+  return results
+}
+
+function render (parent, results, query) {
+  let html = ''
+  let i, entry
+  if (!query) {
+    parent.innerHTML = ''
+    return
+  }
+  if (!results.length) {
+    parent.innerHTML = `<p>No pages match <em>${escape(query)}</em></p>`
+    return
+  }
+  html += '<ul>'
+  for (i = 0; i < results.length; i++) {
+    entry = results[i].entry
+    html += `<li>`
+    html += `<a href="${escape(results[i].url)}">${escape(entry.title || entry.url || '/')}</a>`
+    if (entry.text) {
+      html += `<p>${escape(entry.text)}</p>`
+    }
+    html += `</li>`
+  }
+  html += '</ul>'
+  parent.innerHTML = html
+}
+
+if (FORM) {
+  let base = new URL(FORM.getAttribute('data-index'), document.location.href).href
+  fetch(base)
+    .then((res) => {
+      if (!res.ok) {
+        throw new Error(`Search index not available: ${res.status}`)
+      }
+      return res.json()
+    })
+    .then((index) => {
+      let input = FORM.querySelector('input')
+      let output = FORM.querySelector('.search-results')
+      let update = () => {
+        let query = input.value.trim()
+        render(output, search(index, base, query), query)
+      }
+      input.addEventListener('input', update)
+      FORM.addEventListener('submit', (e) => {
+        e.preventDefault()
+        update()
+      })
+      FORM.classList.remove('hidden')
+    })
+    .catch(() => {})
+}
@@ -5,12 +5,39 @@ import (
   "fmt"
   "log"
   "flag"
+  "syscall"
+  "net/http"
+  "strings"
+  "os/signal"
   "github.com/tmpfs/pageloop"
+  "github.com/tmpfs/pageloop/client"
+  "github.com/tmpfs/pageloop/remote"
   . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/util"
 )
 
 var helpText []byte
 
+// Flag value for a configuration field, the value is
+// assigned to the config after the file is merged.
+type fieldValue struct {
+  field ConfigField
+  value string
+}
+
+func (f *fieldValue) String() string {
+  return f.value
+}
+
+func (f *fieldValue) Set(value string) error {
+  f.value = value
+  return nil
+}
+
+func (f *fieldValue) IsBoolFlag() bool {
+  return f.field.IsBool()
+}
+
 func printHelp () {
   os.Stdout.Write(helpText)
   os.Exit(0)
@@ -21,28 +48,84 @@ func printVersion () {
   os.Exit(0)
 }
 
+// Connect to a running server and run shell commands, interactive
+// when no command is given and stdin is a terminal.
+func remoteShell(args []string) {
+  flags := flag.NewFlagSet(os.Args[0] + " remote", flag.ExitOnError)
+  server := flags.String("server", "ws://localhost:3577", "")
+  user := flags.String("user", os.Getenv("PAGELOOP_USER"), "")
+  password := flags.String("password", os.Getenv("PAGELOOP_PASSWORD"), "")
+  flags.Parse(args)
+
+  // Allow the HTTP server URL
+  u := *server
+  if strings.HasPrefix(u, "http") {
+    u = "ws" + strings.TrimPrefix(u, "http")
+  }
+
+  transport, err := client.DialWebsocket(u, *user, *password)
+  if err != nil {
+    log.Fatal(err)
+  }
+  shell := remote.NewShell(client.New(transport))
+  defer shell.Client.Close()
+
+  if flags.NArg() > 0 {
+    err = shell.Exec(flags.Args())
+  } else {
+    info, _ := os.Stdin.Stat()
+    interactive := info != nil && info.Mode() & os.ModeCharDevice != 0
+    err = shell.Run(os.Stdin, interactive)
+  }
+  if err != nil && err != remote.ErrExit {
+    shell.Client.Close()
+    log.Fatal(err)
+  }
+}
+
 func main() {
   var err error
   var h *bool
   var help *bool
   var version *bool
 
-  var a *string
-  var addr *string
   var c *string
   var config *string
 
-  a = flag.String("a", "", "")
-  addr = flag.String("addr", "", "")
+  // Subcommand
+  var command []string
+  args := os.Args[1:]
+  if len(args) > 0 && args[0] == "remote" {
+    remoteShell(args[1:])
+    return
+  }
+  if len(args) > 0 && args[0] == "config" {
+    if len(args) < 2 || args[1] != "print" {
+      fmt.Fprintln(os.Stderr, "Unknown command, expected: config print")
+      os.Exit(1)
+    }
+    command = args[0:2]
+    args = args[2:]
+  }
+
+  flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 
-  c = flag.String("c", "", "")
-  config = flag.String("config", "", "")
+  c = flags.String("c", "", "")
+  config = flags.String("config", "", "")
 
-  h = flag.Bool("h", false, "")
-  help = flag.Bool("help", false, "")
-  version = flag.Bool("version", false, "")
+  h = flags.Bool("h", false, "")
+  help = flags.Bool("help", false, "")
+  version = flags.Bool("version", false, "")
 
-  flag.Parse()
+  // Flag for every configuration field, eg: --addr, --shutdown-timeout
+  values := make(map[string]*fieldValue)
+  for _, field := range ConfigFields() {
+    values[field.Name] = &fieldValue{field: field}
+    flags.Var(values[field.Name], field.Name, "")
+  }
+  flags.Var(values["addr"], "a", "")
+
+  flags.Parse(args)
 
   if *h || *help {
     printHelp()
@@ -66,11 +149,25 @@ func main() {
     }
   }
 
-  // Must be after the merge, overrides all config files
-  if *a != "" {
-    conf.Addr = *a
-  } else if *addr != "" {
-    conf.Addr = *addr
+  // Must be after the merge, environment variables override
+  // config files and flags override everything
+  if err = conf.Environ(os.LookupEnv); err != nil {
+    log.Fatal(err)
+  }
+  flags.Visit(func(f *flag.Flag) {
+    if v, ok := f.Value.(*fieldValue); ok && err == nil {
+      err = conf.Set(v.field.Name, v.value, SourceFlag)
+    }
+  })
+  if err != nil {
+    log.Fatal(err)
+  }
+
+  if command != nil {
+    if err = conf.Print(os.Stdout); err != nil {
+      log.Fatal(err)
+    }
+    os.Exit(0)
   }
 
   server, err := loop.NewServer(conf)
@@ -79,7 +176,34 @@ func main() {
     //fmt.Errorf(err)
     panic(err)
   }
-  loop.Listen(server)
+
+  // Shut down gracefully on interrupt or terminate
+  sig := make(chan os.Signal, 1)
+  signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+  // Reload the configuration on hangup
+  hup := make(chan os.Signal, 1)
+  signal.Notify(hup, syscall.SIGHUP)
+  go func() {
+    for range hup {
+      if _, err := loop.ReloadConfig(); err != nil {
+        Log.Error("reload failed", Fields{"error": err})
+      }
+    }
+  }()
+
+  go func() {
+    if err := loop.Listen(server); err != nil && err != http.ErrServerClosed {
+      log.Fatal(err)
+    }
+  }()
+
+  s := <-sig
+  Log.Info("received signal", Fields{"signal": s})
+  signal.Stop(sig)
+  if err = loop.Shutdown(server); err != nil {
+    os.Exit(1)
+  }
 }
 
 func init() {
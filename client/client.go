@@ -0,0 +1,85 @@
+// Package client provides typed access to the pageloop API.
+//
+// Calls are made using a transport, either the REST API or JSON-RPC
+// over a websocket connection:
+//
+//   c := client.New(client.NewRest("http://localhost:3577"))
+//   containers, err := c.HostList()
+//
+// Methods are generated from the registered services so they mirror
+// the service methods, eg: File.Save is FileSave. Errors returned by
+// the server are *StatusError so the status code is available.
+package client
+
+//go:generate go run ./generate
+
+import (
+  "io"
+  "fmt"
+  "encoding/json"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+// Transport for service method calls.
+type Transport interface {
+  // Call a service method and decode the reply.
+  Call(method string, args interface{}, reply interface{}) error
+  // Call a service method that writes it's response to w.
+  Stream(method string, args interface{}, w io.Writer) error
+  // Release resources held by the transport.
+  Close() error
+}
+
+// Client for the pageloop API.
+type Client struct {
+  Transport Transport
+}
+
+// Create a client using a transport.
+func New(transport Transport) *Client {
+  return &Client{Transport: transport}
+}
+
+// Call a service method by name.
+func (c *Client) Call(method string, args interface{}, reply interface{}) error {
+  return c.Transport.Call(method, args, reply)
+}
+
+// Call a service method that writes it's response to w.
+func (c *Client) Stream(method string, args interface{}, w io.Writer) error {
+  return c.Transport.Stream(method, args, w)
+}
+
+// Close the transport.
+func (c *Client) Close() error {
+  return c.Transport.Close()
+}
+
+// Private
+
+// Decode an error response from the REST API.
+func decodeError(status int, body []byte) error {
+  doc := struct {
+    Code int `json:"code"`
+    Message string `json:"message"`
+    Error string `json:"error"`
+  }{}
+  if err := json.Unmarshal(body, &doc); err != nil || doc.Code == 0 {
+    return CommandError(status, "")
+  }
+  if doc.Error != "" {
+    return CommandError(doc.Code, "%s", doc.Error)
+  }
+  return CommandError(doc.Code, "%s", doc.Message)
+}
+
+// Decode a JSON document to a reply value.
+func decodeReply(doc []byte, reply interface{}) error {
+  if reply == nil || len(doc) == 0 {
+    return nil
+  }
+  if err := json.Unmarshal(doc, reply); err != nil {
+    return fmt.Errorf("Invalid reply: %s", err.Error())
+  }
+  return nil
+}
@@ -0,0 +1,183 @@
+// Generates typed client methods from the service metadata.
+//
+// Run with go generate in the client package, writes services.go.
+package main
+
+import (
+  "os"
+  "fmt"
+  "log"
+  "sort"
+  "bytes"
+  "reflect"
+  "strings"
+  "go/format"
+  "io/ioutil"
+  . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/rpc"
+  . "github.com/tmpfs/pageloop/service"
+)
+
+const output = "services.go"
+
+var(
+  voidArgs = reflect.TypeOf(&VoidArgs{})
+  callerArgs = reflect.TypeOf(&CallerArgs{})
+  serviceReply = reflect.TypeOf(&ServiceReply{})
+
+  // Reply types that cannot be decoded, statistics are expvar maps
+  replyOverrides = map[string]reflect.Type{
+    "Core.Stats": reflect.TypeOf(map[string]interface{}{}),
+  }
+)
+
+// Service method to generate.
+type method struct {
+  info *ServiceMethodInfo
+  // Go method name, eg: FileSave
+  name string
+  // Reply type, nil when the method only returns an error
+  reply reflect.Type
+  // Method writes a stream
+  stream bool
+}
+
+func main() {
+  services := &ServiceMap{}
+
+  // Only the types are needed to register the services
+  services.MustRegister(new(CoreService), "Core")
+  services.MustRegister(new(HostService), "Host")
+  services.MustRegister(new(ContainerService), "Container")
+  services.MustRegister(new(AppService), "Application")
+  services.MustRegister(new(ArchiveService), "Archive")
+  services.MustRegister(new(FileService), "File")
+  services.MustRegister(new(JobService), "Job")
+  services.MustRegister(new(TemplateService), "Template")
+  services.MustRegister(new(AuditService), "Audit")
+  services.MustRegister(new(ProxyService), "Proxy")
+  services.MustRegister(new(TrashService), "Trash")
+  services.MustRegister(new(RpcServices), "Service")
+
+  var methods []*method
+  for _, info := range services.Map() {
+    for _, mt := range info.Methods {
+      methods = append(methods, resolve(mt))
+    }
+  }
+  sort.Slice(methods, func(i, j int) bool {
+    return methods[i].info.ServiceMethod < methods[j].info.ServiceMethod
+  })
+
+  src, err := generate(methods)
+  if err != nil {
+    log.Fatal(err)
+  }
+  if err := ioutil.WriteFile(output, src, 0644); err != nil {
+    log.Fatal(err)
+  }
+  fmt.Fprintf(os.Stderr, "Wrote %d methods to %s\n", len(methods), output)
+}
+
+// Determine the reply type for a service method.
+func resolve(info *ServiceMethodInfo) *method {
+  m := &method{info: info, name: strings.Replace(info.ServiceMethod, ".", "", 1)}
+  if t, ok := replyOverrides[info.ServiceMethod]; ok {
+    m.reply = t
+    return m
+  }
+  if route := DefaultRouter.Get(info.ServiceMethod); route != nil {
+    switch route.ResponseType {
+      case ResponseTypeNone:
+        m.stream = true
+        return m
+      case ResponseTypeByte:
+        m.reply = reflect.TypeOf([]byte{})
+        return m
+    }
+  }
+  if info.Reply != serviceReply {
+    m.reply = info.Reply
+  } else if meta := ServicesMetaInfo[info.ServiceMethod]; meta != nil {
+    m.reply = meta.Reply
+  }
+  return m
+}
+
+// Generate the source file.
+func generate(methods []*method) ([]byte, error) {
+  imports := map[string]bool{}
+  var body bytes.Buffer
+  for _, m := range methods {
+    var params []string
+    args := fmt.Sprintf("&%s{}", m.info.Arg.Elem())
+    if m.info.Arg != voidArgs && m.info.Arg != callerArgs {
+      params = append(params, "args " + m.info.Arg.String())
+      args = "args"
+    }
+    addImports(imports, m.info.Arg)
+
+    if meta := ServicesMetaInfo[m.info.ServiceMethod]; meta != nil && meta.Description != "" {
+      fmt.Fprintf(&body, "// %s\n", meta.Description)
+    }
+    fmt.Fprintf(&body, "//\n// Calls the %s service method.\n", m.info.ServiceMethod)
+
+    switch {
+      case m.stream:
+        imports["io"] = true
+        params = append(params, "w io.Writer")
+        fmt.Fprintf(&body, "func (c *Client) %s(%s) error {\n", m.name, strings.Join(params, ", "))
+        fmt.Fprintf(&body, "return c.Stream(%q, %s, w)\n}\n\n", m.info.ServiceMethod, args)
+      case m.reply == nil:
+        fmt.Fprintf(&body, "func (c *Client) %s(%s) error {\n", m.name, strings.Join(params, ", "))
+        fmt.Fprintf(&body, "return c.Call(%q, %s, nil)\n}\n\n", m.info.ServiceMethod, args)
+      default:
+        addImports(imports, m.reply)
+        fmt.Fprintf(&body, "func (c *Client) %s(%s) (%s, error) {\n", m.name, strings.Join(params, ", "), m.reply)
+        fmt.Fprintf(&body, "var reply %s\n", m.reply)
+        fmt.Fprintf(&body, "err := c.Call(%q, %s, &reply)\n", m.info.ServiceMethod, args)
+        fmt.Fprintf(&body, "return reply, err\n}\n\n")
+    }
+  }
+
+  // Standard library packages are listed first
+  var std, paths []string
+  for p := range imports {
+    if strings.Contains(p, ".") {
+      paths = append(paths, p)
+    } else {
+      std = append(std, p)
+    }
+  }
+  sort.Strings(std)
+  sort.Strings(paths)
+
+  var src bytes.Buffer
+  fmt.Fprintf(&src, "// Code generated by go generate; DO NOT EDIT.\n\npackage client\n\nimport (\n")
+  for _, p := range std {
+    fmt.Fprintf(&src, "%q\n", p)
+  }
+  fmt.Fprintf(&src, "\n")
+  for _, p := range paths {
+    fmt.Fprintf(&src, "%q\n", p)
+  }
+  fmt.Fprintf(&src, ")\n\n")
+  src.Write(body.Bytes())
+  return format.Source(src.Bytes())
+}
+
+// Add the packages for named types.
+func addImports(imports map[string]bool, t reflect.Type) {
+  switch t.Kind() {
+    case reflect.Ptr, reflect.Slice, reflect.Array:
+      addImports(imports, t.Elem())
+      return
+    case reflect.Map:
+      addImports(imports, t.Key())
+      addImports(imports, t.Elem())
+      return
+  }
+  if t.PkgPath() != "" {
+    imports[t.PkgPath()] = true
+  }
+}
@@ -0,0 +1,284 @@
+package client
+
+import (
+  "io"
+  "fmt"
+  "bytes"
+  "reflect"
+  "strings"
+  "strconv"
+  "net/url"
+  "net/http"
+  "sync/atomic"
+  "io/ioutil"
+  "encoding/json"
+  . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/model"
+  . "github.com/tmpfs/pageloop/service"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+var(
+  bytesType = reflect.TypeOf([]byte{})
+)
+
+// Transport for the REST API.
+//
+// Requests are built from the routes for a service method and the bind
+// tags of the method arguments, the reverse of the server binding.
+type RestTransport struct {
+  // Server URL, eg: http://localhost:3577
+  Url string
+  // Credentials for basic authentication, anonymous when empty.
+  User string
+  Password string
+  // Client used for requests, http.DefaultClient when nil.
+  Http *http.Client
+  // Sequence number sent in X-Method-Seq
+  seq uint64
+}
+
+// Create a REST transport for a server URL.
+func NewRest(server string) *RestTransport {
+  return &RestTransport{Url: server}
+}
+
+// Call a service method and decode the reply.
+func (t *RestTransport) Call(method string, args interface{}, reply interface{}) error {
+  res, route, err := t.do(method, args)
+  if err != nil {
+    return err
+  }
+  defer res.Body.Close()
+
+  if route.ResponseType == ResponseTypeNone {
+    return fmt.Errorf("Service %s writes a stream, use Stream()", method)
+  }
+
+  body, err := ioutil.ReadAll(res.Body)
+  if err != nil {
+    return err
+  }
+  if res.StatusCode >= http.StatusBadRequest {
+    return decodeError(res.StatusCode, body)
+  }
+
+  if b, ok := reply.(*[]byte); ok && route.ResponseType == ResponseTypeByte {
+    *b = body
+    return nil
+  }
+  return decodeReply(body, reply)
+}
+
+// Call a service method that writes it's response to w.
+func (t *RestTransport) Stream(method string, args interface{}, w io.Writer) error {
+  res, _, err := t.do(method, args)
+  if err != nil {
+    return err
+  }
+  defer res.Body.Close()
+
+  if res.StatusCode >= http.StatusBadRequest {
+    body, _ := ioutil.ReadAll(res.Body)
+    return decodeError(res.StatusCode, body)
+  }
+  _, err = io.Copy(w, res.Body)
+  return err
+}
+
+// Nothing to release, connections belong to the HTTP client.
+func (t *RestTransport) Close() error {
+  return nil
+}
+
+// Get the HTTP request for a service method call.
+func (t *RestTransport) Request(method string, args interface{}) (*http.Request, *Route, error) {
+  routes := DefaultRouter.GetAll(method)
+  if len(routes) == 0 {
+    return nil, nil, fmt.Errorf("No route for service %s", method)
+  }
+
+  b := &restRequest{query: url.Values{}, header: http.Header{}}
+  if err := b.bind(args); err != nil {
+    return nil, nil, err
+  }
+
+  // First route that accepts the path parameters
+  var route *Route
+  var path string
+  for _, r := range routes {
+    if p, ok := b.path(r); ok {
+      route, path = r, p
+      break
+    }
+  }
+  if route == nil {
+    return nil, nil, fmt.Errorf("No route for service %s matches the arguments", method)
+  }
+
+  u := strings.TrimSuffix(t.Url, SLASH) + API_URL + path
+  if len(b.query) > 0 {
+    u += "?" + b.query.Encode()
+  }
+
+  var body io.Reader
+  if route.Method != http.MethodGet {
+    if b.body != nil {
+      body = bytes.NewReader(b.body)
+    } else if args != nil {
+      doc, err := json.Marshal(args)
+      if err != nil {
+        return nil, nil, err
+      }
+      body = bytes.NewReader(doc)
+    }
+  }
+
+  req, err := http.NewRequest(route.Method, u, body)
+  if err != nil {
+    return nil, nil, err
+  }
+  for name, values := range b.header {
+    req.Header[name] = values
+  }
+  if t.User != "" {
+    req.SetBasicAuth(t.User, t.Password)
+  }
+
+  // Hint for the route lookup, required to distinguish
+  // methods that share a route
+  req.Header.Set("X-Method-Name", method)
+  req.Header.Set("X-Method-Seq", strconv.FormatUint(atomic.AddUint64(&t.seq, 1), 10))
+  return req, route, nil
+}
+
+// Private
+
+// Send the request for a service method call.
+func (t *RestTransport) do(method string, args interface{}) (*http.Response, *Route, error) {
+  req, route, err := t.Request(method, args)
+  if err != nil {
+    return nil, nil, err
+  }
+  client := t.Http
+  if client == nil {
+    client = http.DefaultClient
+  }
+  res, err := client.Do(req)
+  if err != nil {
+    return nil, nil, err
+  }
+  return res, route, nil
+}
+
+// Request data collected from the bind tags of method arguments.
+type restRequest struct {
+  // Path parameters by position: type, context, target, filter and item
+  params [5]string
+  query url.Values
+  header http.Header
+  body []byte
+}
+
+// Collect request data from the argument fields.
+func (b *restRequest) bind(args interface{}) error {
+  v := reflect.ValueOf(args)
+  if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+    return nil
+  }
+  v = v.Elem()
+  t := v.Type()
+  for i := 0; i < t.NumField(); i++ {
+    field := t.Field(i)
+    source, name := BindTag(field)
+    value := v.Field(i)
+    switch source {
+      case BindPath:
+        b.setParam(name, fmt.Sprint(value.Interface()))
+      case BindRef:
+        if value.String() == "" {
+          continue
+        }
+        ref := &AssetReference{}
+        if _, err := ref.ParseUrl(value.String()); err != nil {
+          return err
+        }
+        b.setParam("context", ref.Container())
+        b.setParam("target", ref.Application())
+        if name == "file" {
+          b.setParam("item", ref.Url())
+        }
+      case BindQuery:
+        if !value.IsZero() {
+          b.query.Set(name, fmt.Sprint(value.Interface()))
+        }
+      case BindHeader:
+        if s := value.String(); s != "" {
+          b.header.Set(name, s)
+        }
+      case BindBody:
+        // Never nil so the arguments are not sent as the body
+        if field.Type == bytesType {
+          b.body = append([]byte{}, value.Bytes()...)
+        } else if !value.IsZero() {
+          doc, err := json.Marshal(value.Interface())
+          if err != nil {
+            return err
+          }
+          b.body = doc
+        } else {
+          b.body = []byte{}
+        }
+    }
+  }
+  return nil
+}
+
+func (b *restRequest) setParam(name string, value string) {
+  switch name {
+    case "context":
+      b.params[1] = value
+    case "target":
+      b.params[2] = value
+    case "filter":
+      b.params[3] = value
+    case "item":
+      b.params[4] = strings.TrimPrefix(value, SLASH)
+  }
+}
+
+// Get the request path for a route, wildcards are replaced with the
+// path parameters. The route does not apply when a wildcard has no
+// value or a parameter has no matching path part.
+func (b *restRequest) path(route *Route) (string, bool) {
+  var parts []string
+  if route.Path != "" {
+    parts = strings.Split(strings.TrimPrefix(route.Path, SLASH), SLASH)
+  }
+  for i, value := range b.params {
+    if value != "" && i >= len(parts) {
+      return "", false
+    }
+  }
+  for i, part := range parts {
+    value := b.params[i]
+    if part == "*" {
+      if value == "" {
+        return "", false
+      }
+      parts[i] = escapePath(value)
+    } else if value != "" && value != part {
+      return "", false
+    }
+  }
+  return strings.Join(parts, SLASH), true
+}
+
+// Escape each segment of a path.
+func escapePath(value string) string {
+  segments := strings.Split(value, SLASH)
+  for i, s := range segments {
+    segments[i] = url.PathEscape(s)
+  }
+  return strings.Join(segments, SLASH)
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+  "testing"
+  "net/http"
+  . "github.com/tmpfs/pageloop/service"
+)
+
+func TestRestRequest(t *testing.T) {
+  rest := NewRest("http://localhost:3577/")
+
+  req, _, err := rest.Request("File.Move", &FileMoveRequest{
+    Ref: "file://pageloop.com/user/blog#/docs/index.md", Destination: "/about.md"})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if req.Method != http.MethodPost || req.URL.String() != "http://localhost:3577/api/apps/user/blog/files/docs/index.md" {
+    t.Errorf("Unexpected request %s %s", req.Method, req.URL)
+  }
+  if req.Header.Get("Location") != "/about.md" || req.Header.Get("X-Method-Name") != "File.Move" {
+    t.Errorf("Unexpected headers %v", req.Header)
+  }
+  if req.Header.Get("X-Method-Seq") != "1" {
+    t.Errorf("Expected sequence number 1, got %s", req.Header.Get("X-Method-Seq"))
+  }
+
+  req, route, err := rest.Request("Archive.Export", &ArchiveRequest{
+    Ref: "file://pageloop.com/user/blog", Filter: "source"})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if route.Path != "/apps/*/*/zip/source" || req.URL.Path != "/api/apps/user/blog/zip/source" {
+    t.Errorf("Unexpected archive route %s for %s", route.Path, req.URL.Path)
+  }
+
+  req, _, err = rest.Request("Audit.List", &AuditRequest{Method: "File.Save", Limit: 10})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if req.URL.RawQuery != "limit=10&method=File.Save" {
+    t.Errorf("Unexpected query %s", req.URL.RawQuery)
+  }
+
+  if _, _, err = rest.Request("Container.Read", &ContainerRequest{}); err == nil {
+    t.Errorf("Expected error for missing path parameter")
+  }
+}
@@ -0,0 +1,182 @@
+package client
+
+import (
+  "io"
+  "fmt"
+  "sync"
+  "errors"
+  "net/http"
+  "encoding/json"
+  "github.com/gorilla/websocket"
+  . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+var(
+  // Returned for calls after the connection is closed.
+  ErrClosed = errors.New("Websocket connection closed")
+)
+
+// Transport for JSON-RPC over a websocket connection.
+//
+// Calls may be made concurrently, responses are matched to
+// calls using the message id.
+type WebsocketTransport struct {
+  Conn *websocket.Conn
+  // Protects the fields below and writes to the connection
+  mu sync.Mutex
+  id uint64
+  pending map[uint64]chan *rpcResponse
+  err error
+}
+
+// JSON-RPC call message.
+type rpcRequest struct {
+  Id uint64 `json:"id"`
+  Method string `json:"method"`
+  Params [1]interface{} `json:"params"`
+}
+
+// JSON-RPC response message, the result is wrapped so that
+// it includes the status code or an error.
+type rpcResponse struct {
+  Id *uint64 `json:"id"`
+  Result *struct {
+    Document json.RawMessage `json:"document"`
+    Status int `json:"status"`
+    Error *StatusError `json:"error"`
+  } `json:"result"`
+  Error interface{} `json:"error"`
+}
+
+// Connect to the websocket endpoint of a server, eg: ws://localhost:3577,
+// user and password are used for basic authentication when not empty.
+func DialWebsocket(server string, user string, password string) (*WebsocketTransport, error) {
+  header := http.Header{}
+  if user != "" {
+    req := &http.Request{Header: header}
+    req.SetBasicAuth(user, password)
+  }
+  u := server
+  if len(u) > 0 && u[len(u) - 1] == '/' {
+    u = u[0:len(u) - 1]
+  }
+  // Negotiate permessage-deflate
+  dialer := *websocket.DefaultDialer
+  dialer.EnableCompression = true
+  conn, _, err := dialer.Dial(u + WEBSOCKET_URL, header)
+  if err != nil {
+    return nil, err
+  }
+  return NewWebsocket(conn), nil
+}
+
+// Create a transport for an open connection and start reading responses.
+func NewWebsocket(conn *websocket.Conn) *WebsocketTransport {
+  t := &WebsocketTransport{Conn: conn, pending: make(map[uint64]chan *rpcResponse)}
+  go t.read()
+  return t
+}
+
+// Call a service method and decode the reply.
+func (t *WebsocketTransport) Call(method string, args interface{}, reply interface{}) error {
+  if args == nil {
+    args = struct{}{}
+  }
+  msg := &rpcRequest{Method: method}
+  msg.Params[0] = args
+  ch := make(chan *rpcResponse, 1)
+
+  t.mu.Lock()
+  if t.err != nil {
+    t.mu.Unlock()
+    return t.err
+  }
+  t.id++
+  msg.Id = t.id
+  t.pending[msg.Id] = ch
+  p, err := json.Marshal(msg)
+  if err == nil {
+    err = t.Conn.WriteMessage(websocket.TextMessage, p)
+  }
+  if err != nil {
+    delete(t.pending, msg.Id)
+    t.mu.Unlock()
+    return err
+  }
+  t.mu.Unlock()
+
+  res, ok := <-ch
+  if !ok {
+    return t.closed()
+  }
+  if res.Error != nil {
+    return fmt.Errorf("%v", res.Error)
+  }
+  if res.Result == nil {
+    return fmt.Errorf("Invalid response for %s, no result", method)
+  }
+  if res.Result.Error != nil {
+    return res.Result.Error
+  }
+  return decodeReply(res.Result.Document, reply)
+}
+
+// Streams are only available over REST.
+func (t *WebsocketTransport) Stream(method string, args interface{}, w io.Writer) error {
+  return fmt.Errorf("Service %s writes a stream which is not supported over websocket", method)
+}
+
+// Close the connection, pending calls return ErrClosed.
+func (t *WebsocketTransport) Close() error {
+  t.mu.Lock()
+  if t.err == nil {
+    t.err = ErrClosed
+  }
+  t.mu.Unlock()
+  return t.Conn.Close()
+}
+
+// Private
+
+// Read responses and dispatch them to the pending calls.
+func (t *WebsocketTransport) read() {
+  for {
+    _, p, err := t.Conn.ReadMessage()
+    if err != nil {
+      t.fail(err)
+      return
+    }
+    res := &rpcResponse{}
+    if err := json.Unmarshal(p, res); err != nil || res.Id == nil {
+      // Not a response to a call
+      continue
+    }
+    t.mu.Lock()
+    ch := t.pending[*res.Id]
+    delete(t.pending, *res.Id)
+    t.mu.Unlock()
+    if ch != nil {
+      ch <- res
+    }
+  }
+}
+
+// Stop waiting for responses after a read error.
+func (t *WebsocketTransport) fail(err error) {
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  if t.err == nil {
+    t.err = err
+  }
+  for id, ch := range t.pending {
+    close(ch)
+    delete(t.pending, id)
+  }
+}
+
+func (t *WebsocketTransport) closed() error {
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  return t.err
+}
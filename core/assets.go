@@ -2,7 +2,12 @@
 // sources:
 // data/config.yml
 // data/pageloop.txt
+// data/policy.yml
+// data/schema/app-host.json
 // data/schema/app-new.json
+// data/schema/app-replace.json
+// data/schema/config.json
+// data/schema/proxy-new.json
 // DO NOT EDIT!
 
 package core
@@ -65,6 +70,42 @@ func pageloopTxt() (*asset, error) {
 	return a, err
 }
 
+// policyYml reads file data from disk. It returns an error on failure.
+func policyYml() (*asset, error) {
+	path := "/home/muji/git/go/src/github.com/tmpfs/pageloop/data/policy.yml"
+	name := "policy.yml"
+	bytes, err := bindataRead(path, name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		err = fmt.Errorf("Error reading asset info %s at %s: %v", name, path, err)
+	}
+
+	a := &asset{bytes: bytes, info: fi}
+	return a, err
+}
+
+// schemaAppHostJson reads file data from disk. It returns an error on failure.
+func schemaAppHostJson() (*asset, error) {
+	path := "/home/muji/git/go/src/github.com/tmpfs/pageloop/data/schema/app-host.json"
+	name := "schema/app-host.json"
+	bytes, err := bindataRead(path, name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		err = fmt.Errorf("Error reading asset info %s at %s: %v", name, path, err)
+	}
+
+	a := &asset{bytes: bytes, info: fi}
+	return a, err
+}
+
 // schemaAppNewJson reads file data from disk. It returns an error on failure.
 func schemaAppNewJson() (*asset, error) {
 	path := "/home/muji/git/go/src/github.com/tmpfs/pageloop/data/schema/app-new.json"
@@ -83,6 +124,60 @@ func schemaAppNewJson() (*asset, error) {
 	return a, err
 }
 
+// schemaAppReplaceJson reads file data from disk. It returns an error on failure.
+func schemaAppReplaceJson() (*asset, error) {
+	path := "/home/muji/git/go/src/github.com/tmpfs/pageloop/data/schema/app-replace.json"
+	name := "schema/app-replace.json"
+	bytes, err := bindataRead(path, name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		err = fmt.Errorf("Error reading asset info %s at %s: %v", name, path, err)
+	}
+
+	a := &asset{bytes: bytes, info: fi}
+	return a, err
+}
+
+// schemaConfigJson reads file data from disk. It returns an error on failure.
+func schemaConfigJson() (*asset, error) {
+	path := "/home/muji/git/go/src/github.com/tmpfs/pageloop/data/schema/config.json"
+	name := "schema/config.json"
+	bytes, err := bindataRead(path, name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		err = fmt.Errorf("Error reading asset info %s at %s: %v", name, path, err)
+	}
+
+	a := &asset{bytes: bytes, info: fi}
+	return a, err
+}
+
+// schemaProxyNewJson reads file data from disk. It returns an error on failure.
+func schemaProxyNewJson() (*asset, error) {
+	path := "/home/muji/git/go/src/github.com/tmpfs/pageloop/data/schema/proxy-new.json"
+	name := "schema/proxy-new.json"
+	bytes, err := bindataRead(path, name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		err = fmt.Errorf("Error reading asset info %s at %s: %v", name, path, err)
+	}
+
+	a := &asset{bytes: bytes, info: fi}
+	return a, err
+}
+
 // Asset loads and returns the asset for the given name.
 // It returns an error if the asset could not be found or
 // could not be loaded.
@@ -137,7 +232,12 @@ func AssetNames() []string {
 var _bindata = map[string]func() (*asset, error){
 	"config.yml": configYml,
 	"pageloop.txt": pageloopTxt,
+	"policy.yml": policyYml,
+	"schema/app-host.json": schemaAppHostJson,
 	"schema/app-new.json": schemaAppNewJson,
+	"schema/app-replace.json": schemaAppReplaceJson,
+	"schema/config.json": schemaConfigJson,
+	"schema/proxy-new.json": schemaProxyNewJson,
 }
 
 // AssetDir returns the file names below a certain
@@ -182,8 +282,13 @@ type bintree struct {
 var _bintree = &bintree{nil, map[string]*bintree{
 	"config.yml": &bintree{configYml, map[string]*bintree{}},
 	"pageloop.txt": &bintree{pageloopTxt, map[string]*bintree{}},
+	"policy.yml": &bintree{policyYml, map[string]*bintree{}},
 	"schema": &bintree{nil, map[string]*bintree{
+		"app-host.json": &bintree{schemaAppHostJson, map[string]*bintree{}},
 		"app-new.json": &bintree{schemaAppNewJson, map[string]*bintree{}},
+		"app-replace.json": &bintree{schemaAppReplaceJson, map[string]*bintree{}},
+		"config.json": &bintree{schemaConfigJson, map[string]*bintree{}},
+		"proxy-new.json": &bintree{schemaProxyNewJson, map[string]*bintree{}},
 	}},
 }}
 
@@ -0,0 +1,191 @@
+package core
+
+import(
+  "os"
+  "sync"
+  "time"
+  "bufio"
+  "strings"
+  "encoding/json"
+)
+
+const(
+  AuditFileName = "audit.log"
+)
+
+var(
+  // Singleton audit log.
+  Audit *AuditLog
+
+  // Service methods that mutate the model and should be audited.
+  AuditedMethods = []string{
+    "Core.ReloadConfig",
+    "Container.CreateApp",
+    "Application.Delete",
+    "Application.SetHost",
+    "Application.DeleteFiles",
+    "Application.Replace",
+    "Application.RunTask",
+    "File.Create",
+    "File.CreateTemplate",
+    "File.Save",
+    "File.Move",
+    "File.Copy",
+    "File.Delete",
+    "Job.Delete",
+    "Proxy.Create",
+    "Proxy.Delete",
+    "Trash.Restore",
+    "Trash.Purge"}
+)
+
+// A single entry in the audit log.
+type AuditRecord struct {
+  // User that made the call, empty for anonymous users.
+  User string `json:"user"`
+  // Time of the call.
+  Time time.Time `json:"time"`
+  // Service method name.
+  ServiceMethod string `json:"method"`
+  // Asset reference or other identifier for the call target.
+  Target string `json:"target"`
+  // Outcome status code.
+  Status int `json:"status"`
+  // Error message when the call failed.
+  Error string `json:"error,omitempty"`
+}
+
+// Criteria for listing audit records, empty fields match all records.
+type AuditFilter struct {
+  User string
+  ServiceMethod string
+  // Matches records whose target contains this string.
+  Target string
+  Status int
+}
+
+// Determine if a record matches the filter.
+func (f *AuditFilter) Match(r *AuditRecord) bool {
+  if f.User != "" && f.User != r.User {
+    return false
+  }
+  if f.ServiceMethod != "" && f.ServiceMethod != r.ServiceMethod {
+    return false
+  }
+  if f.Target != "" && !strings.Contains(r.Target, f.Target) {
+    return false
+  }
+  if f.Status != 0 && f.Status != r.Status {
+    return false
+  }
+  return true
+}
+
+// A page of audit records.
+type AuditPage struct {
+  // Number of records matching the filter.
+  Total int `json:"total"`
+  Offset int `json:"offset"`
+  Limit int `json:"limit"`
+  Records []*AuditRecord `json:"records"`
+}
+
+// Append only audit log written as JSON lines.
+type AuditLog struct {
+  // Path to the log file, when empty records are discarded.
+  Path string
+  mu sync.Mutex
+}
+
+// Create an audit log that writes to path.
+func NewAuditLog(path string) *AuditLog {
+  return &AuditLog{Path: path}
+}
+
+// Determine if calls to a service method are audited.
+func (a *AuditLog) Audited(method string) bool {
+  for _, m := range AuditedMethods {
+    if m == method {
+      return true
+    }
+  }
+  return false
+}
+
+// Append a record to the log, the record time is assigned if it is zero.
+func (a *AuditLog) Write(record *AuditRecord) error {
+  if a.Path == "" {
+    return nil
+  }
+
+  if record.Time.IsZero() {
+    record.Time = time.Now().UTC()
+  }
+
+  var err error
+  var line []byte
+  if line, err = json.Marshal(record); err != nil {
+    return err
+  }
+  line = append(line, '\n')
+
+  a.mu.Lock()
+  defer a.mu.Unlock()
+  fh, err := os.OpenFile(a.Path, os.O_CREATE | os.O_WRONLY | os.O_APPEND, 0644)
+  if err != nil {
+    return err
+  }
+  defer fh.Close()
+  _, err = fh.Write(line)
+  return err
+}
+
+// Get a page of records matching filter, most recent first.
+//
+// A limit less than one returns all records after offset.
+func (a *AuditLog) List(filter *AuditFilter, offset int, limit int) (*AuditPage, error) {
+  page := &AuditPage{Offset: offset, Limit: limit, Records: make([]*AuditRecord, 0)}
+  if a.Path == "" {
+    return page, nil
+  }
+
+  a.mu.Lock()
+  defer a.mu.Unlock()
+  fh, err := os.Open(a.Path)
+  if err != nil {
+    if os.IsNotExist(err) {
+      return page, nil
+    }
+    return nil, err
+  }
+  defer fh.Close()
+
+  var matches []*AuditRecord
+  scanner := bufio.NewScanner(fh)
+  for scanner.Scan() {
+    record := &AuditRecord{}
+    if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+      return nil, err
+    }
+    if filter == nil || filter.Match(record) {
+      matches = append(matches, record)
+    }
+  }
+  if err := scanner.Err(); err != nil {
+    return nil, err
+  }
+
+  page.Total = len(matches)
+  for i := len(matches) - 1 - offset; i >= 0; i-- {
+    if limit > 0 && len(page.Records) == limit {
+      break
+    }
+    page.Records = append(page.Records, matches[i])
+  }
+  return page, nil
+}
+
+func init() {
+  // Discards records until the server assigns a path
+  Audit = NewAuditLog("")
+}
@@ -0,0 +1,40 @@
+package core
+
+import (
+  "os"
+  "testing"
+  "io/ioutil"
+  "path/filepath"
+)
+
+func TestAuditLog(t *testing.T) {
+  dir, err := ioutil.TempDir("", "pageloop-audit")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  a := NewAuditLog(filepath.Join(dir, AuditFileName))
+  a.Write(&AuditRecord{User: "alice", ServiceMethod: "File.Save", Target: "file://pageloop.com/user/blog#/index.md", Status: 200})
+  a.Write(&AuditRecord{User: "bob", ServiceMethod: "File.Delete", Target: "file://pageloop.com/user/blog#/about.md", Status: 200})
+  a.Write(&AuditRecord{User: "bob", ServiceMethod: "Application.Delete", Target: "file://pageloop.com/user/docs", Status: 403})
+
+  page, err := a.List(&AuditFilter{Target: "user/blog"}, 0, 0)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if page.Total != 2 || len(page.Records) != 2 {
+    t.Fatalf("Unexpected number of records %d", page.Total)
+  }
+  if page.Records[0].ServiceMethod != "File.Delete" {
+    t.Errorf("Expected most recent record first, got %s", page.Records[0].ServiceMethod)
+  }
+
+  page, err = a.List(&AuditFilter{User: "bob"}, 1, 1)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if page.Total != 2 || len(page.Records) != 1 || page.Records[0].ServiceMethod != "File.Delete" {
+    t.Errorf("Unexpected page %#v", page)
+  }
+}
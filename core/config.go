@@ -2,6 +2,7 @@ package core
 
 import (
   "os"
+  "fmt"
   "path/filepath"
   "io/ioutil"
   "gopkg.in/yaml.v2"
@@ -11,6 +12,7 @@ const(
 	API_URL = "/api/"
 	WEBSOCKET_URL = "/ws/"
 	RPC_URL = "/rpc/"
+	METRICS_URL = "/metrics"
 )
 
 var defaultServerConfig *ServerConfig
@@ -27,12 +29,66 @@ type ServerConfig struct {
   // Directory for generated source files
   SourceDirectory string `json:"source,omitempty" yaml:"source,omitempty"`
 
+  // Path to the audit log file
+  AuditFile string `json:"audit,omitempty" yaml:"audit,omitempty"`
+
+  // TLS certificate file, when set with a key file the server uses HTTPS
+  CertFile string `json:"cert,omitempty" yaml:"cert,omitempty"`
+
+  // TLS private key file
+  KeyFile string `json:"key,omitempty" yaml:"key,omitempty"`
+
+  // Generate a self-signed development certificate when no
+  // certificate and key are configured
+  SelfSigned bool `json:"self-signed,omitempty" yaml:"self-signed,omitempty"`
+
+  // Address for a plain HTTP listener that redirects to HTTPS
+  RedirectAddr string `json:"redirect,omitempty" yaml:"redirect,omitempty"`
+
+  // Seconds to wait for requests and jobs to finish on shutdown
+  ShutdownTimeout int `json:"shutdown-timeout,omitempty" yaml:"shutdown-timeout,omitempty"`
+
+  // Abort active jobs on shutdown rather than waiting for them
+  AbortJobs bool `json:"abort-jobs,omitempty" yaml:"abort-jobs,omitempty"`
+
+  // Minimum level for log records, one of debug, info, warn or error
+  LogLevel string `json:"log-level,omitempty" yaml:"log-level,omitempty"`
+
+  // Path to the server log file, the log is written to stderr by default
+  LogFile string `json:"log-file,omitempty" yaml:"log-file,omitempty"`
+
+  // Path to the access log file, requests are written to the
+  // server log by default
+  AccessLog string `json:"access-log,omitempty" yaml:"access-log,omitempty"`
+
+  // Directory for deleted files and applications
+  TrashDirectory string `json:"trash,omitempty" yaml:"trash,omitempty"`
+
+  // Days to keep deleted files in the trash, zero keeps them until purged
+  TrashMaxAge int `json:"trash-max-age,omitempty" yaml:"trash-max-age,omitempty"`
+
+  // Megabytes used by the trash before the oldest items are purged,
+  // zero does not limit the size
+  TrashMaxSize int `json:"trash-max-size,omitempty" yaml:"trash-max-size,omitempty"`
+
   // User configuration merged with this config, only
   // available if merge has been called.
   userConfig *ServerConfig
 
   // Path used when calling merge to load a user configuration.
   userConfigPath string
+
+  // Where field values were assigned, keyed by field name.
+  sources map[string]string
+
+  // Values assigned from the environment or command line flags.
+  overrides []configOverride
+
+  // Mountpoints assigned from the environment or command line flags,
+  // they replace the user mountpoints while the server runs and are
+  // never written to the configuration file.
+  mountpointOverrides []Mountpoint
+  hasMountpointOverrides bool
 }
 
 // Public access to the default server config.
@@ -50,35 +106,65 @@ func (c *ServerConfig) UserConfig() *ServerConfig {
   return c.userConfig
 }
 
+// Get the user mountpoints to load, mountpoints assigned from the
+// environment or command line flags replace those in the user
+// configuration file.
+func (c *ServerConfig) UserMountpoints() []Mountpoint {
+  if c.hasMountpointOverrides {
+    return c.mountpointOverrides
+  }
+  return c.UserConfig().Mountpoints
+}
+
 // Add a mountpoint to the list of user configuration mountpoints
 // and returns the user configuration.
+//
+// When the mountpoints are overridden the mountpoint is also added
+// to the overrides so that it is served until the server stops.
 func (c *ServerConfig) AddMountpoint(m Mountpoint) *ServerConfig {
   var conf *ServerConfig = c.UserConfig()
   // Append to the user configuration mountpoints
   conf.Mountpoints = append(conf.Mountpoints, m)
+  if c.hasMountpointOverrides {
+    c.mountpointOverrides = append(c.mountpointOverrides, m)
+  }
   return conf
 }
 
 // Attempt to delete a user mountpoint for the given URL.
 func (c *ServerConfig) DeleteMountpoint(url string) *ServerConfig {
   var conf *ServerConfig = c.UserConfig()
-  for i, m := range conf.Mountpoints {
-    if url == m.Url {
-      before := conf.Mountpoints[0:i]
-      after := conf.Mountpoints[i+1:]
-      conf.Mountpoints = append(before, after...)
+  conf.Mountpoints = deleteMountpoint(conf.Mountpoints, url)
+  c.mountpointOverrides = deleteMountpoint(c.mountpointOverrides, url)
+  return conf
+}
+
+// Get the lists of user mountpoints that may be changed at runtime,
+// the user configuration and any overrides.
+func (c *ServerConfig) userMountpointLists() [][]Mountpoint {
+  return [][]Mountpoint{c.UserConfig().Mountpoints, c.mountpointOverrides}
+}
+
+func deleteMountpoint(list []Mountpoint, url string) []Mountpoint {
+  var out []Mountpoint
+  for _, m := range list {
+    if url != m.Url {
+      out = append(out, m)
     }
   }
-  return conf
+  return out
 }
 
 // Load and merge a user supplied configuration file.
 //
+// The file is validated against the config schema before it is
+// merged, when validation fails the configuration is not modified.
+//
 // Mountpoints are appended to the defaults and each mountpoint
 // in the user configuration is added to the user container.
 //
-// User supplied configurations can currently only specify Addr
-// and Mountpoints.
+// Fields that are set in the file replace the defaults, values assigned
+// using Set() are applied again after the file is merged.
 func (c *ServerConfig) Merge(path string) error {
   var err error
   var content []byte
@@ -87,14 +173,16 @@ func (c *ServerConfig) Merge(path string) error {
     return err
   }
 
+  if err = ValidateConfig(path, content); err != nil {
+    return err
+  }
+
   tempServerConfig := &ServerConfig{}
   if err := yaml.Unmarshal(content, tempServerConfig); err != nil {
     return err
   }
 
-  if tempServerConfig.Addr != "" {
-    c.Addr = tempServerConfig.Addr
-  }
+  c.mergeFields(tempServerConfig)
 
   for _, m := range tempServerConfig.Mountpoints {
     // Force user supplied applications into particular container
@@ -105,7 +193,69 @@ func (c *ServerConfig) Merge(path string) error {
   c.userConfig = tempServerConfig
   c.userConfigPath = path
 
-  return nil
+  // Environment and flag overrides take precedence over the file
+  return c.applyOverrides()
+}
+
+// Reload the user configuration file that was previously merged.
+func (c *ServerConfig) Reload() error {
+  if c.userConfigPath == "" {
+    return fmt.Errorf("No configuration file to reload")
+  }
+  return c.Merge(c.userConfigPath)
+}
+
+// Get the path to the policy file which lives next to the
+// user configuration file.
+//
+// Returns the empty string when no user configuration has been
+// merged so that the default policy is used.
+func (c *ServerConfig) PolicyPath() string {
+  if c.userConfigPath == "" {
+    return ""
+  }
+  return filepath.Join(filepath.Dir(c.userConfigPath), PolicyFileName)
+}
+
+// Get the path to the audit log file.
+//
+// When no audit file is configured the log is written next to
+// the user configuration file or to the current working directory
+// when no user configuration has been merged.
+func (c *ServerConfig) AuditPath() string {
+  if c.AuditFile != "" {
+    return c.AuditFile
+  }
+  if c.userConfigPath == "" {
+    return AuditFileName
+  }
+  return filepath.Join(filepath.Dir(c.userConfigPath), AuditFileName)
+}
+
+// Get the path to the trash directory.
+//
+// When no trash directory is configured deleted files are moved
+// to a trash directory next to the user configuration file or in
+// the current working directory when no user configuration has
+// been merged.
+func (c *ServerConfig) TrashPath() string {
+  if c.TrashDirectory != "" {
+    return c.TrashDirectory
+  }
+  return filepath.Join(c.ConfigDirectory(), TrashDirName)
+}
+
+// Get the directory containing the user configuration file, when
+// no user configuration has been merged the current working directory
+// is returned.
+func (c *ServerConfig) ConfigDirectory() string {
+  if c.userConfigPath == "" {
+    if wd, err := os.Getwd(); err == nil {
+      return wd
+    }
+    return "."
+  }
+  return filepath.Dir(c.userConfigPath)
 }
 
 // Write a configuration to disc as YAML.
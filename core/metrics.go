@@ -0,0 +1,273 @@
+package core
+
+import(
+  "io"
+  "fmt"
+  "sort"
+  "sync"
+  "time"
+  "strings"
+  "strconv"
+)
+
+// Metric types in the Prometheus text format.
+const(
+  MetricCounter = "counter"
+  MetricGauge = "gauge"
+  MetricHistogram = "histogram"
+)
+
+var(
+  // Registry for the /metrics endpoint.
+  Metrics *MetricRegistry
+
+  // REST API requests by route and response status.
+  RouteRequests *MetricVec
+  // REST API request latency by route.
+  RouteLatency *MetricVec
+  // Service method calls by transport.
+  RpcCalls *MetricVec
+  // Service method errors by status code.
+  RpcErrors *MetricVec
+  // Service method call latency.
+  RpcLatency *MetricVec
+
+  // Default latency histogram buckets in seconds.
+  LatencyBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+)
+
+// A metric with a value for each combination of label values.
+type MetricVec struct {
+  Name string
+  Help string
+  Type string
+  Labels []string
+  // Upper bounds for histograms
+  Buckets []float64
+  // Called when the metrics are written to assign values, used
+  // for gauges that are computed from the current state.
+  Collect func(set func(value float64, values ...string))
+
+  mu sync.Mutex
+  series map[string]*metricSeries
+}
+
+// Values for one combination of labels.
+type metricSeries struct {
+  values []string
+  value float64
+  // Cumulative counts are computed when written
+  counts []uint64
+  count uint64
+}
+
+// Registry of metrics written in the Prometheus text format.
+type MetricRegistry struct {
+  mu sync.Mutex
+  metrics []*MetricVec
+}
+
+// Add a metric to the registry, replaces any metric with the same name.
+func (r *MetricRegistry) Register(m *MetricVec) *MetricVec {
+  r.mu.Lock()
+  defer r.mu.Unlock()
+  m.series = make(map[string]*metricSeries)
+  for i, existing := range r.metrics {
+    if existing.Name == m.Name {
+      r.metrics[i] = m
+      return m
+    }
+  }
+  r.metrics = append(r.metrics, m)
+  return m
+}
+
+// Add a counter.
+func (r *MetricRegistry) Counter(name string, help string, labels ...string) *MetricVec {
+  return r.Register(&MetricVec{Name: name, Help: help, Type: MetricCounter, Labels: labels})
+}
+
+// Add a histogram.
+func (r *MetricRegistry) Histogram(name string, help string, buckets []float64, labels ...string) *MetricVec {
+  return r.Register(
+    &MetricVec{Name: name, Help: help, Type: MetricHistogram, Labels: labels, Buckets: buckets})
+}
+
+// Add a gauge, values are assigned by the collect function when
+// the metrics are written.
+func (r *MetricRegistry) Gauge(name string, help string, collect func(set func(float64, ...string)), labels ...string) *MetricVec {
+  return r.Register(
+    &MetricVec{Name: name, Help: help, Type: MetricGauge, Labels: labels, Collect: collect})
+}
+
+// Write all metrics in the Prometheus text format sorted by name.
+func (r *MetricRegistry) Write(w io.Writer) error {
+  r.mu.Lock()
+  list := append([]*MetricVec(nil), r.metrics...)
+  r.mu.Unlock()
+  sort.Slice(list, func(i, j int) bool {
+    return list[i].Name < list[j].Name
+  })
+  for _, m := range list {
+    if err := m.write(w); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// Add to a counter.
+func (m *MetricVec) Add(value float64, values ...string) {
+  m.mu.Lock()
+  defer m.mu.Unlock()
+  m.get(values).value += value
+}
+
+// Assign a gauge value.
+func (m *MetricVec) Set(value float64, values ...string) {
+  m.mu.Lock()
+  defer m.mu.Unlock()
+  m.get(values).value = value
+}
+
+// Record a histogram observation.
+func (m *MetricVec) Observe(value float64, values ...string) {
+  m.mu.Lock()
+  defer m.mu.Unlock()
+  s := m.get(values)
+  if s.counts == nil {
+    s.counts = make([]uint64, len(m.Buckets))
+  }
+  for i, bound := range m.Buckets {
+    if value <= bound {
+      s.counts[i]++
+      break
+    }
+  }
+  s.count++
+  s.value += value
+}
+
+// Record the time since start in seconds.
+func (m *MetricVec) Since(start time.Time, values ...string) {
+  m.Observe(time.Since(start).Seconds(), values...)
+}
+
+// Private
+
+// Get the series for label values, caller must hold the lock.
+func (m *MetricVec) get(values []string) *metricSeries {
+  key := strings.Join(values, "\xff")
+  s := m.series[key]
+  if s == nil {
+    s = &metricSeries{values: values}
+    m.series[key] = s
+  }
+  return s
+}
+
+func (m *MetricVec) write(w io.Writer) error {
+  if m.Collect != nil {
+    m.Collect(m.Set)
+  }
+
+  m.mu.Lock()
+  defer m.mu.Unlock()
+
+  if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.Name, m.Help, m.Name, m.Type); err != nil {
+    return err
+  }
+
+  var keys []string
+  for k := range m.series {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+
+  for _, k := range keys {
+    s := m.series[k]
+    labels := m.labels(s.values)
+    if m.Type != MetricHistogram {
+      if _, err := fmt.Fprintf(w, "%s%s %s\n", m.Name, wrapLabels(labels), formatFloat(s.value)); err != nil {
+        return err
+      }
+      continue
+    }
+
+    var cumulative uint64
+    for i, bound := range m.Buckets {
+      cumulative += s.counts[i]
+      le := append(labels, fmt.Sprintf(`le="%s"`, formatFloat(bound)))
+      fmt.Fprintf(w, "%s_bucket%s %d\n", m.Name, wrapLabels(le), cumulative)
+    }
+    le := append(labels, `le="+Inf"`)
+    fmt.Fprintf(w, "%s_bucket%s %d\n", m.Name, wrapLabels(le), s.count)
+    fmt.Fprintf(w, "%s_sum%s %s\n", m.Name, wrapLabels(labels), formatFloat(s.value))
+    if _, err := fmt.Fprintf(w, "%s_count%s %d\n", m.Name, wrapLabels(labels), s.count); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// Format label pairs.
+func (m *MetricVec) labels(values []string) []string {
+  var list []string
+  for i, name := range m.Labels {
+    value := ""
+    if i < len(values) {
+      value = values[i]
+    }
+    list = append(list, fmt.Sprintf("%s=%s", name, strconv.Quote(value)))
+  }
+  return list
+}
+
+func wrapLabels(list []string) string {
+  if len(list) == 0 {
+    return ""
+  }
+  return "{" + strings.Join(list, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+  return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func init() {
+  Metrics = &MetricRegistry{}
+
+  RouteRequests = Metrics.Counter(
+    "pageloop_route_requests_total", "REST API requests by route and status.", "method", "route", "status")
+  RouteLatency = Metrics.Histogram(
+    "pageloop_route_duration_seconds", "REST API request latency by route.", LatencyBuckets, "method", "route")
+  RpcCalls = Metrics.Counter(
+    "pageloop_rpc_calls_total", "Service method calls by transport.", "method", "transport")
+  RpcErrors = Metrics.Counter(
+    "pageloop_rpc_errors_total", "Service method errors by status code.", "method", "status")
+  RpcLatency = Metrics.Histogram(
+    "pageloop_rpc_duration_seconds", "Service method call latency.", LatencyBuckets, "method")
+
+  // Existing server statistics
+  stat := func(name string, help string, key string) {
+    Metrics.Register(&MetricVec{Name: name, Help: help, Type: MetricCounter,
+      Collect: func(set func(float64, ...string)) {
+        if v, ok := mapToInterface(Stats.Http)[key].(int64); ok {
+          set(float64(v))
+        }
+      }})
+  }
+  stat("pageloop_http_requests_total", "HTTP requests received.", "requests")
+  stat("pageloop_http_responses_total", "HTTP responses sent.", "responses")
+  stat("pageloop_http_body_in_bytes_total", "HTTP request body bytes received.", "body-in")
+  stat("pageloop_http_body_out_bytes_total", "HTTP response body bytes sent.", "body-out")
+
+  Metrics.Gauge("pageloop_websocket_connections", "Open websocket connections.", func(set func(float64, ...string)) {
+    if v, ok := mapToInterface(Stats.Websocket)["connections"].(int64); ok {
+      set(float64(v))
+    }
+  })
+  Metrics.Gauge("pageloop_uptime_seconds", "Time since the server started.", func(set func(float64, ...string)) {
+    set(time.Since(Stats.StartTime).Seconds())
+  })
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+  "bytes"
+  "strings"
+  "testing"
+)
+
+func TestMetricsWrite(t *testing.T) {
+  r := &MetricRegistry{}
+  calls := r.Counter("test_calls_total", "Calls.", "method")
+  latency := r.Histogram("test_duration_seconds", "Latency.", []float64{.1, 1}, "method")
+  r.Gauge("test_jobs", "Jobs.", func(set func(float64, ...string)) {
+    set(3)
+  })
+
+  calls.Add(1, "File.Save")
+  calls.Add(1, "File.Save")
+  latency.Observe(.05, "File.Save")
+  latency.Observe(.5, "File.Save")
+  latency.Observe(5, "File.Save")
+
+  var b bytes.Buffer
+  if err := r.Write(&b); err != nil {
+    t.Fatal(err)
+  }
+  out := b.String()
+
+  expected := []string{
+    "# TYPE test_calls_total counter\n",
+    `test_calls_total{method="File.Save"} 2` + "\n",
+    `test_duration_seconds_bucket{method="File.Save",le="0.1"} 1` + "\n",
+    `test_duration_seconds_bucket{method="File.Save",le="1"} 2` + "\n",
+    `test_duration_seconds_bucket{method="File.Save",le="+Inf"} 3` + "\n",
+    `test_duration_seconds_sum{method="File.Save"} 5.55` + "\n",
+    `test_duration_seconds_count{method="File.Save"} 3` + "\n",
+    "# TYPE test_jobs gauge\ntest_jobs 3\n",
+  }
+  for _, e := range expected {
+    if !strings.Contains(out, e) {
+      t.Errorf("Expected metrics output to contain %q, got:\n%s", e, out)
+    }
+  }
+
+  // Sorted by name
+  if strings.Index(out, "test_calls_total") > strings.Index(out, "test_jobs") {
+    t.Errorf("Expected metrics sorted by name")
+  }
+}
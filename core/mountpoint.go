@@ -3,10 +3,15 @@ package core
 import (
   "os"
   "fmt"
+  "sort"
+  "sync"
+  "reflect"
   "strings"
+  "net/url"
   "net/http"
   "path/filepath"
   . "github.com/tmpfs/pageloop/model"
+  . "github.com/tmpfs/pageloop/util"
 )
 
 // A mountpoint maps a path location indicating the source
@@ -20,11 +25,41 @@ type Mountpoint struct {
 	// The URL location for the application mountpoint.
   Url string `json:"url" yaml:"url"`
 	// The path to pass to the loader.
-  Path string	`json:"path" yaml:"path"`
+  Path string	`json:"path,omitempty" yaml:"path,omitempty"`
 	// Description to pass to the application.
   Description string `json:"description" yaml:"description"`
   // Mark as a template
   Template bool `json:"template" yaml:"template"`
+  // Cache-Control header for published files.
+  CacheControl string `json:"cache-control,omitempty" yaml:"cache-control,omitempty"`
+  // Virtual host name that serves the application at the root path.
+  Host string `json:"host,omitempty" yaml:"host,omitempty"`
+  // Publish a search index of the pages for client side search.
+  PublishSearch bool `json:"publish-search,omitempty" yaml:"publish-search,omitempty"`
+  // Upstream address for a proxy mountpoint, eg: http://127.0.0.1:8081
+  Proxy string `json:"proxy,omitempty" yaml:"proxy,omitempty"`
+  // Request headers set when proxying, an empty value removes the header.
+  ProxyHeaders map[string]string `json:"proxy-headers,omitempty" yaml:"proxy-headers,omitempty"`
+}
+
+// Get the upstream URL for a proxy mountpoint, the scheme
+// defaults to http when only an address is given.
+func (mt Mountpoint) Upstream() (*url.URL, error) {
+  raw := mt.Proxy
+  if !strings.Contains(raw, "://") {
+    raw = "http://" + raw
+  }
+  u, err := url.Parse(raw)
+  if err != nil {
+    return nil, err
+  }
+  if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+    return nil, fmt.Errorf("Proxy upstream %s must be an http or https address", mt.Proxy)
+  }
+  if u.Path == "" {
+    u.Path = SLASH
+  }
+  return u, nil
 }
 
 // Temporary map used when initializing loaded mountpoint definitions
@@ -36,6 +71,10 @@ type MountpointMap struct {
 }
 
 type MountpointManager struct {
+  // Guards the mountpoints and the host containers, mutating service
+  // calls and configuration reloads hold the write lock, other service
+  // calls and handler lookups hold the read lock.
+  sync.RWMutex
   // Maps application URLs to HTTP handlers.
   //
   // Because we want to mount and unmount applications and we cannot remove
@@ -45,12 +84,30 @@ type MountpointManager struct {
   Config *ServerConfig
   // Model virtual host
   Host *Host
+  // Serve an application loaded at runtime, assigned by the server
+  // as the handlers cannot be referenced from this package.
+  Mount func(app *Application)
+  // Proxy mountpoints by URL.
+  Proxies map[string] Mountpoint
+  // Create the handler for a proxy mountpoint, assigned by the server.
+  ProxyHandler func(mt Mountpoint) (http.Handler, error)
+}
+
+// Mountpoint changes applied when the configuration is reloaded.
+type MountpointChanges struct {
+  // URLs of mountpoints that were loaded.
+  Added []string `json:"added"`
+  // URLs of mountpoints that were unmounted.
+  Removed []string `json:"removed"`
+  // URLs of mountpoints that were unmounted and loaded again.
+  Changed []string `json:"changed"`
 }
 
 func NewMountpointManager(c *ServerConfig, h *Host) *MountpointManager {
   manager := &MountpointManager{Config: c, Host: h}
 	// Initialize mountpoint maps
 	manager.MountpointMap = make(map[string] http.Handler)
+  manager.Proxies = make(map[string] Mountpoint)
   return manager
 }
 
@@ -85,7 +142,7 @@ func (m *MountpointManager) CreateMountpoint(a *Application) (*Mountpoint, error
 
   var mt *Mountpoint = &Mountpoint{
     DisplayName: a.DisplayName,
-    Path: a.Path, Url: a.Url, Description: a.Description}
+    Path: a.Path, Url: a.Url, Description: a.Description, Host: a.Host}
   var conf *ServerConfig = m.Config.AddMountpoint(*mt)
   if err = m.Config.WriteFile(conf, ""); err != nil {
     return nil, err
@@ -93,6 +150,34 @@ func (m *MountpointManager) CreateMountpoint(a *Application) (*Mountpoint, error
   return mt, nil
 }
 
+// Get the user configuration mountpoint for an application.
+func (m *MountpointManager) ApplicationMountpoint(app *Application) (Mountpoint, bool) {
+  for _, mt := range m.Config.UserMountpoints() {
+    if m.mountpointUrl(mt) == strings.TrimSuffix(app.Url, "/") {
+      return mt, true
+    }
+  }
+  return Mountpoint{}, false
+}
+
+// Persist the mountpoint for an application restored from the
+// trash, then load and mount the application.
+func (m *MountpointManager) RestoreMountpoint(mt Mountpoint) error {
+  url := m.mountpointUrl(mt)
+  if m.HasMountpoint(url) {
+    return fmt.Errorf("Mountpoint URL %s already exists", url)
+  }
+  var conf *ServerConfig = m.Config.AddMountpoint(mt)
+  if err := m.Config.WriteFile(conf, ""); err != nil {
+    return err
+  }
+  if err := m.load(mt); err != nil {
+    m.DeleteApplicationMountpoint(mt.Url)
+    return err
+  }
+  return nil
+}
+
 // Load a single mountpoint.
 func (m *MountpointManager) LoadMountpoint(mountpoint Mountpoint, container *Container) (*Application, error) {
   var err error
@@ -131,6 +216,13 @@ func (m *MountpointManager) LoadMountpoints(mountpoints []Mountpoint, container
 		app := NewApplication(urlPath, mt.Description)
     app.DisplayName = mt.DisplayName
     app.IsTemplate = mt.Template
+    app.CacheControl = mt.CacheControl
+    app.PublishSearch = mt.PublishSearch
+    if mt.Host != "" {
+      if app.Host, err = m.CheckHost(mt.Host, nil); err != nil {
+        return nil, err
+      }
+    }
 		fs := NewUrlFileSystem(app)
 		app.FileSystem = fs
 
@@ -163,15 +255,114 @@ func (m *MountpointManager) LoadMountpoints(mountpoints []Mountpoint, container
 	return apps, nil
 }
 
+// Find the application and handler for a virtual host name, returns
+// nil values when no application is served from the host.
+func (m *MountpointManager) VirtualHost(host string) (*Application, http.Handler) {
+  if app := m.hostApplication(NormalizeHost(host)); app != nil {
+    if handler, ok := m.MountpointMap[app.PublishUrl()]; ok {
+      return app, handler
+    }
+  }
+  return nil, nil
+}
+
+// Assign the virtual host name for a userspace application and persist
+// the mountpoint, an empty host removes the virtual host.
+func (m *MountpointManager) SetHost(app *Application, host string) error {
+  var err error
+  if host != "" {
+    if host, err = m.CheckHost(host, app); err != nil {
+      return err
+    }
+  }
+  var found bool
+  for _, list := range m.Config.userMountpointLists() {
+    for i, mt := range list {
+      if m.mountpointUrl(mt) == strings.TrimSuffix(app.Url, "/") {
+        list[i].Host = host
+        found = true
+      }
+    }
+  }
+  if !found {
+    return fmt.Errorf("No mountpoint for application %s", app.Url)
+  }
+  if err = m.Config.WriteFile(m.Config.UserConfig(), ""); err != nil {
+    return err
+  }
+  app.Host = host
+  return nil
+}
+
 // Unmount an application from the web server.
 func (m *MountpointManager) UnmountApplication(app *Application) {
   delete(m.MountpointMap, app.PublishUrl())
 }
 
+// Reload the user configuration and apply changes to the user mountpoints.
+//
+// New mountpoints are loaded and mounted, removed mountpoints are unmounted
+// and mountpoints whose definition changed are unmounted and loaded again.
+// Application files on disc are never deleted. When the configuration is
+// invalid no changes are made.
+func (m *MountpointManager) Reload() (*MountpointChanges, error) {
+  before := m.Config.UserMountpoints()
+  if err := m.Config.Reload(); err != nil {
+    return nil, err
+  }
+  after := m.Config.UserMountpoints()
+
+  changes := &MountpointChanges{Added: []string{}, Removed: []string{}, Changed: []string{}}
+
+  previous := make(map[string]Mountpoint)
+  for _, mt := range before {
+    previous[m.mountpointUrl(mt)] = mt
+  }
+  current := make(map[string]Mountpoint)
+  for _, mt := range after {
+    current[m.mountpointUrl(mt)] = mt
+  }
+
+  for url, mt := range previous {
+    if next, ok := current[url]; !ok {
+      m.unload(url)
+      changes.Removed = append(changes.Removed, url)
+    } else if !reflect.DeepEqual(next, mt) {
+      m.unload(url)
+      changes.Changed = append(changes.Changed, url)
+    }
+  }
+
+  var failed []string
+  for url, mt := range current {
+    if old, ok := previous[url]; ok && reflect.DeepEqual(old, mt) {
+      continue
+    } else if !ok {
+      changes.Added = append(changes.Added, url)
+    }
+    if err := m.load(mt); err != nil {
+      failed = append(failed, fmt.Sprintf("%s: %s", url, err.Error()))
+    }
+  }
+
+  sort.Strings(changes.Added)
+  sort.Strings(changes.Removed)
+  sort.Strings(changes.Changed)
+
+  Log.Info("reloaded configuration", Fields{
+    "added": len(changes.Added), "removed": len(changes.Removed), "changed": len(changes.Changed)})
+
+  if len(failed) > 0 {
+    sort.Strings(failed)
+    return changes, fmt.Errorf("Failed to load mountpoints\n%s", strings.Join(failed, "\n"))
+  }
+  return changes, nil
+}
+
 // Test if a mountpoint exists by URL.
 func (m *MountpointManager) HasMountpoint(url string) bool {
   umu := strings.TrimSuffix(url, "/")
-  for _, m := range m.Config.UserConfig().Mountpoints {
+  for _, m := range m.Config.UserMountpoints() {
     cmu := strings.TrimSuffix(m.Url, "/")
     if m.Url == url || cmu == umu {
       return true
@@ -186,6 +377,10 @@ func (m *MountpointManager) Collect(mountpoints ...[]Mountpoint) (map[string] *M
   var collection map[string] *MountpointMap = make(map[string] *MountpointMap)
   for _, list := range mountpoints {
     for _, mt := range list {
+      // Proxies are not loaded into a container
+      if mt.Proxy != "" {
+        continue
+      }
       if mt.Container == "" {
         mt.Container = "user"
       }
@@ -214,3 +409,184 @@ func (m *MountpointManager) LoadCollection(collection map[string] *MountpointMap
   }
   return apps, nil
 }
+
+// Mount the proxy mountpoints in the given lists.
+func (m *MountpointManager) LoadProxies(mountpoints ...[]Mountpoint) error {
+  for _, list := range mountpoints {
+    for _, mt := range list {
+      if mt.Proxy == "" {
+        continue
+      }
+      if err := m.MountProxy(mt); err != nil {
+        return err
+      }
+    }
+  }
+  return nil
+}
+
+// Serve a proxy mountpoint, the mountpoint URL may not already be mounted.
+func (m *MountpointManager) MountProxy(mt Mountpoint) error {
+  if !strings.HasPrefix(mt.Url, SLASH) {
+    return fmt.Errorf("Proxy mountpoint URL %s must begin with a slash", mt.Url)
+  }
+  if _, err := mt.Upstream(); err != nil {
+    return err
+  }
+  if m.ProxyHandler == nil {
+    return fmt.Errorf("Proxy mountpoints are not supported")
+  }
+  url := strings.TrimSuffix(mt.Url, SLASH) + SLASH
+  if _, ok := m.MountpointMap[url]; ok {
+    return fmt.Errorf("Mountpoint URL %s is already mounted", url)
+  }
+  handler, err := m.ProxyHandler(mt)
+  if err != nil {
+    return err
+  }
+  m.MountpointMap[url] = handler
+  m.Proxies[url] = mt
+  Log.Info("serving proxy", Fields{"url": url, "proxy": mt.Proxy})
+  return nil
+}
+
+// Stop serving a proxy mountpoint, returns false when no proxy
+// is mounted at the URL.
+func (m *MountpointManager) UnmountProxy(url string) bool {
+  url = strings.TrimSuffix(url, SLASH) + SLASH
+  if _, ok := m.Proxies[url]; !ok {
+    return false
+  }
+  delete(m.MountpointMap, url)
+  delete(m.Proxies, url)
+  return true
+}
+
+// Create, serve and persist a proxy mountpoint.
+func (m *MountpointManager) CreateProxy(mt Mountpoint) error {
+  if m.HasMountpoint(mt.Url) {
+    return fmt.Errorf("Mountpoint URL %s already exists", mt.Url)
+  }
+  if err := m.MountProxy(mt); err != nil {
+    return err
+  }
+  var conf *ServerConfig = m.Config.AddMountpoint(mt)
+  if err := m.Config.WriteFile(conf, ""); err != nil {
+    m.UnmountProxy(mt.Url)
+    return err
+  }
+  return nil
+}
+
+// Stop serving a proxy mountpoint and remove it from the user configuration.
+func (m *MountpointManager) DeleteProxy(url string) (*Mountpoint, error) {
+  url = strings.TrimSuffix(url, SLASH) + SLASH
+  mt, ok := m.Proxies[url]
+  if !ok {
+    return nil, fmt.Errorf("Proxy mountpoint %s not found", url)
+  }
+  if !m.HasMountpoint(url) {
+    return nil, fmt.Errorf("Cannot delete system proxy mountpoint %s", url)
+  }
+  m.UnmountProxy(url)
+  var conf *ServerConfig = m.Config.DeleteMountpoint(mt.Url)
+  if err := m.Config.WriteFile(conf, ""); err != nil {
+    return nil, err
+  }
+  return &mt, nil
+}
+
+// Normalize and validate a virtual host name, the host may not be
+// used by an application other than the given application.
+func (m *MountpointManager) CheckHost(host string, app *Application) (string, error) {
+  host = NormalizeHost(host)
+  if !ValidHost(host) {
+    return "", fmt.Errorf("Virtual host name %s is invalid", host)
+  }
+  if existing := m.hostApplication(host); existing != nil && existing != app {
+    return "", fmt.Errorf("Virtual host %s is already used by %s", host, existing.Url)
+  }
+  return host, nil
+}
+
+// Get the proxy mountpoints sorted by URL.
+func (m *MountpointManager) ProxyList() []Mountpoint {
+  var urls []string
+  for url := range m.Proxies {
+    urls = append(urls, url)
+  }
+  sort.Strings(urls)
+  list := []Mountpoint{}
+  for _, url := range urls {
+    list = append(list, m.Proxies[url])
+  }
+  return list
+}
+
+// Private
+
+// Get the URL an application for a mountpoint is served from
+// without a trailing slash.
+func (m *MountpointManager) mountpointUrl(mt Mountpoint) string {
+  url := mt.Url
+  if url == "" {
+    container := mt.Container
+    if container == "" {
+      container = "user"
+    }
+    url = fmt.Sprintf("/%s/%s/", container, filepath.Base(mt.Path))
+  }
+  return strings.TrimSuffix(url, "/")
+}
+
+// Find an application by virtual host name.
+func (m *MountpointManager) hostApplication(host string) *Application {
+  if host == "" {
+    return nil
+  }
+  for _, c := range m.Host.Containers {
+    for _, app := range c.Apps {
+      if app.Host == host {
+        return app
+      }
+    }
+  }
+  return nil
+}
+
+// Unmount and remove the in-memory application for a mountpoint URL.
+func (m *MountpointManager) unload(url string) {
+  if m.UnmountProxy(url) {
+    return
+  }
+  for _, c := range m.Host.Containers {
+    for _, app := range c.Apps {
+      if strings.TrimSuffix(app.Url, "/") == url {
+        m.UnmountApplication(app)
+        c.Del(app)
+        return
+      }
+    }
+  }
+}
+
+// Load and mount the application for a mountpoint.
+func (m *MountpointManager) load(mt Mountpoint) error {
+  if mt.Proxy != "" {
+    return m.MountProxy(mt)
+  }
+  collection, err := m.Collect([]Mountpoint{mt})
+  if err != nil {
+    return err
+  }
+  apps, err := m.LoadCollection(collection)
+  if err != nil {
+    return err
+  }
+  if m.Mount != nil {
+    for _, app := range apps {
+      m.Mount(app)
+    }
+  }
+  return nil
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+  "os"
+  "testing"
+  "net/http"
+  "io/ioutil"
+  "path/filepath"
+  . "github.com/tmpfs/pageloop/model"
+)
+
+func TestVirtualHost(t *testing.T) {
+  host := NewHost()
+  c := NewContainer("user", "")
+  host.Add(c)
+
+  app := NewApplication("/user/blog/", "")
+  app.Name = "blog"
+  app.Host = "blog.example.com"
+  if err := c.Add(app); err != nil {
+    t.Fatal(err)
+  }
+
+  m := NewMountpointManager(&ServerConfig{}, host)
+  m.MountpointMap[app.PublishUrl()] = http.NotFoundHandler()
+
+  for _, name := range []string{"blog.example.com", "Blog.Example.com:3577", "blog.example.com."} {
+    if found, handler := m.VirtualHost(name); found != app || handler == nil {
+      t.Errorf("Expected application for host %s", name)
+    }
+  }
+  if found, _ := m.VirtualHost("localhost:3577"); found != nil {
+    t.Errorf("Expected no application for unknown host")
+  }
+
+  if _, err := m.CheckHost("BLOG.example.com", nil); err == nil {
+    t.Errorf("Expected error for duplicate host")
+  }
+  if h, err := m.CheckHost("Blog.Example.com", app); err != nil || h != "blog.example.com" {
+    t.Errorf("Expected host of the same application to be accepted, got %s %v", h, err)
+  }
+  for _, name := range []string{"-blog.example.com", "blog_example.com", "blog..com"} {
+    if _, err := m.CheckHost(name, nil); err == nil {
+      t.Errorf("Expected host %s to be invalid", name)
+    }
+  }
+}
+
+func TestCreateProxyWritesValidConfig(t *testing.T) {
+  dir, err := ioutil.TempDir("", "pageloop-proxy")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  path := filepath.Join(dir, "config.yml")
+  if err := ioutil.WriteFile(path, []byte("mountpoints:\n  - url: /keep/\n    path: ./keep\n"), 0644); err != nil {
+    t.Fatal(err)
+  }
+  conf := &ServerConfig{Addr: ":3577"}
+  if err := conf.Merge(path); err != nil {
+    t.Fatal(err)
+  }
+
+  m := NewMountpointManager(conf, NewHost())
+  m.ProxyHandler = func(mt Mountpoint) (http.Handler, error) {
+    return http.NotFoundHandler(), nil
+  }
+  if err := m.CreateProxy(Mountpoint{Url: "/api/", Proxy: "127.0.0.1:8081"}); err != nil {
+    t.Fatal(err)
+  }
+
+  content, err := ioutil.ReadFile(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err := ValidateConfig(path, content); err != nil {
+    t.Errorf("Expected written configuration to be valid, got %s\n%s", err, content)
+  }
+  reloaded := &ServerConfig{}
+  if err := reloaded.Merge(path); err != nil {
+    t.Fatal(err)
+  }
+  if list := reloaded.UserMountpoints(); len(list) != 2 || list[1].Proxy != "127.0.0.1:8081" || list[1].Path != "" {
+    t.Errorf("Expected proxy mountpoint in configuration, got %#v", list)
+  }
+}
@@ -0,0 +1,285 @@
+package core
+
+import(
+  "io"
+  "fmt"
+  "reflect"
+  "strings"
+  "strconv"
+  "gopkg.in/yaml.v2"
+)
+
+const(
+  // Prefix for environment variables that override configuration fields.
+  EnvPrefix = "PAGELOOP_"
+)
+
+// Where the value of a configuration field was assigned.
+const(
+  SourceDefault = "default"
+  SourceFile = "file"
+  SourceEnv = "env"
+  SourceFlag = "flag"
+)
+
+var(
+  mountpointsType = reflect.TypeOf([]Mountpoint{})
+)
+
+// A configuration field that may be overridden by an environment
+// variable or a command line flag.
+type ConfigField struct {
+  // Name of the field in configuration files, also used as the flag name.
+  Name string
+  // Name of the environment variable.
+  Env string
+  // Field type.
+  Type reflect.Type
+  index []int
+}
+
+// Determine if the field is a boolean, boolean flags do not require a value.
+func (f ConfigField) IsBool() bool {
+  return f.Type.Kind() == reflect.Bool
+}
+
+// A value assigned after the configuration file was merged, kept
+// so it can be applied again when the file is reloaded.
+type configOverride struct {
+  name string
+  value string
+  source string
+}
+
+// Get the configuration fields that may be overridden.
+//
+// Every exported field of ServerConfig with a YAML name is included,
+// the environment variable is the upper case name with hyphens replaced
+// by underscores and the EnvPrefix, eg: PAGELOOP_SHUTDOWN_TIMEOUT.
+func ConfigFields() []ConfigField {
+  var fields []ConfigField
+  t := reflect.TypeOf(ServerConfig{})
+  for i := 0; i < t.NumField(); i++ {
+    f := t.Field(i)
+    if f.PkgPath != "" {
+      continue
+    }
+    name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+    if name == "" || name == "-" {
+      continue
+    }
+    env := EnvPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+    fields = append(fields, ConfigField{Name: name, Env: env, Type: f.Type, index: f.Index})
+  }
+  return fields
+}
+
+// Parse a comma separated list of mountpoints.
+//
+// Each entry is either a path or a URL and path separated by an
+// equals sign, eg: /docs/=./docs,./blog
+func ParseMountpoints(value string) []Mountpoint {
+  var list []Mountpoint
+  for _, entry := range strings.Split(value, ",") {
+    entry = strings.TrimSpace(entry)
+    if entry == "" {
+      continue
+    }
+    if i := strings.Index(entry, "="); i > -1 {
+      list = append(list, Mountpoint{Url: entry[0:i], Path: entry[i+1:]})
+    } else {
+      list = append(list, Mountpoint{Path: entry})
+    }
+  }
+  return list
+}
+
+// Assign a configuration field from a string value.
+//
+// Mountpoints replace any mountpoints declared in the configuration file
+// but are not written to the file. The value is kept and assigned again
+// when the configuration file is reloaded.
+func (c *ServerConfig) Set(name string, value string, source string) error {
+  if err := c.set(name, value, source); err != nil {
+    return err
+  }
+  c.overrides = append(c.overrides, configOverride{name: name, value: value, source: source})
+  return nil
+}
+
+// Assign configuration fields from environment variables.
+//
+// The lookup function is typically os.LookupEnv.
+func (c *ServerConfig) Environ(lookup func(string) (string, bool)) error {
+  for _, f := range ConfigFields() {
+    if value, ok := lookup(f.Env); ok {
+      if err := c.Set(f.Name, value, SourceEnv); err != nil {
+        return fmt.Errorf("%s: %s", f.Env, err.Error())
+      }
+    }
+  }
+  return nil
+}
+
+// Get where the value of a configuration field was assigned.
+func (c *ServerConfig) Source(name string) string {
+  if source, ok := c.sources[name]; ok {
+    return source
+  }
+  return SourceDefault
+}
+
+// Write the effective configuration as YAML annotated with
+// where each value was assigned.
+func (c *ServerConfig) Print(w io.Writer) error {
+  v := reflect.ValueOf(c).Elem()
+  for _, f := range ConfigFields() {
+    if f.Type == mountpointsType {
+      if err := c.printMountpoints(w, f.Name); err != nil {
+        return err
+      }
+      continue
+    }
+
+    out, err := yaml.Marshal(map[string]interface{}{f.Name: v.FieldByIndex(f.index).Interface()})
+    if err != nil {
+      return err
+    }
+    line := strings.TrimSuffix(string(out), "\n")
+    if _, err = fmt.Fprintf(w, "%-40s # %s\n", line, c.Source(f.Name)); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// Private
+
+// Assign a field without recording the override.
+func (c *ServerConfig) set(name string, value string, source string) error {
+  var field *ConfigField
+  for _, f := range ConfigFields() {
+    if f.Name == name {
+      field = &f
+      break
+    }
+  }
+  if field == nil {
+    return fmt.Errorf("Unknown configuration field %s", name)
+  }
+
+  target := reflect.ValueOf(c).Elem().FieldByIndex(field.index)
+  switch {
+    case field.Type == mountpointsType:
+      // Applications in the configuration are user applications, kept
+      // apart from the configuration file so they are never written
+      c.mountpointOverrides = ParseMountpoints(value)
+      c.hasMountpointOverrides = true
+    case field.Type.Kind() == reflect.String:
+      target.SetString(value)
+    case field.Type.Kind() == reflect.Bool:
+      b, err := strconv.ParseBool(value)
+      if err != nil {
+        return fmt.Errorf("Invalid boolean for %s: %s", name, value)
+      }
+      target.SetBool(b)
+    case field.Type.Kind() == reflect.Int:
+      n, err := strconv.Atoi(value)
+      if err != nil {
+        return fmt.Errorf("Invalid integer for %s: %s", name, value)
+      }
+      target.SetInt(int64(n))
+    case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.String:
+      var list []string
+      for _, s := range strings.Split(value, ",") {
+        if s = strings.TrimSpace(s); s != "" {
+          list = append(list, s)
+        }
+      }
+      target.Set(reflect.ValueOf(list).Convert(field.Type))
+    default:
+      return fmt.Errorf("Cannot assign configuration field %s from a string", name)
+  }
+
+  c.setSource(name, source)
+  return nil
+}
+
+// Assign fields that are set in a configuration file.
+func (c *ServerConfig) mergeFields(file *ServerConfig) {
+  dest := reflect.ValueOf(c).Elem()
+  src := reflect.ValueOf(file).Elem()
+  for _, f := range ConfigFields() {
+    value := src.FieldByIndex(f.index)
+    if isZero(value) {
+      continue
+    }
+    // File mountpoints are kept in the user configuration
+    if f.Type != mountpointsType {
+      dest.FieldByIndex(f.index).Set(value)
+    }
+    c.setSource(f.Name, SourceFile)
+  }
+}
+
+// Assign overrides again after the configuration file is merged.
+func (c *ServerConfig) applyOverrides() error {
+  for _, o := range c.overrides {
+    if err := c.set(o.name, o.value, o.source); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func (c *ServerConfig) setSource(name string, source string) {
+  if c.sources == nil {
+    c.sources = make(map[string]string)
+  }
+  c.sources[name] = source
+}
+
+// Print system mountpoints followed by user mountpoints.
+func (c *ServerConfig) printMountpoints(w io.Writer, name string) error {
+  if _, err := fmt.Fprintf(w, "%s:\n", name); err != nil {
+    return err
+  }
+  groups := []struct{
+    source string
+    list []Mountpoint
+  }{
+    {SourceDefault, c.Mountpoints},
+    {c.Source(name), c.UserMountpoints()}}
+
+  for _, g := range groups {
+    if len(g.list) == 0 {
+      continue
+    }
+    fmt.Fprintf(w, "  # %s\n", g.source)
+    for _, mt := range g.list {
+      out, err := yaml.Marshal(mt)
+      if err != nil {
+        return err
+      }
+      lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+      for i, line := range lines {
+        prefix := "    "
+        if i == 0 {
+          prefix = "  - "
+        }
+        if _, err = fmt.Fprintf(w, "%s%s\n", prefix, line); err != nil {
+          return err
+        }
+      }
+    }
+  }
+  return nil
+}
+
+func isZero(v reflect.Value) bool {
+  switch v.Kind() {
+    case reflect.Slice, reflect.Map:
+      return v.Len() == 0
+  }
+  return v.IsZero()
+}
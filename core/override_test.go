@@ -0,0 +1,86 @@
+package core
+
+import (
+  "os"
+  "strings"
+  "testing"
+  "io/ioutil"
+  "path/filepath"
+)
+
+func TestServerConfigOverrides(t *testing.T) {
+  env := map[string]string{
+    "PAGELOOP_SOURCE": "/tmp/source",
+    "PAGELOOP_SHUTDOWN_TIMEOUT": "5",
+    "PAGELOOP_SELF_SIGNED": "true",
+    "PAGELOOP_MOUNTPOINTS": "/docs/=./docs, ./blog"}
+
+  conf := &ServerConfig{Addr: ":3577"}
+  if err := conf.Environ(func(name string) (string, bool) {
+    value, ok := env[name]
+    return value, ok
+  }); err != nil {
+    t.Fatal(err)
+  }
+  if err := conf.Set("addr", ":8080", SourceFlag); err != nil {
+    t.Fatal(err)
+  }
+
+  if conf.Addr != ":8080" || conf.Source("addr") != SourceFlag {
+    t.Errorf("Unexpected addr %s from %s", conf.Addr, conf.Source("addr"))
+  }
+  if conf.SourceDirectory != "/tmp/source" || conf.ShutdownTimeout != 5 || !conf.SelfSigned {
+    t.Errorf("Environment variables not assigned %#v", conf)
+  }
+  if conf.Source("cert") != SourceDefault {
+    t.Errorf("Expected default source for cert, got %s", conf.Source("cert"))
+  }
+
+  mountpoints := conf.UserMountpoints()
+  if len(mountpoints) != 2 || mountpoints[0].Url != "/docs/" || mountpoints[1].Path != "./blog" {
+    t.Errorf("Unexpected mountpoints %#v", mountpoints)
+  }
+
+  if err := conf.Set("shutdown-timeout", "soon", SourceFlag); err == nil {
+    t.Error("Expected error for invalid integer")
+  }
+}
+
+func TestMountpointOverridesNotWritten(t *testing.T) {
+  dir, err := ioutil.TempDir("", "pageloop-override")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  path := filepath.Join(dir, "config.yml")
+  if err := ioutil.WriteFile(path, []byte("mountpoints:\n  - url: /keep/\n    path: ./keep\n"), 0644); err != nil {
+    t.Fatal(err)
+  }
+  conf := &ServerConfig{Addr: ":3577"}
+  if err := conf.Set("mountpoints", "/envsite/=./envsite", SourceEnv); err != nil {
+    t.Fatal(err)
+  }
+  if err := conf.Merge(path); err != nil {
+    t.Fatal(err)
+  }
+  if list := conf.UserMountpoints(); len(list) != 1 || list[0].Url != "/envsite/" {
+    t.Fatalf("Expected override mountpoints, got %#v", list)
+  }
+
+  // Applications created at runtime are served and written to the file
+  created := Mountpoint{Url: "/user/blog/", Path: "./blog"}
+  if err := conf.WriteFile(conf.AddMountpoint(created), ""); err != nil {
+    t.Fatal(err)
+  }
+  if list := conf.UserMountpoints(); len(list) != 2 || list[1].Url != "/user/blog/" {
+    t.Errorf("Expected created mountpoint to be served, got %#v", list)
+  }
+  content, err := ioutil.ReadFile(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if s := string(content); !strings.Contains(s, "/keep/") || !strings.Contains(s, "/user/blog/") || strings.Contains(s, "/envsite/") {
+    t.Errorf("Unexpected configuration file %s", s)
+  }
+}
@@ -0,0 +1,270 @@
+package core
+
+import(
+  "os"
+  "fmt"
+  "net/http"
+  "io/ioutil"
+  "crypto/sha256"
+  "crypto/subtle"
+  "encoding/hex"
+  "gopkg.in/yaml.v2"
+  . "github.com/tmpfs/pageloop/model"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+const(
+  PolicyFileName = "policy.yml"
+
+  // Grants for this user apply to everyone including
+  // anonymous requests.
+  AnyUser = "*"
+)
+
+// A permission that may be granted on the model hierarchy.
+type Permission string
+
+const(
+  PermissionRead Permission = "read"
+  PermissionWrite Permission = "write"
+  PermissionPublish Permission = "publish"
+  PermissionRunTask Permission = "run-task"
+  // Admin implies all other permissions.
+  PermissionAdmin Permission = "admin"
+)
+
+var(
+  permissions = []Permission{
+    PermissionRead,
+    PermissionWrite,
+    PermissionPublish,
+    PermissionRunTask,
+    PermissionAdmin}
+)
+
+// A user that may authenticate using HTTP basic authentication.
+type PolicyUser struct {
+  // Hex encoded SHA-256 digest of the user password.
+  Password string `json:"-" yaml:"password"`
+}
+
+// Assigns permissions to a user at a level of the Host -> Container -> Application
+// hierarchy.
+//
+// A grant without a container applies to the host, a grant with a container
+// and no application applies to the container and a grant with both applies
+// to a single application.
+type Grant struct {
+  // User name or * for all users.
+  User string `json:"user" yaml:"user"`
+  // Name of a role declared in the policy.
+  Role string `json:"role,omitempty" yaml:"role,omitempty"`
+  // Permissions granted in addition to those of the role.
+  Permissions []Permission `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+  // Container name.
+  Container string `json:"container,omitempty" yaml:"container,omitempty"`
+  // Application name, requires a container.
+  Application string `json:"application,omitempty" yaml:"application,omitempty"`
+}
+
+// Level of the model hierarchy a grant applies to.
+func (g *Grant) level() int {
+  if g.Application != "" {
+    return 2
+  } else if g.Container != "" {
+    return 1
+  }
+  return 0
+}
+
+// Authorisation policy loaded from a YAML file.
+//
+// When resolving permissions grants for the named user are used before
+// grants for all users and only the grants at the most specific matching
+// level are used; application grants replace container grants which
+// replace host grants. A nil policy allows everything.
+type Policy struct {
+  // Users that may authenticate.
+  Users map[string]*PolicyUser `json:"-" yaml:"users"`
+  // Named sets of permissions.
+  Roles map[string][]Permission `json:"roles" yaml:"roles"`
+  // Permission grants.
+  Grants []Grant `json:"grants" yaml:"grants"`
+}
+
+// Load a policy file.
+//
+// When path is the empty string or the file does not exist the
+// default policy is returned.
+func LoadPolicy(path string) (*Policy, error) {
+  var err error
+  var content []byte
+  if path != "" {
+    if content, err = ioutil.ReadFile(path); err != nil {
+      if !os.IsNotExist(err) {
+        return nil, err
+      }
+    }
+  }
+
+  if content == nil {
+    content = MustAsset(PolicyFileName)
+  }
+
+  p := &Policy{}
+  if err = yaml.Unmarshal(content, p); err != nil {
+    return nil, err
+  }
+
+  if err = p.validate(); err != nil {
+    return nil, fmt.Errorf("Invalid policy %s: %s", path, err.Error())
+  }
+
+  return p, nil
+}
+
+// Get the permissions for a user on a container or application.
+//
+// Pass the empty string for application to get container permissions
+// and the empty string for both to get host permissions.
+func (p *Policy) Permissions(user string, container string, application string) []Permission {
+  if user != "" {
+    if list, ok := p.resolve(user, container, application); ok {
+      return list
+    }
+  }
+  list, _ := p.resolve(AnyUser, container, application)
+  return list
+}
+
+// Determine if a user has a permission on a container or application.
+func (p *Policy) Allow(user string, perm Permission, container string, application string) bool {
+  if p == nil {
+    return true
+  }
+  for _, granted := range p.Permissions(user, container, application) {
+    if granted == perm || granted == PermissionAdmin {
+      return true
+    }
+  }
+  return false
+}
+
+// Get a forbidden error when a user does not have a permission.
+func (p *Policy) Authorize(user string, perm Permission, container string, application string) *StatusError {
+  if !p.Allow(user, perm, container, application) {
+    target := container
+    if application != "" {
+      target += "/" + application
+    }
+    if user == "" {
+      user = "anonymous"
+    }
+    return CommandError(http.StatusForbidden, "User %s does not have %s permission for %s", user, perm, target)
+  }
+  return nil
+}
+
+// Get the user for a request.
+//
+// Requests without credentials are anonymous and the empty string is
+// returned. Requests with basic authentication credentials must match
+// a policy user otherwise an unauthorized error is returned.
+func (p *Policy) Authenticate(req *http.Request) (string, *StatusError) {
+  name, password, ok := req.BasicAuth()
+  if !ok {
+    return "", nil
+  }
+  if p != nil {
+    if u := p.Users[name]; u != nil {
+      sum := sha256.Sum256([]byte(password))
+      digest := hex.EncodeToString(sum[:])
+      if subtle.ConstantTimeCompare([]byte(digest), []byte(u.Password)) == 1 {
+        return name, nil
+      }
+    }
+  }
+  return "", CommandError(http.StatusUnauthorized, "Invalid credentials for user %s", name)
+}
+
+// Assign the protected flag to a container and it's applications.
+//
+// Containers and applications are protected when anonymous users
+// do not have the admin permission.
+func (p *Policy) Protect(c *Container) {
+  c.Protected = !p.Allow("", PermissionAdmin, c.Name, "")
+  for _, app := range c.Apps {
+    app.Protected = !p.Allow("", PermissionAdmin, c.Name, app.Name)
+  }
+}
+
+// Private
+
+// Get the permissions from the most specific grants for a user
+// name, returns false when no grant for the user name matches.
+func (p *Policy) resolve(user string, container string, application string) ([]Permission, bool) {
+  for level := 2; level >= 0; level-- {
+    var list []Permission
+    var matched bool
+    for _, g := range p.Grants {
+      if g.User != user || g.level() != level || !g.matches(container, application) {
+        continue
+      }
+      matched = true
+      list = append(list, p.Roles[g.Role]...)
+      list = append(list, g.Permissions...)
+    }
+    if matched {
+      return list, true
+    }
+  }
+  return nil, false
+}
+
+// Determine if a grant applies to the target.
+func (g *Grant) matches(container string, application string) bool {
+  if g.Container != "" && g.Container != container {
+    return false
+  }
+  if g.Application != "" && g.Application != application {
+    return false
+  }
+  return true
+}
+
+func (p *Policy) validate() error {
+  valid := func(perm Permission) bool {
+    for _, v := range permissions {
+      if v == perm {
+        return true
+      }
+    }
+    return false
+  }
+
+  for name, list := range p.Roles {
+    for _, perm := range list {
+      if !valid(perm) {
+        return fmt.Errorf("unknown permission %s in role %s", perm, name)
+      }
+    }
+  }
+
+  for _, g := range p.Grants {
+    if g.User == "" {
+      return fmt.Errorf("grant requires a user")
+    }
+    if g.Role != "" && p.Roles[g.Role] == nil {
+      return fmt.Errorf("unknown role %s for user %s", g.Role, g.User)
+    }
+    if g.Application != "" && g.Container == "" {
+      return fmt.Errorf("grant for application %s requires a container", g.Application)
+    }
+    for _, perm := range g.Permissions {
+      if !valid(perm) {
+        return fmt.Errorf("unknown permission %s for user %s", perm, g.User)
+      }
+    }
+  }
+  return nil
+}
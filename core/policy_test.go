@@ -0,0 +1,73 @@
+package core
+
+import (
+  "testing"
+)
+
+func TestPolicyAllow(t *testing.T) {
+  p := &Policy{
+    Roles: map[string][]Permission{
+      "owner": []Permission{PermissionAdmin},
+      "editor": []Permission{PermissionRead, PermissionWrite},
+    },
+    Grants: []Grant{
+      Grant{User: AnyUser, Role: "owner"},
+      Grant{User: AnyUser, Container: "system", Role: "editor"},
+      Grant{User: "alice", Container: "system", Application: "editor", Role: "owner"},
+    },
+  }
+
+  if err := p.validate(); err != nil {
+    t.Fatal(err)
+  }
+
+  if !p.Allow("", PermissionRunTask, "user", "blog") {
+    t.Error("Expected admin to imply run-task on host grant")
+  }
+
+  if p.Allow("", PermissionAdmin, "system", "docs") {
+    t.Error("Expected container grant to replace host grant")
+  }
+
+  if !p.Allow("", PermissionWrite, "system", "docs") {
+    t.Error("Expected write permission from container grant")
+  }
+
+  if !p.Allow("alice", PermissionAdmin, "system", "editor") {
+    t.Error("Expected admin permission from application grant")
+  }
+
+  if p.Allow("bob", PermissionAdmin, "system", "editor") {
+    t.Error("Unexpected admin permission for user without application grant")
+  }
+
+  if err := p.Authorize("", PermissionAdmin, "system", ""); err == nil || err.Status != 403 {
+    t.Error("Expected forbidden error")
+  }
+}
+
+func TestPolicyNamedUser(t *testing.T) {
+  p, err := LoadPolicy("")
+  if err != nil {
+    t.Fatal(err)
+  }
+  p.Grants = append(p.Grants,
+    Grant{User: "alice", Role: "owner"},
+    Grant{User: "bob", Container: "user", Application: "blog", Role: "viewer"})
+
+  if !p.Allow("alice", PermissionAdmin, "system", "editor") {
+    t.Error("Expected named host grant to apply before wildcard container grant")
+  }
+  if !p.Allow("alice", PermissionAdmin, "template", "") {
+    t.Error("Expected named host grant for container")
+  }
+  if p.Allow("", PermissionAdmin, "system", "editor") || p.Allow("carol", PermissionAdmin, "system", "") {
+    t.Error("Expected wildcard container grant for other users")
+  }
+  if p.Allow("bob", PermissionWrite, "user", "blog") {
+    t.Error("Expected named application grant to replace wildcard host grant")
+  }
+  if !p.Allow("bob", PermissionWrite, "user", "notes") {
+    t.Error("Expected wildcard grant where no named grant matches")
+  }
+}
@@ -89,6 +89,8 @@ type Route struct {
   Seq uint64 `json:"-"`
   // Route definition path or request path
   Path string `json:"path"`
+  // Route definition path, retained when a match is assigned the request path
+  Pattern string `json:"-"`
   // Request method
   Method string `json:"method"`
   // Status code to send when ok
@@ -154,6 +156,7 @@ func (r *Route) Clone() *Route {
     ServiceMethod: r.ServiceMethod,
     Seq: r.Seq,
     Path: r.Path,
+    Pattern: r.Pattern,
     Method: r.Method,
     Status: r.Status,
     Parameters: r.Parameters,
@@ -173,6 +176,7 @@ type Router struct {
 
 // Adds a route to the router.
 func (r *Router) Add(route *Route) *Route {
+  route.Pattern = route.Path
   route.Parameters = &Parameters{}
   route.Parameters.Parse(route.Path)
   if r.methods == nil {
@@ -197,6 +201,16 @@ func (r *Router) Get(name string) *Route {
   return r.methods[name]
 }
 
+// Get all routes ordered by request method.
+func (r *Router) Routes() []*Route {
+  var list []*Route
+  list = append(list, r.get...)
+  list = append(list, r.put...)
+  list = append(list, r.post...)
+  list = append(list, r.del...)
+  return list
+}
+
 // Get all routes by service method name.
 func (r *Router) GetAll(name string) []*Route {
   var list []*Route
@@ -335,7 +349,9 @@ func init() {
 
   route("Core.Meta", "", http.MethodGet, http.StatusOK)
   route("Core.Stats", "/stats", http.MethodGet, http.StatusOK)
+  route("Core.ReloadConfig", "/config/reload", http.MethodPost, http.StatusOK)
   route("Service.List", "/services", http.MethodGet, http.StatusOK)
+  route("Service.OpenApi", "/openapi.json", http.MethodGet, http.StatusOK)
   route("Service.Read", "/services/*", http.MethodGet, http.StatusOK)
   route("Service.ReadMethod", "/services/*/*", http.MethodGet, http.StatusOK)
   route("Service.ReadMethodCalls", "/services/*/*/calls", http.MethodGet, http.StatusOK)
@@ -343,17 +359,31 @@ func init() {
   route("Job.List", "/jobs", http.MethodGet, http.StatusOK)
   route("Job.Read", "/jobs/*", http.MethodGet, http.StatusOK)
   route("Job.Delete", "/jobs/*", http.MethodDelete, http.StatusOK)
+  route("Audit.List", "/audit", http.MethodGet, http.StatusOK)
+  route("Proxy.List", "/proxies", http.MethodGet, http.StatusOK)
+  route("Proxy.Create", "/proxies", http.MethodPut, http.StatusCreated)
+  route("Proxy.Delete", "/proxies", http.MethodDelete, http.StatusOK)
+  route("Trash.List", "/trash", http.MethodGet, http.StatusOK)
+  route("Trash.Restore", "/trash/*", http.MethodPost, http.StatusOK)
+  route("Trash.Purge", "/trash", http.MethodDelete, http.StatusOK)
+  route("Trash.Purge", "/trash/*", http.MethodDelete, http.StatusOK)
   route("Host.List", "/apps", http.MethodGet, http.StatusOK)
+  route("Host.Search", "/search", http.MethodGet, http.StatusOK)
   route("Container.Read", "/apps/*", http.MethodGet, http.StatusOK)
   route("Container.CreateApp", "/apps/*", http.MethodPut, http.StatusCreated)
   route("Application.Read", "/apps/*/*", http.MethodGet, http.StatusOK)
   route("Application.Delete", "/apps/*/*", http.MethodDelete, http.StatusOK)
+  route("Application.SetHost", "/apps/*/*/host", http.MethodPut, http.StatusOK)
   route("Application.ReadFiles", "/apps/*/*/files", http.MethodGet, http.StatusOK)
   route("Application.ReadPages", "/apps/*/*/pages", http.MethodGet, http.StatusOK)
+  route("Application.Search", "/apps/*/*/search", http.MethodGet, http.StatusOK)
+  route("Application.Replace", "/apps/*/*/replace", http.MethodPost, http.StatusOK)
   route("Application.DeleteFiles", "/apps/*/*/files", http.MethodDelete, http.StatusOK)
   route("Application.RunTask", "/apps/*/*/tasks/*", http.MethodPut, http.StatusAccepted)
   route("File.Read", "/apps/*/*/files/*", http.MethodGet, http.StatusOK)
   route("File.ReadPage", "/apps/*/*/pages/*", http.MethodGet, http.StatusOK)
+  route("File.ReadChildren", "/apps/*/*/children", http.MethodGet, http.StatusOK)
+  route("File.ReadChildren", "/apps/*/*/children/*", http.MethodGet, http.StatusOK)
   route("File.Create", "/apps/*/*/files/*", http.MethodPut, http.StatusCreated)
   route("File.Save", "/apps/*/*/files/*", http.MethodPost, http.StatusOK)
   route("File.Delete", "/apps/*/*/files/*", http.MethodDelete, http.StatusOK)
@@ -362,6 +392,8 @@ func init() {
   r.ResponseType = ResponseTypeByte
   r = route("File.ReadSourceRaw", "/apps/*/*/raw/*", http.MethodGet, http.StatusOK)
   r.ResponseType = ResponseTypeByte
+  r = route("File.Preview", "/apps/*/*/preview/*", http.MethodGet, http.StatusOK)
+  r.ResponseType = ResponseTypeByte
 
   // Conditional on location header
   r = route("File.Move", "/apps/*/*/files/*", http.MethodPost, http.StatusOK)
@@ -369,6 +401,8 @@ func init() {
     return req.Header.Get("Location") != ""
   }
 
+  route("File.Copy", "/apps/*/*/copy/*", http.MethodPost, http.StatusCreated)
+
   // TODO: conditional on template object
   route("File.CreateTemplate", "/apps/*/*/files/*", http.MethodPut, http.StatusCreated)
 
@@ -0,0 +1,120 @@
+package core
+
+import(
+  "os"
+  "net"
+  "time"
+  "math/big"
+  "io/ioutil"
+  "path/filepath"
+  "crypto/rand"
+  "crypto/ecdsa"
+  "crypto/elliptic"
+  "crypto/x509"
+  "crypto/x509/pkix"
+  "encoding/pem"
+)
+
+const(
+  // Directory relative to the config directory for generated certificates.
+  TLSDirectory = "tls"
+  CertFileName = "cert.pem"
+  KeyFileName = "key.pem"
+)
+
+// Determine if the server should listen for HTTPS.
+func (c *ServerConfig) HasTLS() bool {
+  return (c.CertFile != "" && c.KeyFile != "") || c.SelfSigned
+}
+
+// Get the certificate and key files for HTTPS.
+//
+// When a certificate and key are configured they are returned, otherwise
+// if self-signed is enabled a development certificate is generated in the
+// tls directory next to the config file on first run. Returns empty strings
+// when TLS is not enabled.
+func (c *ServerConfig) TLSFiles() (string, string, error) {
+  if c.CertFile != "" && c.KeyFile != "" {
+    return c.CertFile, c.KeyFile, nil
+  }
+
+  if !c.SelfSigned {
+    return "", "", nil
+  }
+
+  dir := filepath.Join(c.ConfigDirectory(), TLSDirectory)
+  cert := filepath.Join(dir, CertFileName)
+  key := filepath.Join(dir, KeyFileName)
+
+  // Already generated
+  if _, err := os.Stat(cert); err == nil {
+    if _, err := os.Stat(key); err == nil {
+      return cert, key, nil
+    }
+  }
+
+  if err := os.MkdirAll(dir, os.ModeDir | 0700); err != nil {
+    return "", "", err
+  }
+
+  if err := GenerateCertificate(cert, key, c.Addr); err != nil {
+    return "", "", err
+  }
+
+  return cert, key, nil
+}
+
+// Generate a self-signed certificate valid for localhost, the loopback
+// addresses and the host in addr when it is not empty.
+func GenerateCertificate(certFile string, keyFile string, addr string) error {
+  var err error
+  var priv *ecdsa.PrivateKey
+  if priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+    return err
+  }
+
+  limit := new(big.Int).Lsh(big.NewInt(1), 128)
+  serial, err := rand.Int(rand.Reader, limit)
+  if err != nil {
+    return err
+  }
+
+  now := time.Now()
+  template := x509.Certificate{
+    SerialNumber: serial,
+    Subject: pkix.Name{Organization: []string{MetaData.Name + " development"}},
+    NotBefore: now.Add(-time.Hour),
+    NotAfter: now.Add(365 * 24 * time.Hour),
+    KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+    ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+    BasicConstraintsValid: true,
+    IsCA: true,
+    DNSNames: []string{"localhost"},
+    IPAddresses: []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}}
+
+  if host, _, err := net.SplitHostPort(addr); err == nil && host != "" {
+    if ip := net.ParseIP(host); ip != nil {
+      template.IPAddresses = append(template.IPAddresses, ip)
+    } else if host != "localhost" {
+      template.DNSNames = append(template.DNSNames, host)
+    }
+  }
+
+  der, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+  if err != nil {
+    return err
+  }
+
+  keyBytes, err := x509.MarshalECPrivateKey(priv)
+  if err != nil {
+    return err
+  }
+
+  certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+  keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes})
+
+  if err = ioutil.WriteFile(keyFile, keyPem, 0600); err != nil {
+    return err
+  }
+  return ioutil.WriteFile(certFile, certPem, 0644)
+}
@@ -0,0 +1,307 @@
+package core
+
+import(
+  "os"
+  "fmt"
+  "sort"
+  "sync"
+  "time"
+  "io/ioutil"
+  "encoding/json"
+  "path/filepath"
+  . "github.com/tmpfs/pageloop/model"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+const(
+  TrashDirName = "trash"
+
+  // Item metadata and moved files in an item directory.
+  trashItemFile = "item.json"
+  trashSource = "source"
+)
+
+// A deleted file, directory or application kept in the trash.
+type TrashItem struct {
+  // Identifier for the item.
+  Id string `json:"id"`
+  // Reference to the original location in the form:
+  // file://pageloop.com/{container}/{application}#{url}
+  Ref string `json:"ref"`
+  Container string `json:"container"`
+  Application string `json:"application"`
+  // File URL, empty for applications.
+  Url string `json:"url,omitempty"`
+  Directory bool `json:"dir,omitempty"`
+  // User that deleted the item, empty for anonymous users.
+  User string `json:"user"`
+  // Time the item was deleted.
+  Time time.Time `json:"time"`
+  // Bytes used on disc.
+  Size int64 `json:"size"`
+  // Application path and mountpoint for a deleted application.
+  Path string `json:"path,omitempty"`
+  Mountpoint *Mountpoint `json:"mountpoint,omitempty"`
+}
+
+// Determine if the item is an application.
+func (item *TrashItem) IsApplication() bool {
+  return item.Mountpoint != nil
+}
+
+// Server wide trash for deleted files and applications.
+//
+// Each item is a directory containing the moved files and the item
+// metadata. Items older than the maximum age are purged and the oldest
+// items are purged while the total size exceeds the maximum size.
+type Trash struct {
+  // Directory for trash items, when empty files are deleted permanently.
+  Path string
+  // Maximum age of items, zero keeps items until they are purged.
+  MaxAge time.Duration
+  // Maximum bytes for all items, zero does not limit the size.
+  MaxSize int64
+  items []*TrashItem
+  mu sync.Mutex
+}
+
+// Create a trash that keeps items in path.
+func NewTrash(path string, maxAge time.Duration, maxSize int64) *Trash {
+  return &Trash{Path: path, MaxAge: maxAge, MaxSize: maxSize}
+}
+
+// Read the items in the trash directory and purge expired items.
+func (t *Trash) Load() error {
+  if t.Path == "" {
+    return nil
+  }
+  if err := os.MkdirAll(t.Path, os.ModeDir | 0755); err != nil {
+    return err
+  }
+  infos, err := ioutil.ReadDir(t.Path)
+  if err != nil {
+    return err
+  }
+
+  t.mu.Lock()
+  t.items = nil
+  for _, info := range infos {
+    if !info.IsDir() {
+      continue
+    }
+    content, err := ioutil.ReadFile(filepath.Join(t.Path, info.Name(), trashItemFile))
+    if err != nil {
+      Log.Warn("trash item ignored", Fields{"id": info.Name(), "error": err})
+      continue
+    }
+    item := &TrashItem{}
+    if err := json.Unmarshal(content, item); err != nil {
+      Log.Warn("trash item ignored", Fields{"id": info.Name(), "error": err})
+      continue
+    }
+    item.Id = info.Name()
+    t.items = append(t.items, item)
+  }
+  sort.Slice(t.items, func(i, j int) bool {
+    return t.items[i].Time.Before(t.items[j].Time)
+  })
+  t.mu.Unlock()
+
+  _, err = t.Expire()
+  return err
+}
+
+// Determine if deleted files are moved to the trash.
+func (t *Trash) Enabled() bool {
+  return t != nil && t.Path != ""
+}
+
+// Get the items in the trash, most recent first.
+func (t *Trash) List() []*TrashItem {
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  list := make([]*TrashItem, 0, len(t.items))
+  for i := len(t.items) - 1; i >= 0; i-- {
+    list = append(list, t.items[i])
+  }
+  return list
+}
+
+// Find an item by identifier.
+func (t *Trash) Find(id string) *TrashItem {
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  for _, item := range t.items {
+    if item.Id == id {
+      return item
+    }
+  }
+  return nil
+}
+
+// Move a file or directory to the trash and remove it from the application.
+func (t *Trash) AddFile(app *Application, file *File, user string) (*TrashItem, error) {
+  item := &TrashItem{
+    Ref: fmt.Sprintf("file://pageloop.com/%s/%s#%s", app.Container.Name, app.Name, file.Url),
+    Container: app.Container.Name,
+    Application: app.Name,
+    Url: file.Url,
+    Directory: file.Directory,
+    User: user}
+  return item, t.add(item, func(dest string) error {
+    return app.Discard(file, dest)
+  })
+}
+
+// Move the files for an application to the trash, the application
+// must already have been unmounted.
+func (t *Trash) AddApplication(app *Application, mt Mountpoint, user string) (*TrashItem, error) {
+  item := &TrashItem{
+    Ref: fmt.Sprintf("file://pageloop.com/%s/%s", app.Container.Name, app.Name),
+    Container: app.Container.Name,
+    Application: app.Name,
+    Directory: true,
+    User: user,
+    Path: app.Path,
+    Mountpoint: &mt}
+  return item, t.add(item, func(dest string) error {
+    if err := MoveFile(app.Path, dest); err != nil {
+      return err
+    }
+    // Published files are written again when the application is restored
+    os.RemoveAll(filepath.Join(dest, PUBLIC))
+    return nil
+  })
+}
+
+// Restore an item, the restore function is given the path to
+// the moved files and the item is removed when it returns nil.
+func (t *Trash) Restore(item *TrashItem, restore func(src string) error) error {
+  if err := restore(t.source(item)); err != nil {
+    return err
+  }
+  return t.remove(item)
+}
+
+// Delete an item permanently, when the identifier is empty
+// all items are deleted.
+func (t *Trash) Purge(id string) ([]*TrashItem, error) {
+  return t.purge(func(item *TrashItem, _ int64) bool {
+    return id == "" || item.Id == id
+  })
+}
+
+// Delete items older than the maximum age and the oldest items
+// while the total size exceeds the maximum size.
+//
+// The most recent item is never purged for size so that an item
+// larger than the maximum size can be restored until it expires.
+func (t *Trash) Expire() ([]*TrashItem, error) {
+  if t.MaxAge <= 0 && t.MaxSize <= 0 {
+    return nil, nil
+  }
+  now := time.Now()
+  newest := true
+  return t.purge(func(item *TrashItem, total int64) bool {
+    if t.MaxAge > 0 && now.Sub(item.Time) > t.MaxAge {
+      return true
+    }
+    keep := newest
+    newest = false
+    return !keep && t.MaxSize > 0 && total > t.MaxSize
+  })
+}
+
+// Private
+
+// Get the path to the moved files for an item.
+func (t *Trash) source(item *TrashItem) string {
+  return filepath.Join(t.Path, item.Id, trashSource)
+}
+
+// Create the item directory, move the files with the move function
+// and write the item metadata.
+func (t *Trash) add(item *TrashItem, move func(dest string) error) error {
+  item.Id = NewRequestId()
+  item.Time = time.Now().UTC()
+
+  dir := filepath.Join(t.Path, item.Id)
+  if err := os.MkdirAll(dir, os.ModeDir | 0755); err != nil {
+    return err
+  }
+  if err := move(filepath.Join(dir, trashSource)); err != nil {
+    os.RemoveAll(dir)
+    return err
+  }
+
+  item.Size = diskUsage(filepath.Join(dir, trashSource))
+  content, err := json.MarshalIndent(item, "", "  ")
+  if err != nil {
+    return err
+  }
+  if err := ioutil.WriteFile(filepath.Join(dir, trashItemFile), content, 0644); err != nil {
+    return err
+  }
+
+  t.mu.Lock()
+  t.items = append(t.items, item)
+  t.mu.Unlock()
+
+  if _, err := t.Expire(); err != nil {
+    Log.Warn("trash purge failed", Fields{"error": err})
+  }
+  return nil
+}
+
+// Remove the directory for an item and drop it from the list of items.
+func (t *Trash) remove(item *TrashItem) error {
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  for i, it := range t.items {
+    if it == item {
+      t.items = append(t.items[0:i], t.items[i+1:]...)
+      break
+    }
+  }
+  return os.RemoveAll(filepath.Join(t.Path, item.Id))
+}
+
+// Delete items matching a function, items are visited most recent
+// first and the function is given the total size of the items
+// visited including the item.
+func (t *Trash) purge(match func(item *TrashItem, total int64) bool) ([]*TrashItem, error) {
+  t.mu.Lock()
+  defer t.mu.Unlock()
+  var err error
+  var total int64
+  var kept []*TrashItem
+  var purged []*TrashItem
+  for i := len(t.items) - 1; i >= 0; i-- {
+    item := t.items[i]
+    total += item.Size
+    if match(item, total) {
+      if e := os.RemoveAll(filepath.Join(t.Path, item.Id)); e == nil {
+        purged = append(purged, item)
+        total -= item.Size
+        continue
+      } else if err == nil {
+        err = e
+      }
+    }
+    kept = append([]*TrashItem{item}, kept...)
+  }
+  t.items = kept
+  return purged, err
+}
+
+// Get the bytes used by the files below a path.
+func diskUsage(path string) int64 {
+  var size int64
+  filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+    if err == nil && !info.IsDir() {
+      size += info.Size()
+    }
+    return nil
+  })
+  return size
+}
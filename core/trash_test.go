@@ -0,0 +1,157 @@
+package core
+
+import (
+  "os"
+  "time"
+  "testing"
+  "io/ioutil"
+  "path/filepath"
+  . "github.com/tmpfs/pageloop/model"
+)
+
+func TestTrash(t *testing.T) {
+  app, dir := loadTestApp(t, "blog", nil)
+  defer os.RemoveAll(dir)
+
+  c := NewContainer("user", "")
+  if err := c.Add(app); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := app.Create("/docs/intro.txt", []byte("Intro")); err != nil {
+    t.Fatal(err)
+  }
+
+  trash := NewTrash(filepath.Join(dir, TrashDirName), 0, 0)
+  if err := trash.Load(); err != nil {
+    t.Fatal(err)
+  }
+
+  // Deleting moves the directory to the trash
+  item, err := trash.AddFile(app, app.Urls["/docs/"], "alice")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if app.Urls["/docs/"] != nil || app.Urls["/docs/intro.txt"] != nil {
+    t.Errorf("Expected files to be removed from the application")
+  }
+  if _, err := os.Stat(filepath.Join(app.PublicDirectory(), "docs")); !os.IsNotExist(err) {
+    t.Errorf("Expected published files to be deleted")
+  }
+  if item.Ref != "file://pageloop.com/user/blog#/docs/" || item.User != "alice" || item.Size != 5 {
+    t.Errorf("Unexpected item %#v", item)
+  }
+
+  // Items are read again from disc
+  loaded := NewTrash(trash.Path, 0, 0)
+  if err := loaded.Load(); err != nil {
+    t.Fatal(err)
+  }
+  if list := loaded.List(); len(list) != 1 || list[0].Id != item.Id || !list[0].Directory {
+    t.Fatalf("Unexpected items %v", list)
+  }
+
+  // Restoring puts the files back and publishes them
+  if err := trash.Restore(item, func(src string) error {
+    _, err := app.Restore(src, item.Url)
+    return err
+  }); err != nil {
+    t.Fatal(err)
+  }
+  if app.Urls["/docs/intro.txt"] == nil || len(trash.List()) != 0 {
+    t.Errorf("Expected file to be restored")
+  }
+  if _, err := os.Stat(filepath.Join(app.PublicDirectory(), "docs", "intro.txt")); err != nil {
+    t.Errorf("Expected restored file to be published: %s", err)
+  }
+  if _, err := os.Stat(filepath.Join(trash.Path, item.Id)); !os.IsNotExist(err) {
+    t.Errorf("Expected restored item to be removed from the trash")
+  }
+
+  // Oldest items are purged when the trash is too large
+  trash.MaxSize = 8
+  first, err := trash.AddFile(app, app.Urls["/docs/intro.txt"], "")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, err := app.Create("/notes.txt", []byte("Notes")); err != nil {
+    t.Fatal(err)
+  }
+  second, err := trash.AddFile(app, app.Urls["/notes.txt"], "")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if list := trash.List(); len(list) != 1 || list[0] != second || trash.Find(first.Id) != nil {
+    t.Errorf("Expected oldest item to be purged, got %v", list)
+  }
+
+  // An item larger than the maximum size is kept
+  if _, err := app.Create("/large.txt", []byte("Larger than the trash")); err != nil {
+    t.Fatal(err)
+  }
+  large, err := trash.AddFile(app, app.Urls["/large.txt"], "")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if list := trash.List(); len(list) != 1 || list[0] != large {
+    t.Errorf("Expected large item to be kept, got %v", list)
+  }
+  if _, err := trash.Expire(); err != nil || trash.Find(large.Id) == nil {
+    t.Errorf("Expected large item to be kept when expired")
+  }
+  if err := trash.Restore(large, func(src string) error {
+    _, err := app.Restore(src, large.Url)
+    return err
+  }); err != nil || app.Urls["/large.txt"] == nil {
+    t.Errorf("Expected large item to be restored: %v", err)
+  }
+
+  // Expired items are purged
+  second, err = trash.AddFile(app, app.Urls["/large.txt"], "")
+  if err != nil {
+    t.Fatal(err)
+  }
+  trash.MaxSize = 0
+  trash.MaxAge = time.Hour
+  second.Time = time.Now().Add(-2 * time.Hour)
+  if purged, err := trash.Expire(); err != nil || len(purged) != 1 || len(trash.List()) != 0 {
+    t.Errorf("Expected expired item to be purged, got %v %v", purged, err)
+  }
+}
+
+// Write files to the source directory of an application in a
+// temporary directory and load the application, the model package
+// tests use the same fixture.
+//
+// Returns the application and the temporary directory which the
+// caller must remove.
+func loadTestApp(t *testing.T, name string, files map[string]string) (*Application, string) {
+  dir, err := ioutil.TempDir("", "pageloop-" + name)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  path := filepath.Join(dir, name)
+  if err := os.MkdirAll(filepath.Join(path, SOURCE), 0755); err != nil {
+    os.RemoveAll(dir)
+    t.Fatal(err)
+  }
+  for file, content := range files {
+    pth := filepath.Join(path, SOURCE, filepath.FromSlash(file))
+    if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+      os.RemoveAll(dir)
+      t.Fatal(err)
+    }
+    if err := ioutil.WriteFile(pth, []byte(content), 0644); err != nil {
+      os.RemoveAll(dir)
+      t.Fatal(err)
+    }
+  }
+
+  app := NewApplication("/user/" + name + "/", "")
+  app.FileSystem = NewUrlFileSystem(app)
+  if err := app.Load(path); err != nil {
+    os.RemoveAll(dir)
+    t.Fatal(err)
+  }
+  return app, dir
+}
@@ -0,0 +1,188 @@
+package core
+
+import(
+  "fmt"
+  "strings"
+  "strconv"
+  "gopkg.in/yaml.v2"
+  "github.com/xeipuuv/gojsonschema"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+// Error returned when a configuration file does not match the schema.
+type ConfigError struct {
+  // Path to the configuration file.
+  Path string
+  // Validation errors.
+  Errors []ConfigFieldError
+}
+
+// A single validation error.
+type ConfigFieldError struct {
+  // Line number in the file, zero when the line is not known.
+  Line int
+  // Dot delimited path to the field.
+  Field string
+  // Description of the problem.
+  Message string
+}
+
+func (e *ConfigError) Error() string {
+  var lines []string
+  for _, f := range e.Errors {
+    if f.Line > 0 {
+      lines = append(lines, fmt.Sprintf("%s:%d: %s: %s", e.Path, f.Line, f.Field, f.Message))
+    } else {
+      lines = append(lines, fmt.Sprintf("%s: %s: %s", e.Path, f.Field, f.Message))
+    }
+  }
+  return "Invalid configuration\n" + strings.Join(lines, "\n")
+}
+
+// Validate YAML configuration content against the config schema.
+//
+// Syntax errors are returned as is, schema violations are returned
+// as a *ConfigError with line numbers resolved from the content.
+func ValidateConfig(path string, content []byte) error {
+  var doc interface{}
+  if err := yaml.Unmarshal(content, &doc); err != nil {
+    return fmt.Errorf("%s: %s", path, err.Error())
+  }
+
+  // Empty file
+  if doc == nil {
+    return nil
+  }
+
+  var err error
+  var result *gojsonschema.Result
+  schema := MustAsset("schema/config.json")
+  if result, err = (HttpUtil{}).ValidateInterface(schema, normalizeYaml(doc)); err != nil {
+    return err
+  }
+
+  if result.Valid() {
+    return nil
+  }
+
+  lines := strings.Split(string(content), "\n")
+  conf := &ConfigError{Path: path}
+  for _, e := range result.Errors() {
+    var field []string
+    if e.Field() != "(root)" {
+      field = strings.Split(e.Field(), ".")
+    }
+    // Point at the offending property rather than it's parent
+    if e.Type() == "additional_property_not_allowed" {
+      if name, ok := e.Details()["property"].(string); ok {
+        field = append(field, name)
+      }
+    }
+    conf.Errors = append(conf.Errors, ConfigFieldError{
+      Line: yamlLine(lines, field),
+      Field: e.Field(),
+      Message: e.Description()})
+  }
+  return conf
+}
+
+// Private
+
+// Convert the maps decoded by the YAML parser to maps with
+// string keys so the document can be encoded as JSON.
+func normalizeYaml(in interface{}) interface{} {
+  switch v := in.(type) {
+    case map[interface{}]interface{}:
+      out := make(map[string]interface{})
+      for key, value := range v {
+        out[fmt.Sprintf("%v", key)] = normalizeYaml(value)
+      }
+      return out
+    case []interface{}:
+      for i, value := range v {
+        v[i] = normalizeYaml(value)
+      }
+  }
+  return in
+}
+
+// Find the line number for a field path in block style YAML.
+//
+// Walks the lines tracking indentation, map keys match on the key name and
+// numeric path segments match the nth sequence item. Returns the line for
+// the deepest segment that could be found, zero if none was found.
+func yamlLine(lines []string, path []string) int {
+  var line int
+  // Line index to search from
+  start := 0
+  // Indentation of the parent node, -1 for the document root
+  parent := -1
+
+  for _, segment := range path {
+    found := -1
+    if index, err := strconv.Atoi(segment); err == nil {
+      item := -1
+      count := -1
+      for i := start; i < len(lines); i++ {
+        indent, text := yamlIndent(lines[i])
+        if text == "" || (i == start && line > 0) {
+          continue
+        }
+        isItem := text == "-" || strings.HasPrefix(text, "- ")
+        if indent < parent || (indent == parent && !isItem) || (item >= 0 && indent < item) {
+          break
+        }
+        if isItem && (item < 0 || indent == item) {
+          item = indent
+          count++
+          if count == index {
+            found = i
+            parent = indent
+            break
+          }
+        }
+      }
+    } else {
+      for i := start; i < len(lines); i++ {
+        indent, text := yamlIndent(lines[i])
+        if text == "" {
+          continue
+        }
+        // Keys on the same line as a sequence item
+        if strings.HasPrefix(text, "- ") {
+          trimmed := strings.TrimLeft(text[1:], " ")
+          indent += len(text) - len(trimmed)
+          text = trimmed
+        } else if i == start && line > 0 {
+          continue
+        }
+        if indent <= parent && !(i == start && line > 0) {
+          break
+        }
+        if strings.HasPrefix(text, segment + ":") {
+          found = i
+          parent = indent
+          break
+        }
+      }
+    }
+
+    if found < 0 {
+      break
+    }
+    line = found + 1
+    start = found
+  }
+  return line
+}
+
+// Get the indentation and content of a line, comment lines
+// are treated as blank.
+func yamlIndent(line string) (int, string) {
+  text := strings.TrimLeft(line, " ")
+  text = strings.TrimRight(text, " \t\r")
+  if strings.HasPrefix(text, "#") {
+    text = ""
+  }
+  return len(line) - len(strings.TrimLeft(line, " ")), text
+}
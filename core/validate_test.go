@@ -0,0 +1,40 @@
+package core
+
+import (
+  "strings"
+  "testing"
+)
+
+const testConfig = `addr: ":3577"
+# applications
+mountpoints:
+  -
+    url: /docs/
+    path: ./docs
+  - path: ./blog
+    template: yes
+    display: 10
+`
+
+func TestYamlLine(t *testing.T) {
+  lines := strings.Split(testConfig, "\n")
+  var tests = []struct {
+    field string
+    line int
+  }{
+    {"addr", 1},
+    {"mountpoints", 3},
+    {"mountpoints.0", 4},
+    {"mountpoints.0.path", 6},
+    {"mountpoints.1", 7},
+    {"mountpoints.1.path", 7},
+    {"mountpoints.1.display", 9},
+    {"mountpoints.2", 3},
+    {"unknown", 0}}
+
+  for _, test := range tests {
+    if line := yamlLine(lines, strings.Split(test.field, ".")); line != test.line {
+      t.Errorf("Expected line %d for %s, got %d", test.line, test.field, line)
+    }
+  }
+}
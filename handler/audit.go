@@ -0,0 +1,39 @@
+package handler
+
+import (
+  "net/http"
+  . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/service"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+// Write an audit record for a call to a mutating service method.
+//
+// The status is the status sent to the client when the call succeeded,
+// when err is not nil the status is taken from the error.
+func audit(method string, argv interface{}, status int, err error) {
+  if !Audit.Audited(method) {
+    return
+  }
+  record := &AuditRecord{ServiceMethod: method, Status: status}
+  if caller, ok := argv.(UserArgs); ok {
+    record.User = caller.UserName()
+  }
+  if target, ok := argv.(TargetArgs); ok {
+    record.Target = target.Target()
+  }
+  if err != nil {
+    record.Status = http.StatusInternalServerError
+    if ex, ok := err.(*StatusError); ok {
+      record.Status = ex.Status
+    }
+    record.Error = err.Error()
+  }
+  if err := Audit.Write(record); err != nil {
+    fields := Fields{"method": method, "error": err}
+    if traced, ok := argv.(TracedArgs); ok {
+      fields["request-id"] = traced.RequestId()
+    }
+    Log.Error("audit record failed", fields)
+  }
+}
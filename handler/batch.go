@@ -0,0 +1,386 @@
+package handler
+
+import (
+  "path"
+  "bytes"
+  "strings"
+  "reflect"
+	"net/http"
+  "encoding/json"
+  "github.com/gorilla/rpc/v2"
+  "github.com/gorilla/rpc/v2/json2"
+  . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/model"
+  . "github.com/tmpfs/pageloop/service"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+// A JSON-RPC 2.0 batch, either a batch array or an object with a
+// batch array so that options may be given:
+//
+//   {"atomic": true, "batch": [{"jsonrpc": "2.0", "id": 1, "method": "File.Save", ...}]}
+//
+// When atomic is set the file operations in the batch are rolled back
+// if any call fails.
+type RpcBatch struct {
+  Atomic bool `json:"atomic"`
+  Batch []json.RawMessage `json:"batch"`
+  // Set for single calls so they are not mistaken for a batch
+  Method string `json:"method"`
+}
+
+// Parse a websocket message as a batch, returns nil when the
+// message is a single call.
+func ParseBatch(p []byte) (*RpcBatch, error) {
+  p = bytes.TrimSpace(p)
+  batch := &RpcBatch{}
+  if len(p) > 0 && p[0] == '[' {
+    if err := json.Unmarshal(p, &batch.Batch); err != nil {
+      return nil, err
+    }
+    return batch, nil
+  }
+  if err := json.Unmarshal(p, batch); err != nil || batch.Method != "" || batch.Batch == nil {
+    return nil, nil
+  }
+  return batch, nil
+}
+
+// Handle a batch of calls.
+//
+// Responses are sent as a single array in the order of the calls,
+// notifications (calls without an id) do not have a response so nothing
+// is sent when every call is a notification.
+//
+// For atomic batches calls are not made after a failure, completed file
+// operations are rolled back and every call in the batch responds with
+// an error.
+func (w *WebsocketConnection) HandleBatch(messageType int, batch *RpcBatch) {
+  if len(batch.Batch) == 0 {
+    w.writeBatchError(messageType, json2.E_INVALID_REQ, CommandError(http.StatusBadRequest, "Empty batch"))
+    return
+  }
+
+  responses := make([][]byte, len(batch.Batch))
+  var undo []func() error
+  for i, p := range batch.Batch {
+    // Calls must be objects
+    if q := bytes.TrimSpace(p); len(q) == 0 || q[0] != '{' {
+      err := CommandError(http.StatusBadRequest, "Batch call %d is not an object", i)
+      responses[i] = batchError(json2.E_INVALID_REQ, err)
+      if batch.Atomic {
+        responses = w.abort(messageType, batch, responses, undo, i)
+        break
+      }
+      continue
+    }
+
+    var rollback func() error
+    out := &bytes.Buffer{}
+    err := w.call(messageType, p, codec2, out, func(method string, args interface{}) *StatusError {
+      if t := reflect.TypeOf(args); t.Kind() == reflect.Ptr && hasBinding(t.Elem(), BindWriter) {
+        return CommandError(http.StatusBadRequest, "Service %s cannot be called in a batch", method)
+      }
+      if batch.Atomic {
+        var ex *StatusError
+        rollback, ex = rollbackCall(w.Handler.Host, w.Handler.Trash, method, args)
+        return ex
+      }
+      return nil
+    })
+    responses[i] = out.Bytes()
+
+    // Failed calls are also reverted as they may be partially complete
+    if rollback != nil {
+      undo = append(undo, rollback)
+    }
+
+    if err != nil && batch.Atomic {
+      responses = w.abort(messageType, batch, responses, undo, i)
+      break
+    }
+  }
+
+  var list [][]byte
+  for _, r := range responses {
+    if r = bytes.TrimSpace(r); len(r) > 0 {
+      list = append(list, r)
+    }
+  }
+  if len(list) == 0 {
+    return
+  }
+  doc := append([]byte("["), bytes.Join(list, []byte(","))...)
+  doc = append(doc, ']')
+  if err := w.Conn.WriteMessage(messageType, doc); err != nil {
+    Log.Warn("websocket write failed", Fields{"request-id": w.message, "error": err})
+  }
+}
+
+// Private
+
+// Roll back an atomic batch after call i failed, the file operations
+// are undone in reverse order and every other call responds with an error.
+func (w *WebsocketConnection) abort(messageType int, batch *RpcBatch, responses [][]byte, undo []func() error, i int) [][]byte {
+  abort := CommandError(http.StatusFailedDependency, "Batch aborted, call %d failed", i)
+  w.Handler.Mountpoints.Lock()
+  for j := len(undo) - 1; j >= 0; j-- {
+    if e := undo[j](); e != nil {
+      Log.Error("batch rollback failed", Fields{"request-id": w.message, "error": e})
+      abort = CommandError(
+        http.StatusInternalServerError, "Batch aborted, call %d failed and rollback failed: %s", i, e.Error())
+    }
+  }
+  w.Handler.Mountpoints.Unlock()
+  for j, p := range batch.Batch {
+    if j != i {
+      responses[j] = w.reject(messageType, p, abort)
+    }
+  }
+  return responses
+}
+
+// Get the response for a call that is not made.
+func (w *WebsocketConnection) reject(messageType int, p []byte, err *StatusError) []byte {
+  if q := bytes.TrimSpace(p); len(q) == 0 || q[0] != '{' {
+    return batchError(json2.E_INVALID_REQ, err)
+  }
+  out := &bytes.Buffer{}
+  w.call(messageType, p, codec2, out, func(string, interface{}) *StatusError {
+    return err
+  })
+  return out.Bytes()
+}
+
+// Get the codec for a message, messages with a jsonrpc version
+// use JSON-RPC 2.0 otherwise JSON-RPC 1.0 is used.
+func messageCodec(p []byte) rpc.Codec {
+  var msg struct {
+    Version string `json:"jsonrpc"`
+  }
+  if json.Unmarshal(p, &msg) == nil && msg.Version != "" {
+    return codec2
+  }
+  return codec
+}
+
+// Get a JSON-RPC 2.0 error response without a call identifier.
+func batchError(code json2.ErrorCode, err *StatusError) []byte {
+  doc, _ := json.Marshal(map[string]interface{}{
+    "jsonrpc": json2.Version,
+    "id": nil,
+    "error": &json2.Error{Code: code, Message: err.Message, Data: err}})
+  return doc
+}
+
+// Send an error for a batch that could not be processed.
+func (w *WebsocketConnection) writeBatchError(messageType int, code json2.ErrorCode, err *StatusError) {
+  doc := batchError(code, err)
+  if e := w.Conn.WriteMessage(messageType, doc); e != nil {
+    Log.Warn("websocket write failed", Fields{"request-id": w.message, "error": e})
+  }
+}
+
+// Determine if a service method modifies state.
+func isMutation(method string) bool {
+  for _, m := range AuditedMethods {
+    if m == method {
+      return true
+    }
+  }
+  return false
+}
+
+// Lock the mountpoints for a service call and return the function
+// that releases the lock, calls that modify state are exclusive.
+func lockCall(mountpoints *MountpointManager, method string) func() {
+  if isMutation(method) {
+    mountpoints.Lock()
+    return mountpoints.Unlock
+  }
+  mountpoints.RLock()
+  return mountpoints.RUnlock
+}
+
+// Get a function that reverts a file operation for an atomic batch.
+//
+// Must be called before the service method so the current file state
+// can be captured. Methods that do not modify state do not need to be
+// reverted, other methods that modify state are not allowed.
+//
+// When the target cannot be found the service method will fail so
+// there is nothing to revert.
+func rollbackCall(host *Host, trash *Trash, method string, args interface{}) (func() error, *StatusError) {
+  switch req := args.(type) {
+    case *FileContentRequest:
+      if method == "File.Save" {
+        return rollbackSave(host, req.Ref), nil
+      }
+      return rollbackCreate(host, req.Ref), nil
+    case *FileTemplateRequest:
+      return rollbackCreate(host, req.Ref), nil
+    case *FileMoveRequest:
+      if method == "File.Copy" {
+        return rollbackCopy(host, req.Ref, req.Destination), nil
+      }
+      return rollbackMove(host, req.Ref), nil
+    case *FileDeleteRequest:
+      return rollbackDelete(host, trash, req.Ref, nil), nil
+    case *ApplicationBatchRequest:
+      if method == "Application.DeleteFiles" && req.Batch != nil {
+        return rollbackDelete(host, trash, req.Ref, *req.Batch), nil
+      }
+  }
+  if isMutation(method) {
+    return nil, CommandError(http.StatusBadRequest, "Service %s cannot be called in an atomic batch", method)
+  }
+  return nil, nil
+}
+
+// Restore the file content.
+func rollbackSave(host *Host, uri string) func() error {
+  ref := &AssetReference{}
+  ref.ParseUrl(uri)
+  _, app, file, err := ref.FindFile(host)
+  if err != nil {
+    return nil
+  }
+  content := append([]byte(nil), file.Source(true)...)
+  return func() error {
+    return app.Update(file, content)
+  }
+}
+
+// Delete the created file.
+func rollbackCreate(host *Host, uri string) func() error {
+  ref := &AssetReference{}
+  ref.ParseUrl(uri)
+  _, app, err := ref.FindApplication(host)
+  if err != nil {
+    return nil
+  }
+  url := ref.Url()
+  if app.Urls[url] != nil {
+    return nil
+  }
+  return func() error {
+    if file := app.Urls[url]; file != nil {
+      return app.Del(file)
+    }
+    return nil
+  }
+}
+
+// Delete the copy.
+func rollbackCopy(host *Host, uri string, dest string) func() error {
+  ref := &AssetReference{}
+  ref.ParseUrl(uri)
+  _, app, err := ref.FindApplication(host)
+  if err != nil {
+    return nil
+  }
+  url := path.Clean(SLASH + dest)
+  if app.Urls[url] != nil || app.Urls[url + SLASH] != nil {
+    return nil
+  }
+  return func() error {
+    if file := app.Urls[url]; file != nil {
+      return app.Del(file)
+    }
+    if file := app.Urls[url + SLASH]; file != nil {
+      return app.Del(file)
+    }
+    return nil
+  }
+}
+
+// Move the file back to it's original URL.
+func rollbackMove(host *Host, uri string) func() error {
+  ref := &AssetReference{}
+  ref.ParseUrl(uri)
+  _, app, file, err := ref.FindFile(host)
+  if err != nil {
+    return nil
+  }
+  url := file.Url
+  return func() error {
+    if file.Url == url {
+      return nil
+    }
+    return app.Move(file, url)
+  }
+}
+
+// Restore the deleted files from the trash or create them again
+// when the trash is disabled, when urls is nil the file in the
+// reference is deleted.
+func rollbackDelete(host *Host, trash *Trash, uri string, urls UrlList) func() error {
+  ref := &AssetReference{}
+  ref.ParseUrl(uri)
+  _, app, err := ref.FindApplication(host)
+  if err != nil {
+    return nil
+  }
+  if urls == nil {
+    urls = UrlList{ref.Url()}
+  }
+
+  type deleted struct {
+    url string
+    content []byte
+  }
+  var files []deleted
+  for _, url := range urls {
+    if file := app.Urls[url]; file != nil {
+      if file.Directory && url[len(url) - 1] != '/' {
+        url += "/"
+      }
+      files = append(files, deleted{url: url, content: append([]byte(nil), file.Source(true)...)})
+      // Files below a directory are deleted with the directory
+      for _, f := range file.Descendants() {
+        files = append(files, deleted{url: f.Url, content: append([]byte(nil), f.Source(true)...)})
+      }
+    }
+  }
+
+  // Items added to the trash by the call are not in this list
+  existing := make(map[string]bool)
+  if trash.Enabled() {
+    for _, item := range trash.List() {
+      existing[item.Id] = true
+    }
+  }
+  restore := func(url string) (bool, error) {
+    if !trash.Enabled() {
+      return false, nil
+    }
+    for _, item := range trash.List() {
+      if existing[item.Id] || item.IsApplication() || item.Container != app.Container.Name ||
+        item.Application != app.Name || strings.TrimSuffix(item.Url, "/") != strings.TrimSuffix(url, "/") {
+        continue
+      }
+      return true, trash.Restore(item, func(src string) error {
+        _, err := app.Restore(src, item.Url)
+        return err
+      })
+    }
+    return false, nil
+  }
+
+  return func() error {
+    for _, f := range files {
+      if app.Urls[strings.TrimSuffix(f.url, "/")] != nil || app.Urls[f.url] != nil {
+        continue
+      }
+      if restored, err := restore(f.url); err != nil {
+        return err
+      } else if restored {
+        continue
+      }
+      if _, err := app.Create(f.url, f.content); err != nil {
+        return err
+      }
+    }
+    return nil
+  }
+}
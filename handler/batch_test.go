@@ -0,0 +1,188 @@
+package handler
+
+import (
+  "os"
+  "strings"
+  "testing"
+  "io/ioutil"
+  "path/filepath"
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "github.com/gorilla/websocket"
+  . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/model"
+  . "github.com/tmpfs/pageloop/rpc"
+  . "github.com/tmpfs/pageloop/service"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+func TestParseBatch(t *testing.T) {
+  if batch, err := ParseBatch([]byte(`{"id": 1, "method": "Host.List", "params": [{}]}`)); err != nil || batch != nil {
+    t.Errorf("Single call parsed as batch")
+  }
+
+  batch, err := ParseBatch([]byte(` [{"id": 1, "method": "Host.List"}, {"method": "Host.List"}]`))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if batch == nil || len(batch.Batch) != 2 || batch.Atomic {
+    t.Errorf("Unexpected batch %#v", batch)
+  }
+
+  batch, err = ParseBatch([]byte(`{"atomic": true, "batch": [{"id": 1, "method": "File.Save"}]}`))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if batch == nil || len(batch.Batch) != 1 || !batch.Atomic {
+    t.Errorf("Unexpected atomic batch %#v", batch)
+  }
+
+  if _, err = ParseBatch([]byte(`[{"id": 1}`)); err == nil {
+    t.Errorf("Expected error for malformed batch")
+  }
+}
+
+func TestRollbackCall(t *testing.T) {
+  if _, err := rollbackCall(nil, nil, "Application.Delete", nil); err == nil {
+    t.Errorf("Expected error for method that cannot be rolled back")
+  }
+  if fn, err := rollbackCall(nil, nil, "Host.List", nil); err != nil || fn != nil {
+    t.Errorf("Unexpected rollback for read only method")
+  }
+}
+
+func TestAtomicBatchRollback(t *testing.T) {
+  dir, err := ioutil.TempDir("", "pageloop-batch")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  path := filepath.Join(dir, "blog")
+  if err := os.MkdirAll(filepath.Join(path, SOURCE), 0755); err != nil {
+    t.Fatal(err)
+  }
+  files := map[string]string{"a.txt": "alpha", "b.txt": "beta"}
+  for name, content := range files {
+    if err := ioutil.WriteFile(filepath.Join(path, SOURCE, name), []byte(content), 0644); err != nil {
+      t.Fatal(err)
+    }
+  }
+  host := NewHost()
+  container := NewContainer("user", "")
+  host.Add(container)
+  app := NewApplication("/user/blog/", "")
+  app.FileSystem = NewUrlFileSystem(app)
+  if err := app.Load(path); err != nil {
+    t.Fatal(err)
+  }
+  if err := container.Add(app); err != nil {
+    t.Fatal(err)
+  }
+
+  trash := NewTrash(filepath.Join(dir, "trash"), 0, 0)
+  if err := trash.Load(); err != nil {
+    t.Fatal(err)
+  }
+  services := &ServiceMap{}
+  services.MustRegister(&FileService{Host: host, Trash: trash}, "File")
+  server := httptest.NewServer(WebsocketHandler{
+    Services: services,
+    Host: host,
+    Mountpoints: NewMountpointManager(&ServerConfig{}, host),
+    Trash: trash})
+  defer server.Close()
+
+  conn, _, err := websocket.DefaultDialer.Dial("ws" + strings.TrimPrefix(server.URL, "http"), nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer conn.Close()
+
+  // The move fails so the save and delete are reverted
+  batch := `{"atomic": true, "batch": [
+    {"jsonrpc": "2.0", "id": 1, "method": "File.Save", "params": {"ref": "file://pageloop.com/user/blog#/a.txt", "value": "changed"}},
+    {"jsonrpc": "2.0", "id": 2, "method": "File.Delete", "params": {"ref": "file://pageloop.com/user/blog#/b.txt"}},
+    {"jsonrpc": "2.0", "id": 3, "method": "File.Move", "params": {"ref": "file://pageloop.com/user/blog#/missing.txt", "destination": "/c.txt"}}]}`
+  var responses []rpcResponse
+  sendMessage(t, conn, batch, &responses)
+  if len(responses) != 3 {
+    t.Fatalf("Expected a response for each call, got %v", responses)
+  }
+  for i, res := range responses {
+    if res.Version != "2.0" || res.Id == nil || *res.Id != i + 1 || res.Error == nil || res.Error.Data == nil || res.Result != nil {
+      t.Errorf("Expected error response for call %d, got %#v", i + 1, res)
+    }
+  }
+  if responses[2].Error.Data.Status != http.StatusNotFound || responses[0].Error.Data.Status != http.StatusFailedDependency {
+    t.Errorf("Unexpected error status %v %v", responses[0].Error.Data, responses[2].Error.Data)
+  }
+
+  if file := app.Urls["/a.txt"]; file == nil || string(file.Source(true)) != "alpha" {
+    t.Errorf("Expected saved file to be reverted")
+  }
+  if content, err := ioutil.ReadFile(filepath.Join(path, SOURCE, "a.txt")); err != nil || string(content) != "alpha" {
+    t.Errorf("Expected saved file content to be reverted, got %q", content)
+  }
+  if file := app.Urls["/b.txt"]; file == nil || string(file.Source(true)) != "beta" {
+    t.Errorf("Expected deleted file to be restored")
+  }
+  if items := trash.List(); len(items) != 0 {
+    t.Errorf("Expected deleted file to be restored from the trash, got %d items", len(items))
+  }
+
+  // Notifications do not have a response
+  responses = nil
+  sendMessage(t, conn, `[
+    {"jsonrpc": "2.0", "id": 4, "method": "File.Read", "params": {"ref": "file://pageloop.com/user/blog#/a.txt"}},
+    {"jsonrpc": "2.0", "method": "File.Read", "params": {"ref": "file://pageloop.com/user/blog#/b.txt"}}]`, &responses)
+  if len(responses) != 1 || *responses[0].Id != 4 || responses[0].Error != nil || responses[0].Result == nil {
+    t.Errorf("Expected a single response, got %v", responses)
+  }
+
+  // Batches must contain JSON-RPC 2.0 calls
+  responses = nil
+  sendMessage(t, conn, `[{"id": 5, "method": "File.Read", "params": [{"ref": "file://pageloop.com/user/blog#/a.txt"}]}, 1]`, &responses)
+  if len(responses) != 2 || responses[0].Error == nil || responses[1].Id != nil || responses[1].Error.Code != -32600 {
+    t.Errorf("Expected invalid request errors, got %v", responses)
+  }
+
+  // Single calls without a version use JSON-RPC 1.0
+  var single map[string]json.RawMessage
+  sendMessage(t, conn, `{"id": 6, "method": "File.Read", "params": [{"ref": "file://pageloop.com/user/blog#/a.txt"}]}`, &single)
+  if _, ok := single["jsonrpc"]; ok || string(single["error"]) != "null" || !strings.Contains(string(single["result"]), `"status":200`) {
+    t.Errorf("Expected JSON-RPC 1.0 response, got %v", single)
+  }
+
+  var res rpcResponse
+  sendMessage(t, conn, `[]`, &res)
+  if res.Error == nil || res.Error.Code != -32600 {
+    t.Errorf("Expected invalid request for empty batch, got %v", res)
+  }
+}
+
+// JSON-RPC 2.0 response.
+type rpcResponse struct {
+  Version string `json:"jsonrpc"`
+  Id *int `json:"id"`
+  Result json.RawMessage `json:"result"`
+  Error *struct {
+    Code int `json:"code"`
+    Data *StatusError `json:"data"`
+  } `json:"error"`
+}
+
+// Send a message and decode the response.
+func sendMessage(t *testing.T, conn *websocket.Conn, message string, v interface{}) {
+  if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+    t.Fatal(err)
+  }
+  _, p, err := conn.ReadMessage()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err := json.Unmarshal(p, v); err != nil {
+    t.Fatalf("Unexpected response %s", p)
+  }
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+  "fmt"
+  "reflect"
+  "strconv"
+  "net/http"
+  "encoding/json"
+  "github.com/gorilla/rpc/v2"
+  . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/service"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+var(
+  bytesType = reflect.TypeOf([]byte{})
+)
+
+// Assign REST request data to service method arguments.
+//
+// Fields without a bind tag are decoded from a JSON request body, then
+// each tagged field is assigned from it's source. See the Bind constants
+// in the service package for the available sources.
+func BindRequest(argv interface{}, route *Route, req *http.Request, res http.ResponseWriter) *StatusError {
+  v := reflect.ValueOf(argv)
+  if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+    return nil
+  }
+  v = v.Elem()
+  t := v.Type()
+
+  var body []byte
+  var err error
+  if req.Body != nil {
+    if body, err = utils.ReadBody(req); err != nil {
+      return CommandError(http.StatusInternalServerError, err.Error())
+    }
+  }
+
+  // Body is decoded to the arguments unless a field is bound to the body
+  if len(body) > 0 && !hasBinding(t, BindBody) {
+    if err = json.Unmarshal(body, argv); err != nil {
+      return CommandError(http.StatusBadRequest, err.Error())
+    }
+  }
+
+  params := route.Parameters
+  query := req.URL.Query()
+  for i := 0; i < t.NumField(); i++ {
+    field := t.Field(i)
+    source, name := BindTag(field)
+    target := v.Field(i)
+    var value string
+    switch source {
+      case "":
+        continue
+      case BindPath:
+        value = pathParameter(params, name)
+      case BindRef:
+        value = fmt.Sprintf("file://pageloop.com/%s/%s", params.Context, params.Target)
+        if name == "file" {
+          value += "#" + params.Item
+        }
+      case BindQuery:
+        if value = query.Get(name); value == "" {
+          continue
+        }
+      case BindHeader:
+        value = req.Header.Get(name)
+      case BindBody:
+        if field.Type == bytesType {
+          target.SetBytes(body)
+          continue
+        }
+        // Allocate so the field is never nil
+        if field.Type.Kind() == reflect.Ptr {
+          target.Set(reflect.New(field.Type.Elem()))
+        }
+        if len(body) > 0 {
+          if err = json.Unmarshal(body, target.Addr().Interface()); err != nil {
+            return CommandError(http.StatusBadRequest, err.Error())
+          }
+        }
+        continue
+      case BindWriter:
+        bindWriter(target, res)
+        continue
+      default:
+        return CommandError(
+          http.StatusInternalServerError, "Unknown bind source %s for field %s", source, field.Name)
+    }
+
+    if err = setString(target, value); err != nil {
+      return CommandError(http.StatusBadRequest, "Invalid %s %s: %s", source, name, err.Error())
+    }
+  }
+  return nil
+}
+
+// Assign websocket JSON-RPC params to service method arguments.
+//
+// Params are decoded to the arguments and fields bound to the
+// writer are assigned the response writer.
+func BindMessage(argv interface{}, req rpc.CodecRequest, writer http.ResponseWriter) error {
+  if err := req.ReadRequest(argv); err != nil {
+    return err
+  }
+  v := reflect.ValueOf(argv)
+  if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+    return nil
+  }
+  v = v.Elem()
+  for i := 0; i < v.NumField(); i++ {
+    if source, _ := BindTag(v.Type().Field(i)); source == BindWriter {
+      bindWriter(v.Field(i), writer)
+    }
+  }
+  return nil
+}
+
+// Private
+
+// Determine if a struct has a field bound to source.
+func hasBinding(t reflect.Type, source string) bool {
+  for i := 0; i < t.NumField(); i++ {
+    if s, _ := BindTag(t.Field(i)); s == source {
+      return true
+    }
+  }
+  return false
+}
+
+// Get a route path parameter by name.
+func pathParameter(params *Parameters, name string) string {
+  switch name {
+    case "context":
+      return params.Context
+    case "target":
+      return params.Target
+    case "filter":
+      return params.Filter
+    case "item":
+      return params.Item
+  }
+  return ""
+}
+
+// Assign the response writer when the field type allows it.
+func bindWriter(target reflect.Value, writer http.ResponseWriter) {
+  w := reflect.ValueOf(writer)
+  if writer != nil && w.Type().AssignableTo(target.Type()) {
+    target.Set(w)
+  }
+}
+
+// Assign a string value to a string, integer or boolean field.
+func setString(target reflect.Value, value string) error {
+  switch target.Kind() {
+    case reflect.String:
+      target.SetString(value)
+    case reflect.Int, reflect.Int64:
+      if value == "" {
+        return nil
+      }
+      n, err := strconv.ParseInt(value, 10, 64)
+      if err != nil {
+        return err
+      }
+      target.SetInt(n)
+    case reflect.Bool:
+      if value == "" {
+        return nil
+      }
+      b, err := strconv.ParseBool(value)
+      if err != nil {
+        return err
+      }
+      target.SetBool(b)
+    default:
+      return fmt.Errorf("cannot assign to %s", target.Type())
+  }
+  return nil
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+  "strings"
+  "testing"
+  "net/http"
+  "net/http/httptest"
+  . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/service"
+)
+
+type bindArgs struct {
+  Ref string `json:"ref" bind:"ref:file"`
+  Destination string `json:"destination" bind:"header:Location"`
+  Limit int `json:"limit" bind:"query:limit"`
+  Value string `json:"value"`
+}
+
+func TestBindRequest(t *testing.T) {
+  req := httptest.NewRequest(
+    http.MethodPost, "/apps/user/blog/files/index.md?limit=10", strings.NewReader(`{"value": "content"}`))
+  req.Header.Set("Location", "/about.md")
+  route := &Route{Parameters: &Parameters{}}
+  route.Parameters.Parse("/apps/user/blog/files/index.md")
+
+  argv := &bindArgs{}
+  if err := BindRequest(argv, route, req, httptest.NewRecorder()); err != nil {
+    t.Fatal(err)
+  }
+  if argv.Ref != "file://pageloop.com/user/blog#/index.md" {
+    t.Errorf("Unexpected reference %s", argv.Ref)
+  }
+  if argv.Destination != "/about.md" || argv.Limit != 10 || argv.Value != "content" {
+    t.Errorf("Unexpected arguments %#v", argv)
+  }
+
+  // Raw body and writer
+  req = httptest.NewRequest(http.MethodGet, "/apps/user/blog/zip/source", nil)
+  route.Parameters.Parse("/apps/user/blog/zip/source")
+  res := httptest.NewRecorder()
+  archive := &ArchiveRequest{}
+  if err := BindRequest(archive, route, req, res); err != nil {
+    t.Fatal(err)
+  }
+  if archive.Filter != "/source" || archive.Writer != res || archive.Ref != "file://pageloop.com/user/blog" {
+    t.Errorf("Unexpected archive arguments %#v", archive)
+  }
+
+  req = httptest.NewRequest(http.MethodGet, "/audit?limit=ten", nil)
+  route.Parameters.Parse("/audit")
+  if err := BindRequest(&AuditRequest{}, route, req, res); err == nil || err.Status != http.StatusBadRequest {
+    t.Errorf("Expected bad request for invalid integer, got %v", err)
+  }
+}
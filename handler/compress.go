@@ -0,0 +1,196 @@
+package handler
+
+import (
+  "os"
+  "fmt"
+  "net"
+  "mime"
+  "path"
+  "sync"
+  "bufio"
+  "strings"
+  "strconv"
+  "net/http"
+  "compress/gzip"
+  "path/filepath"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+var(
+  gzipWriters = sync.Pool{New: func() interface{} {
+    return gzip.NewWriter(nil)
+  }}
+
+  // Precompressed file extensions by content encoding in order of preference.
+  precompressed = []struct {
+    encoding string
+    ext string
+  }{
+    {"br", BrotliExt},
+    {"gzip", GzipExt},
+  }
+)
+
+// Compresses the response body with gzip when the content type
+// is compressible and the body is not already encoded.
+//
+// When the header is written without a Content-Type it is detected
+// from the first write. Close must be called to flush the compressed data.
+type compressWriter struct {
+  http.ResponseWriter
+  gz *gzip.Writer
+  // Status waiting for the body to detect the content type
+  status int
+  wroteHeader bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+  if w.wroteHeader || w.status != 0 {
+    return
+  }
+  if w.Header().Get("Content-Type") == "" && bodyAllowed(status) {
+    w.status = status
+    return
+  }
+  w.writeHeader(status)
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+  if !w.wroteHeader {
+    status := w.status
+    if status == 0 {
+      status = http.StatusOK
+    }
+    if w.Header().Get("Content-Type") == "" {
+      w.Header().Set("Content-Type", http.DetectContentType(p))
+    }
+    w.writeHeader(status)
+  }
+  if w.gz != nil {
+    return w.gz.Write(p)
+  }
+  return w.ResponseWriter.Write(p)
+}
+
+func (w *compressWriter) Flush() {
+  if w.gz != nil {
+    w.gz.Flush()
+  }
+  if f, ok := w.ResponseWriter.(http.Flusher); ok {
+    f.Flush()
+  }
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+  hj, ok := w.ResponseWriter.(http.Hijacker)
+  if !ok {
+    return nil, nil, fmt.Errorf("webserver doesn't support hijacking")
+  }
+  return hj.Hijack()
+}
+
+// Flush compressed data and release the gzip writer.
+func (w *compressWriter) Close() error {
+  // Header was deferred but no body was written
+  if !w.wroteHeader && w.status != 0 {
+    w.writeHeader(w.status)
+  }
+  if w.gz == nil {
+    return nil
+  }
+  err := w.gz.Close()
+  gzipWriters.Put(w.gz)
+  w.gz = nil
+  return err
+}
+
+func (w *compressWriter) writeHeader(status int) {
+  w.wroteHeader = true
+  h := w.Header()
+  if w.compress(status) {
+    h.Del("Content-Length")
+    h.Set("Content-Encoding", "gzip")
+    h.Add("Vary", "Accept-Encoding")
+    weakenETag(h)
+    w.gz = gzipWriters.Get().(*gzip.Writer)
+    w.gz.Reset(w.ResponseWriter)
+  } else if status == http.StatusNotModified {
+    // Match the tag sent with the compressed response
+    weakenETag(h)
+  }
+  w.ResponseWriter.WriteHeader(status)
+}
+
+// Determine if a response should be compressed.
+func (w *compressWriter) compress(status int) bool {
+  h := w.Header()
+  switch {
+    case !bodyAllowed(status), status == http.StatusPartialContent:
+      return false
+    case h.Get("Content-Encoding") != "", h.Get("Content-Range") != "":
+      return false
+    case !Compressible(h.Get("Content-Type")):
+      return false
+  }
+  if length := h.Get("Content-Length"); length != "" {
+    if n, err := strconv.Atoi(length); err == nil && n < CompressMinSize {
+      return false
+    }
+  }
+  return true
+}
+
+// Determine if a response with a status may have a body.
+func bodyAllowed(status int) bool {
+  return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// The entity tag identifies the uncompressed content so a
+// compressed response uses a weak tag.
+func weakenETag(h http.Header) {
+  if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+    h.Set("ETag", "W/" + etag)
+  }
+}
+
+// Serve a precompressed copy of a published file when the client accepts
+// the encoding, returns false when the file should be served normally.
+func servePrecompressed(res http.ResponseWriter, req *http.Request, dir string, urlPath string) bool {
+  if req.Method != http.MethodGet && req.Method != http.MethodHead {
+    return false
+  }
+  // Ranges apply to the uncompressed file
+  if req.Header.Get("Range") != "" {
+    return false
+  }
+
+  name := path.Clean("/" + urlPath)
+  if strings.HasSuffix(urlPath, "/") {
+    name = path.Join(name, "index.html")
+  }
+  contentType := mime.TypeByExtension(path.Ext(name))
+  if !Compressible(contentType) {
+    return false
+  }
+
+  for _, p := range precompressed {
+    if !AcceptsEncoding(req, p.encoding) {
+      continue
+    }
+    f, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)) + p.ext)
+    if err != nil {
+      continue
+    }
+    defer f.Close()
+    info, err := f.Stat()
+    if err != nil || info.IsDir() {
+      continue
+    }
+    res.Header().Set("Content-Type", contentType)
+    res.Header().Set("Content-Encoding", p.encoding)
+    res.Header().Add("Vary", "Accept-Encoding")
+    http.ServeContent(res, req, name, info.ModTime(), f)
+    return true
+  }
+  return false
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+  "os"
+  "bytes"
+  "strings"
+  "testing"
+  "net/http"
+  "io/ioutil"
+  "compress/gzip"
+  "path/filepath"
+  "net/http/httptest"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+func gunzip(t *testing.T, content []byte) string {
+  r, err := gzip.NewReader(bytes.NewReader(content))
+  if err != nil {
+    t.Fatal(err)
+  }
+  out, err := ioutil.ReadAll(r)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return string(out)
+}
+
+func TestCompressWriter(t *testing.T) {
+  doc := `{"files": "` + strings.Repeat("index.md ", 200) + `"}`
+
+  rec := httptest.NewRecorder()
+  w := &compressWriter{ResponseWriter: rec}
+  w.Header().Set("Content-Type", JSON_MIME)
+  w.Header().Set("ETag", `"abc"`)
+  w.WriteHeader(http.StatusOK)
+  w.Write([]byte(doc))
+  w.Close()
+
+  if rec.Header().Get("Content-Encoding") != "gzip" {
+    t.Fatalf("Expected gzip encoding")
+  }
+  if rec.Header().Get("ETag") != `W/"abc"` {
+    t.Errorf("Expected weak ETag, got %s", rec.Header().Get("ETag"))
+  }
+  if out := gunzip(t, rec.Body.Bytes()); out != doc {
+    t.Errorf("Unexpected body %s", out)
+  }
+
+  // Content type is detected when the header is written first
+  rec = httptest.NewRecorder()
+  w = &compressWriter{ResponseWriter: rec}
+  w.WriteHeader(http.StatusOK)
+  w.Write([]byte(strings.Repeat("# Title\n", 200)))
+  w.Close()
+  if rec.Header().Get("Content-Encoding") != "gzip" {
+    t.Errorf("Expected detected text content to be compressed")
+  }
+
+  // Small and binary responses are sent unchanged
+  for _, test := range []struct{ contentType string; body string }{
+    {JSON_MIME, `{"ok": true}`},
+    {"image/png", strings.Repeat("x", 2048)},
+  } {
+    rec = httptest.NewRecorder()
+    w = &compressWriter{ResponseWriter: rec}
+    w.Header().Set("Content-Type", test.contentType)
+    w.Header().Set("Content-Length", "2048")
+    if test.contentType == JSON_MIME {
+      w.Header().Set("Content-Length", "12")
+    }
+    w.Write([]byte(test.body))
+    w.Close()
+    if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != test.body {
+      t.Errorf("Expected %s response to be uncompressed", test.contentType)
+    }
+  }
+}
+
+func TestServePrecompressed(t *testing.T) {
+  dir, err := ioutil.TempDir("", "pageloop-compress")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  page := strings.Repeat("<p>Content</p>", 200)
+  if err := ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte(page), 0644); err != nil {
+    t.Fatal(err)
+  }
+  if err := WriteGzip(filepath.Join(dir, "index.html") + GzipExt, []byte(page), 0644); err != nil {
+    t.Fatal(err)
+  }
+
+  req := httptest.NewRequest(http.MethodGet, "/", nil)
+  req.Header.Set("Accept-Encoding", "gzip, deflate")
+  rec := httptest.NewRecorder()
+  if !servePrecompressed(rec, req, dir, "/") {
+    t.Fatalf("Expected precompressed file to be served")
+  }
+  if rec.Header().Get("Content-Encoding") != "gzip" || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+    t.Errorf("Unexpected headers %v", rec.Header())
+  }
+  if out := gunzip(t, rec.Body.Bytes()); out != page {
+    t.Errorf("Unexpected body %s", out)
+  }
+
+  // Not accepted by the client
+  req.Header.Set("Accept-Encoding", "gzip;q=0, *")
+  if servePrecompressed(httptest.NewRecorder(), req, dir, "/index.html") {
+    t.Errorf("Expected gzip with zero quality to be refused")
+  }
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+  "time"
+  "strconv"
+  "net/http"
+  . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+// Content type for the Prometheus text exposition format.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Serves the metrics registry in the Prometheus text format.
+type MetricsHandler struct {}
+
+// Configure the metrics endpoint.
+func MetricsService(mux *http.ServeMux) http.Handler {
+  handler := MetricsHandler{}
+  mux.Handle(METRICS_URL, handler)
+  return handler
+}
+
+func (h MetricsHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  if req.Method != http.MethodGet && req.Method != http.MethodHead {
+    res.Header().Set("Allow", "GET, HEAD")
+    http.Error(res, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+    return
+  }
+  res.Header().Set("Content-Type", metricsContentType)
+  if req.Method == http.MethodHead {
+    return
+  }
+  if err := Metrics.Write(res); err != nil {
+    Log.Warn("metrics write failed", Fields{"request-id": ContextRequestId(req.Context()), "error": err})
+  }
+}
+
+// Records the status code and matched route for a REST request.
+type routeWriter struct {
+  http.ResponseWriter
+  status int
+  route *Route
+}
+
+func (w *routeWriter) WriteHeader(status int) {
+  w.status = status
+  w.ResponseWriter.WriteHeader(status)
+}
+
+// Record a service method call for a transport.
+func observeCall(method string, transport string, start time.Time, err error) {
+  RpcCalls.Add(1, method, transport)
+  RpcLatency.Since(start, method)
+  if err != nil {
+    status := http.StatusInternalServerError
+    if ex, ok := err.(*StatusError); ok {
+      status = ex.Status
+    }
+    RpcErrors.Add(1, method, strconv.Itoa(status))
+  }
+}
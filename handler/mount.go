@@ -1,11 +1,29 @@
 package handler
 
 import(
-  "log"
   "net/http"
+  . "github.com/tmpfs/pageloop/core"
   . "github.com/tmpfs/pageloop/model"
+  . "github.com/tmpfs/pageloop/rpc"
+  . "github.com/tmpfs/pageloop/service"
+  . "github.com/tmpfs/pageloop/util"
 )
 
+// Mount the application created by a service call, needs to be
+// done here due to package cyclic references.
+func mountCreated(mountpoints *MountpointManager, host *Host, method string, reply *Response) {
+  if method != "Container.CreateApp" {
+    return
+  }
+  result := reply.Reply
+  if r, ok := result.(*ServiceReply); ok {
+    result = r.Reply
+  }
+  if app, ok := result.(*Application); ok {
+    MountApplication(mountpoints.MountpointMap, host, app)
+  }
+}
+
 // Mount an application such that it's published and source
 // files are accessible over HTTP. This serves the published files
 // as static files and serves two versions of the source file
@@ -16,7 +34,7 @@ func MountApplication(mountpoints map[string]http.Handler, host *Host, app *Appl
 
 	// Serve the static build files from the mountpoint path.
 	url := app.PublishUrl()
-	log.Printf("Serving app %s from %s", url, app.PublicDirectory())
+	Log.Info("serving app", Fields{"url": url, "path": app.PublicDirectory()})
   fileserver := http.FileServer(http.Dir(app.PublicDirectory()))
   mountpoints[url] = http.StripPrefix(url, PublicHandler{Listing: listing, App: app, FileServer: fileserver})
 }
@@ -0,0 +1,110 @@
+package handler
+
+import (
+  "net"
+  "time"
+  "bufio"
+  "strings"
+  "net/http"
+  "net/http/httputil"
+  . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+// Proxies requests for a mountpoint URL to an upstream server.
+//
+// The mountpoint URL is replaced by the upstream path, the Host header
+// is set to the upstream host and the original host is sent in the
+// X-Forwarded-Host header. Redirects to the upstream are rewritten to
+// the mountpoint URL and the upstream allowed origin header is removed.
+// Websocket connections are passed through.
+type ProxyHandler struct {
+  Mountpoint Mountpoint
+  proxy *httputil.ReverseProxy
+}
+
+// Create a handler for a proxy mountpoint.
+func NewProxyHandler(mt Mountpoint) (http.Handler, error) {
+  upstream, err := mt.Upstream()
+  if err != nil {
+    return nil, err
+  }
+  prefix := strings.TrimSuffix(mt.Url, SLASH) + SLASH
+  base := strings.TrimSuffix(upstream.Path, SLASH) + SLASH
+  origin := upstream.Scheme + "://" + upstream.Host
+
+  director := func(req *http.Request) {
+    host := req.Host
+    req.URL.Scheme = upstream.Scheme
+    req.URL.Host = upstream.Host
+    req.URL.Path = base + strings.TrimPrefix(req.URL.Path, prefix)
+    req.URL.RawPath = ""
+    req.Host = upstream.Host
+
+    proto := "http"
+    if req.TLS != nil {
+      proto = "https"
+    }
+    req.Header.Set("X-Forwarded-Host", host)
+    req.Header.Set("X-Forwarded-Proto", proto)
+    req.Header.Set("X-Forwarded-Prefix", prefix)
+    if id := ContextRequestId(req.Context()); id != "" {
+      req.Header.Set(RequestIdHeader, id)
+    }
+    for k, v := range mt.ProxyHeaders {
+      if v == "" {
+        req.Header.Del(k)
+      } else {
+        req.Header.Set(k, v)
+      }
+    }
+  }
+
+  // Keep redirects from the upstream on this server, the server
+  // sets the allowed origin so the upstream header is not repeated
+  modify := func(res *http.Response) error {
+    res.Header.Del("Access-Control-Allow-Origin")
+    if location := res.Header.Get("Location"); location != "" {
+      location = strings.TrimPrefix(location, origin)
+      if strings.HasPrefix(location, base) && !strings.HasPrefix(location, "//") {
+        res.Header.Set("Location", prefix + strings.TrimPrefix(location, base))
+      }
+    }
+    return nil
+  }
+
+  failed := func(res http.ResponseWriter, req *http.Request, err error) {
+    Log.Warn("proxy failed", Fields{
+      "request-id": ContextRequestId(req.Context()), "proxy": mt.Proxy, "error": err})
+    res.WriteHeader(http.StatusBadGateway)
+  }
+
+  h := &ProxyHandler{Mountpoint: mt}
+  h.proxy = &httputil.ReverseProxy{Director: director, ModifyResponse: modify, ErrorHandler: failed}
+  return h, nil
+}
+
+func (h *ProxyHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  if req.Header.Get("Upgrade") != "" {
+    res = &upgradeWriter{ResponseWriter: res}
+  }
+  h.proxy.ServeHTTP(res, req)
+}
+
+// Clears the deadlines assigned by the server when the connection
+// is hijacked so upgraded connections outlive the server timeouts.
+type upgradeWriter struct {
+  http.ResponseWriter
+}
+
+func (w *upgradeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+  hj, ok := w.ResponseWriter.(http.Hijacker)
+  if !ok {
+    return nil, nil, http.ErrNotSupported
+  }
+  conn, rw, err := hj.Hijack()
+  if err == nil {
+    conn.SetDeadline(time.Time{})
+  }
+  return conn, rw, err
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+  "testing"
+  "net/http"
+  "net/http/httptest"
+  . "github.com/tmpfs/pageloop/core"
+)
+
+func TestProxyHandler(t *testing.T) {
+  upstream := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+    res.Header().Set("X-Path", req.URL.Path)
+    res.Header().Set("X-Host", req.Header.Get("X-Forwarded-Host"))
+    res.Header().Set("X-Token", req.Header.Get("Authorization"))
+    res.Header().Set("Access-Control-Allow-Origin", "http://example.com")
+    if req.URL.Path == "/v1/login" {
+      http.Redirect(res, req, "http://" + req.Host + "/v1/home", http.StatusFound)
+    }
+  }))
+  defer upstream.Close()
+
+  handler, err := NewProxyHandler(Mountpoint{
+    Url: "/blog/api",
+    Proxy: upstream.URL + "/v1/",
+    ProxyHeaders: map[string]string{"Authorization": "Bearer dev", "Cookie": ""}})
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  req := httptest.NewRequest(http.MethodGet, "http://localhost:3577/blog/api/posts?page=2", nil)
+  req.Header.Set("Cookie", "session=1")
+  rec := httptest.NewRecorder()
+  rec.Header().Set("Access-Control-Allow-Origin", "*")
+  handler.ServeHTTP(rec, req)
+  if origin := rec.Header()["Access-Control-Allow-Origin"]; len(origin) != 1 || origin[0] != "*" {
+    t.Errorf("Expected a single allowed origin header, got %v", origin)
+  }
+  if rec.Header().Get("X-Path") != "/v1/posts" {
+    t.Errorf("Unexpected upstream path %s", rec.Header().Get("X-Path"))
+  }
+  if rec.Header().Get("X-Host") != "localhost:3577" {
+    t.Errorf("Unexpected forwarded host %s", rec.Header().Get("X-Host"))
+  }
+  if rec.Header().Get("X-Token") != "Bearer dev" {
+    t.Errorf("Expected proxy header to be set")
+  }
+
+  rec = httptest.NewRecorder()
+  handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/blog/api/login", nil))
+  if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/blog/api/home" {
+    t.Errorf("Expected redirect to be rewritten, got %d %s", rec.Code, rec.Header().Get("Location"))
+  }
+
+  if _, err := NewProxyHandler(Mountpoint{Url: "/api/", Proxy: "ftp://127.0.0.1"}); err == nil {
+    t.Errorf("Expected error for unsupported upstream scheme")
+  }
+}
@@ -1,9 +1,16 @@
 package handler
 
 import (
+  "os"
+  "mime"
+  "path"
   "strings"
+  "net/url"
   "net/http"
+  "io/ioutil"
+  "path/filepath"
   . "github.com/tmpfs/pageloop/model"
+  . "github.com/tmpfs/pageloop/util"
 )
 
 // Serves application public files from disc.
@@ -15,7 +22,29 @@ type PublicHandler struct {
 
 func (h PublicHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
   app := h.App
-  path := "/" + req.URL.Path
+  path := cleanPath(req.URL.Path)
+  routes := app.Routes
+
+  // Routing rules are not public, they are not published but may
+  // remain in the public directory from an earlier version
+  if path == SLASH + RoutesFileName {
+    http.NotFound(res, req)
+    return
+  }
+
+  if routes != nil {
+    for k, v := range routes.MatchHeaders(path) {
+      res.Header().Set(k, v)
+    }
+    if target, status := routes.MatchRedirect(path); target != "" {
+      if req.URL.RawQuery != "" && !strings.Contains(target, "?") {
+        target += "?" + req.URL.RawQuery
+      }
+      http.Redirect(res, req, mountTarget(req, target), status)
+      return
+    }
+  }
+
   file := app.Urls[path]
 	clean := strings.TrimSuffix(path, "/")
   // FIXME: this is rubbish
@@ -26,6 +55,88 @@ func (h PublicHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
     return
   }
 
+  if routes != nil && !published(app, path) {
+    if target := routes.MatchRewrite(path); target != "" {
+      // The file server redirects requests for index pages
+      path = strings.TrimSuffix(target, "index.html")
+      r := new(http.Request)
+      *r = *req
+      r.URL = new(url.URL)
+      *r.URL = *req.URL
+      r.URL.Path = strings.TrimPrefix(path, SLASH)
+      r.URL.RawPath = ""
+      req = r
+    } else if routes.NotFound != "" && published(app, routes.NotFound) {
+      serveNotFound(res, app, routes.NotFound)
+      return
+    }
+  }
+
+  if app.CacheControl != "" {
+    res.Header().Set("Cache-Control", app.CacheControl)
+  }
+
+  // Use a compressed copy written when the file was published
+  if servePrecompressed(res, req, app.PublicDirectory(), path) {
+    return
+  }
+
   // Defer to file server for files
   h.FileServer.ServeHTTP(res, req)
 }
+
+// Clean a request path so that rules match equivalent paths such
+// as //_routes.yml, a trailing slash for a directory is kept.
+func cleanPath(urlPath string) string {
+  clean := path.Clean(SLASH + urlPath)
+  if strings.HasSuffix(urlPath, SLASH) && clean != SLASH {
+    clean += SLASH
+  }
+  return clean
+}
+
+// Get the published file path for a URL path, directories
+// resolve to the index page.
+func publishedPath(app *Application, urlPath string) string {
+  name := filepath.Join(app.PublicDirectory(), filepath.FromSlash(path.Clean("/" + urlPath)))
+  if info, err := os.Stat(name); err == nil && info.IsDir() {
+    name = filepath.Join(name, "index.html")
+  }
+  return name
+}
+
+// Determine if a published file exists for a URL path.
+func published(app *Application, urlPath string) bool {
+  info, err := os.Stat(publishedPath(app, urlPath))
+  return err == nil && !info.IsDir()
+}
+
+// Send the custom not found page.
+func serveNotFound(res http.ResponseWriter, app *Application, urlPath string) {
+  name := publishedPath(app, urlPath)
+  content, err := ioutil.ReadFile(name)
+  if err != nil {
+    http.Error(res, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+    return
+  }
+  contentType := mime.TypeByExtension(filepath.Ext(name))
+  if contentType == "" {
+    contentType = http.DetectContentType(content)
+  }
+  res.Header().Set("Content-Type", contentType)
+  res.WriteHeader(http.StatusNotFound)
+  res.Write(content)
+}
+
+// Resolve a redirect target relative to the URL the application
+// is served from, absolute URLs are not modified.
+func mountTarget(req *http.Request, target string) string {
+  if !strings.HasPrefix(target, SLASH) || strings.HasPrefix(target, "//") {
+    return target
+  }
+  prefix := SLASH
+  if u, err := url.ParseRequestURI(req.RequestURI); err == nil {
+    prefix = strings.TrimSuffix(u.Path, req.URL.Path)
+  }
+  return strings.TrimSuffix(prefix, SLASH) + target
+}
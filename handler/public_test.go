@@ -0,0 +1,75 @@
+package handler
+
+import (
+  "os"
+  "testing"
+  "net/http"
+  "io/ioutil"
+  "path/filepath"
+  "net/http/httptest"
+  . "github.com/tmpfs/pageloop/model"
+)
+
+func TestPublicRoutes(t *testing.T) {
+  dir, err := ioutil.TempDir("", "pageloop-routes")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  app := NewApplication("/user/blog/", "")
+  app.SetPath(dir)
+  app.Urls = make(map[string] *File)
+  if err := os.MkdirAll(app.PublicDirectory(), 0755); err != nil {
+    t.Fatal(err)
+  }
+  // Routes file published by an earlier version
+  files := map[string]string{"index.html": "<p>Index</p>", "404.html": "<p>Missing</p>", RoutesFileName: "redirects: []"}
+  for name, content := range files {
+    if err := ioutil.WriteFile(filepath.Join(app.PublicDirectory(), name), []byte(content), 0644); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  app.Routes = &RoutesFile{
+    Redirects: []*Redirect{{From: "/old/*", To: "/new/:splat", Status: http.StatusFound}},
+    Rewrites: []*Rewrite{{From: "/app/*", To: "/index.html"}},
+    Headers: []*HeaderRule{{Path: "/*", Values: map[string]string{"Content-Security-Policy": "default-src 'self'"}}},
+    NotFound: "/404.html"}
+
+  url := app.PublishUrl()
+  fileserver := http.FileServer(http.Dir(app.PublicDirectory()))
+  handler := http.StripPrefix(url, PublicHandler{Listing: &DirList{}, App: app, FileServer: fileserver})
+
+  var tests = []struct {
+    path string
+    status int
+    location string
+    body string
+  }{
+    {"/user/blog/old/post?page=2", http.StatusFound, "/user/blog/new/post?page=2", ""},
+    {"/user/blog/app/settings", http.StatusOK, "", "<p>Index</p>"},
+    {"/user/blog/missing", http.StatusNotFound, "", "<p>Missing</p>"},
+    {"/user/blog//old/post", http.StatusFound, "/user/blog/new/post", ""},
+    {"/user/blog/" + RoutesFileName, http.StatusNotFound, "", ""},
+    {"/user/blog//" + RoutesFileName, http.StatusNotFound, "", ""},
+    {"/user/blog/./" + RoutesFileName, http.StatusNotFound, "", ""},
+  }
+
+  for _, test := range tests {
+    rec := httptest.NewRecorder()
+    handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+    if rec.Code != test.status {
+      t.Errorf("Expected status %d for %s, got %d", test.status, test.path, rec.Code)
+    }
+    if rec.Header().Get("Location") != test.location {
+      t.Errorf("Unexpected location %s for %s", rec.Header().Get("Location"), test.path)
+    }
+    if test.body != "" && rec.Body.String() != test.body {
+      t.Errorf("Unexpected body %s for %s", rec.Body.String(), test.path)
+    }
+    if test.status != http.StatusNotFound && rec.Header().Get("Content-Security-Policy") != "default-src 'self'" {
+      t.Errorf("Expected custom header for %s", test.path)
+    }
+  }
+}
@@ -0,0 +1,32 @@
+package handler
+
+import (
+  "net"
+  "net/http"
+)
+
+// Redirects plain HTTP requests to the HTTPS server.
+type RedirectHandler struct {
+  // Port the HTTPS server listens on, empty for the default port.
+  Port string
+}
+
+// Create a redirect handler for an HTTPS server bind address.
+func NewRedirectHandler(addr string) RedirectHandler {
+  var port string
+  if _, p, err := net.SplitHostPort(addr); err == nil && p != "443" {
+    port = p
+  }
+  return RedirectHandler{Port: port}
+}
+
+func (h RedirectHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  host := req.Host
+  if name, _, err := net.SplitHostPort(host); err == nil {
+    host = name
+  }
+  if h.Port != "" {
+    host = net.JoinHostPort(host, h.Port)
+  }
+  http.Redirect(res, req, "https://" + host + req.URL.RequestURI(), http.StatusMovedPermanently)
+}
@@ -2,11 +2,12 @@
 package handler
 
 import (
-  "fmt"
   //"mime"
+  "time"
   "strings"
   "strconv"
 	"net/http"
+  "encoding/json"
   . "github.com/tmpfs/pageloop/core"
   . "github.com/tmpfs/pageloop/model"
   . "github.com/tmpfs/pageloop/rpc"
@@ -23,177 +24,42 @@ var(
     http.MethodPut,
     http.MethodDelete,
     http.MethodOptions}
-	SchemaAppNew = MustAsset("schema/app-new.json")
 )
 
-// Get the service method arguments for the given request and matched route.
-func Argv(route *Route, req *http.Request, res http.ResponseWriter) (argv interface{}, err *StatusError) {
-  name := route.ServiceMethod
-  switch name {
-    case "Container.CreateApp":
-      var app *ApplicationRequest =
-        &ApplicationRequest{Container: route.Parameters.Context}
-
-      // TODO: move validation to service logic
-      if _, err := utils.ValidateRequest(SchemaAppNew, app, req); err != nil {
-        return nil, CommandError(http.StatusBadRequest, err.Error())
-      }
-      argv = app
-    case "Container.Read":
-      argv = &ContainerRequest{Name: route.Parameters.Context}
-    case "Archive.Import":
-      fallthrough
-    case "Archive.Export":
-      /*
-      app := &ApplicationRequest{
-        Name: route.Parameters.Target,
-        Container: route.Parameters.Context}
-      */
-
-      name := route.Parameters.Target
-
-      // Switch archive type
-      archiveType := ArchiveFull
-      filter := strings.TrimSuffix(route.Parameters.Item, SLASH)
-      filter = strings.TrimPrefix(filter, SLASH)
-      if filter == "source" {
-        archiveType = ArchiveSource
-        name += "-" + filter
-      } else if filter == "public" {
-        archiveType = ArchivePublic
-        name += "-" + filter
-      }
-
-      name += ".zip"
-      res.Header().Set("Content-Disposition", "attachment; filename=" + name)
-
-      ref := fmt.Sprintf(
-        "file://pageloop.com/%s/%s",
-        route.Parameters.Context,
-        route.Parameters.Target)
-
-      argv = &ArchiveRequest{
-        Ref: ref,
-        Writer: res,
-        Type: archiveType,
-        Name: name}
-    case "Job.Delete":
-      fallthrough
-    case "Job.Read":
-      argv = &JobRequest{Id: route.Parameters.Context}
-    case "Application.ReadFiles":
-      fallthrough
-    case "Application.ReadPages":
-      fallthrough
-    case "Application.Delete":
-      fallthrough
-    case "Application.Read":
-      ref := fmt.Sprintf(
-        "file://pageloop.com/%s/%s",
-        route.Parameters.Context,
-        route.Parameters.Target)
-      argv = &ApplicationReferenceRequest{Ref: ref}
-    case "Application.DeleteFiles":
-      var list UrlList = make(UrlList, 0)
-      if err := utils.ReadJson(req, &list); err != nil {
-        return nil, CommandError(http.StatusInternalServerError, err.Error())
-      }
-      /*
-      argv = &ApplicationRequest{
-        Name: route.Parameters.Target,
-        Container: route.Parameters.Context,
-        Batch: &list}
-      */
-      ref := fmt.Sprintf(
-        "file://pageloop.com/%s/%s",
-        route.Parameters.Context,
-        route.Parameters.Target)
-      argv = &ApplicationBatchRequest{Ref: ref, Batch: &list}
-    case "Application.RunTask":
-      ref := fmt.Sprintf(
-        "file://pageloop.com/%s/%s",
-        route.Parameters.Context,
-        route.Parameters.Target)
-      argv = &ApplicationTaskRequest{Ref: ref, Task: route.Parameters.Item}
-    case "File.Delete":
-      fallthrough
-    case "File.ReadPage":
-      fallthrough
-    case "File.ReadSource":
-      fallthrough
-    case "File.ReadSourceRaw":
-      fallthrough
-    case "File.Read":
-      ref := fmt.Sprintf(
-        "file://pageloop.com/%s/%s#%s",
-        route.Parameters.Context,
-        route.Parameters.Target,
-        route.Parameters.Item)
-      argv = &FileReferenceRequest{Ref: ref}
-    case "File.Move":
-      ref := fmt.Sprintf(
-        "file://pageloop.com/%s/%s#%s",
-        route.Parameters.Context,
-        route.Parameters.Target,
-        route.Parameters.Item)
-      argv = &FileMoveRequest{Ref: ref, Destination: req.Header.Get("Location")}
-    case "File.CreateTemplate":
-      ref := fmt.Sprintf(
-        "file://pageloop.com/%s/%s#%s",
-        route.Parameters.Context,
-        route.Parameters.Target,
-        route.Parameters.Item)
-      f := &FileTemplateRequest{Ref: ref, Template: &ApplicationTemplate{}}
-      if err := utils.ReadJson(req, f.Template); err != nil {
-        return nil, err
-      }
-      argv = f
-    case "File.Create":
-      fallthrough
-    case "File.Save":
-      ref := fmt.Sprintf(
-        "file://pageloop.com/%s/%s#%s",
-        route.Parameters.Context,
-        route.Parameters.Target,
-        route.Parameters.Item)
-      f := &FileContentRequest{Ref: ref}
-      if content, err := utils.ReadBody(req); err != nil {
-        return nil, CommandError(http.StatusInternalServerError, err.Error())
-      } else {
-        f.Bytes = content
-      }
-      argv = f
-    case "Service.Read":
-      argv = &ServiceRequest{Service: route.Parameters.Context}
-    case "Service.ReadMethodCalls":
-      fallthrough
-    case "Service.ReadMethod":
-      argv = &ServiceMethodRequest{
-        Service: route.Parameters.Context,
-        Method: route.Parameters.Target}
-  }
-  return argv, nil
-}
-
-
 // Handles requests for application data.
 type RestHandler struct {
   Services *ServiceMap
   Host *Host
   Mountpoints *MountpointManager
+  Policy *Policy
 }
 
 // Configure the service. Adds a rest handler for the API URL to
 // the passed servemux.
-func RestService(mux *http.ServeMux, services *ServiceMap, host *Host, mountpoints *MountpointManager) http.Handler {
-  handler := RestHandler{Services: services, Host: host, Mountpoints: mountpoints}
+func RestService(mux *http.ServeMux, services *ServiceMap, host *Host, mountpoints *MountpointManager, policy *Policy) http.Handler {
+  handler := RestHandler{Services: services, Host: host, Mountpoints: mountpoints, Policy: policy}
   mux.Handle(API_URL, http.StripPrefix(API_URL, handler))
 	return handler
 }
 
 // Handle REST API endpoint requests.
 func (h RestHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
-  h.doServeHttp(res, req)
+  start := time.Now()
+  w := &routeWriter{ResponseWriter: res, status: http.StatusOK}
+  h.doServeHttp(w, req)
+
+  // Unmatched requests are grouped so the number of series is bounded
+  path := "none"
+  if w.route != nil {
+    path = API_URL + strings.TrimPrefix(w.route.Pattern, SLASH)
+  }
+  RouteRequests.Add(1, req.Method, path, strconv.Itoa(w.status))
+  RouteLatency.Since(start, req.Method, path)
+
+  // Record the service method in the access log
+  if proxy, ok := res.(*ResponseWriterProxy); ok && w.route != nil {
+    proxy.Target = w.route.ServiceMethod
+  }
 }
 
 // Primary handler, decoupled from ServeHTTP so we can return from the function.
@@ -202,9 +68,17 @@ func (h RestHandler) doServeHttp(res http.ResponseWriter, req *http.Request) (in
     return utils.Errorj(res, CommandError(http.StatusMethodNotAllowed, ""))
 	}
 
-  // Never cache API requests
+  // Never cache API requests, cacheable responses replace the
+  // header so that clients revalidate
   res.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
 
+  // Identify the user for the request
+  user, err := h.Policy.Authenticate(req)
+  if err != nil {
+    res.Header().Set("WWW-Authenticate", `Basic realm="` + MetaData.Name + `"`)
+    return utils.Errorj(res, err)
+  }
+
   if route, err := DefaultRouter.Find(req); err != nil {
     return utils.Errorj(res, err)
   } else {
@@ -214,6 +88,10 @@ func (h RestHandler) doServeHttp(res http.ResponseWriter, req *http.Request) (in
         res, CommandError(http.StatusNotFound, "No route matched for path %s", req.URL.Path))
     }
 
+    if w, ok := res.(*routeWriter); ok {
+      w.route = route
+    }
+
     // fmt.Printf("route: %#v\n", route)
     hasServiceMethod := h.Services.HasMethod(route.ServiceMethod)
 
@@ -230,20 +108,33 @@ func (h RestHandler) doServeHttp(res http.ResponseWriter, req *http.Request) (in
         return utils.Errorj(
           res, CommandError(http.StatusInternalServerError, err.Error()))
       } else {
-        // Get rpc arguments
-        if argv, err := Argv(route, req, res); err != nil {
+        // Bind request data to the method arguments
+        argv := rpcreq.Args()
+        if err := BindRequest(argv, route, req, res); err != nil {
+          return utils.Errorj(res, err)
+        } else if err := ValidateArgs(route.ServiceMethod, argv); err != nil {
           return utils.Errorj(res, err)
         } else {
-
-          // Got some arguments to use for the request
-          if argv != nil {
-            rpcreq.Argv(argv)
+          if caller, ok := argv.(UserArgs); ok {
+            caller.SetUser(user)
+          }
+          if traced, ok := argv.(TracedArgs); ok {
+            traced.SetRequestId(ContextRequestId(req.Context()))
           }
 
           // Call the service function
           Stats.Rpc.Add("calls", 1)
-          if reply, err := h.Services.Call(rpcreq); err != nil {
+          start := time.Now()
+          unlock := lockCall(h.Mountpoints, route.ServiceMethod)
+          reply, err := h.Services.Call(rpcreq)
+          if err == nil {
+            mountCreated(h.Mountpoints, h.Host, route.ServiceMethod, reply)
+          }
+          unlock()
+          observeCall(route.ServiceMethod, "rest", start, err)
+          if err != nil {
             Stats.Rpc.Add("errors", 1)
+            audit(route.ServiceMethod, argv, 0, err)
             // Send status error if we can
             if err, ok := reply.Error.(*StatusError); ok {
               return utils.Errorj(res, err)
@@ -260,22 +151,17 @@ func (h RestHandler) doServeHttp(res http.ResponseWriter, req *http.Request) (in
 
             // TODO: use route status and remove from ServiceReply
             status := http.StatusOK
+            var modified time.Time
 
             if result, ok := replyData.(*ServiceReply); ok {
               replyData = result.Reply
+              modified = result.Modified
               if result.Status != 0 {
                 status = result.Status
               }
             }
 
-            // NOTE: After functions need some thought!
-            if route.ServiceMethod == "Container.CreateApp" {
-              // Mount the application, needs to be done here due to some funky
-              // package cyclic references
-              if app, ok := replyData.(*Application); ok {
-                MountApplication(h.Mountpoints.MountpointMap, h.Host, app)
-              }
-            }
+            audit(route.ServiceMethod, argv, status, nil)
 
             // Indicate to the client the response type.
             // Allows the client to determine whether a response should
@@ -291,7 +177,7 @@ func (h RestHandler) doServeHttp(res http.ResponseWriter, req *http.Request) (in
 
               // If the method result is a slice of bytes send it back
               if content, ok := replyData.([]byte); ok {
-                return utils.Write(res, status, content)
+                return writeCacheable(res, req, status, content, modified)
               } else {
                 return utils.Errorj(
                   res, CommandError(
@@ -301,7 +187,13 @@ func (h RestHandler) doServeHttp(res http.ResponseWriter, req *http.Request) (in
             }
 
             // Assume JSON response if response type not already handled
-            return utils.Json(res, status, replyData)
+            content, err := json.Marshal(replyData)
+            if err != nil {
+              return utils.Errorj(res, CommandError(http.StatusInternalServerError, err.Error()))
+            }
+            res.Header().Set("Content-Type", JSON_MIME)
+            res.Header().Set("Content-Length", strconv.Itoa(len(content)))
+            return writeCacheable(res, req, status, content, modified)
           }
         }
       }
@@ -312,3 +204,19 @@ func (h RestHandler) doServeHttp(res http.ResponseWriter, req *http.Request) (in
   return utils.Errorj(
     res, CommandError(http.StatusNotFound, ""))
 }
+
+// Write a response body that clients may cache.
+//
+// Successful GET responses must be revalidated by the client using the
+// entity tag or modification time, the body is not sent when the client
+// copy is current. Other responses are written unchanged.
+func writeCacheable(res http.ResponseWriter, req *http.Request, status int, content []byte, modified time.Time) (int, error) {
+  if req.Method != http.MethodGet || status != http.StatusOK {
+    return utils.Write(res, status, content)
+  }
+  res.Header().Set("Cache-Control", "no-cache")
+  if utils.NotModified(res, req, content, modified) {
+    return 0, nil
+  }
+  return utils.Write(res, status, content)
+}
@@ -20,6 +20,11 @@ func send (res http.ResponseWriter, req *http.Request, file *File, output []byte
     res.Header().Set("Content-Disposition", "inline; filename=" + base)
   }
 
+  // Client copy is current
+  if utils.NotModified(res, req, output, file.ModTime()) {
+    return
+  }
+
   res.Header().Set("Content-Type", ct)
   res.Header().Set("Content-Length", strconv.Itoa(len(output)))
   if (req.Method == http.MethodHead) {
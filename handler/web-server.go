@@ -2,12 +2,20 @@ package handler
 
 import (
   "fmt"
+  "time"
   "bufio"
   "strings"
   "strconv"
   "net"
+  "net/url"
   "net/http"
   . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+var(
+  // Log for HTTP requests and websocket messages.
+  AccessLog *Logger = Log
 )
 
 // Main HTTP server handler.
@@ -19,6 +27,12 @@ type ServerHandler struct {
 
 type ResponseWriterProxy struct {
   Response http.ResponseWriter
+  // Status code sent to the client
+  Status int
+  // Number of body bytes written
+  Bytes int64
+  // Mountpoint or service method that handled the request
+  Target string
 }
 
 func (w *ResponseWriterProxy) Header() http.Header {
@@ -27,24 +41,44 @@ func (w *ResponseWriterProxy) Header() http.Header {
 
 func (w *ResponseWriterProxy) WriteHeader(status int) {
   w.Response.WriteHeader(status)
+  w.Status = status
   Stats.Http.Add(strconv.Itoa(status), 1)
   Stats.Http.Add("responses", 1)
 }
 
 func (w *ResponseWriterProxy) Write(data []byte) (int, error) {
+  if w.Status == 0 {
+    w.Status = http.StatusOK
+  }
   if written, err := w.Response.Write(data); err != nil {
     return 0, err
   } else {
+    w.Bytes += int64(written)
     Stats.Http.Add("body-out", int64(written))
     return written, nil
   }
 }
 
+func (w *ResponseWriterProxy) Flush() {
+  if w.Status == 0 {
+    w.Status = http.StatusOK
+  }
+  if f, ok := w.Response.(http.Flusher); ok {
+    f.Flush()
+  }
+}
+
+// Get the wrapped response writer.
+func (w *ResponseWriterProxy) Unwrap() http.ResponseWriter {
+  return w.Response
+}
+
 func (w *ResponseWriterProxy) Hijack() (net.Conn, *bufio.ReadWriter, error) {
   hj, ok := w.Response.(http.Hijacker)
   if !ok {
     return nil, nil, fmt.Errorf("webserver doesn't support hijacking")
   }
+  w.Status = http.StatusSwitchingProtocols
   return hj.Hijack()
 }
 
@@ -66,13 +100,47 @@ func (h ServerHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
     Stats.Http.Add("body-in", req.ContentLength)
   }
 
+  // Use the client request identifier when it is valid
+  id := req.Header.Get(RequestIdHeader)
+  if !ValidRequestId(id) {
+    id = NewRequestId()
+  }
+  res.Header().Set(RequestIdHeader, id)
+  req = req.WithContext(WithRequestId(req.Context(), id))
+
+  start := time.Now()
   proxy := &ResponseWriterProxy{Response: res}
+  defer logRequest(proxy, req, start)
+
+  // Compress responses when the client accepts gzip
+  if req.Method != http.MethodHead && AcceptsEncoding(req, "gzip") {
+    compressor := &compressWriter{ResponseWriter: res}
+    defer compressor.Close()
+    proxy.Response = compressor
+  }
+
+  // Applications with a virtual host are served at the root path
+  h.MountpointManager.RLock()
+  app, vhost := h.MountpointManager.VirtualHost(req.Host)
+  h.MountpointManager.RUnlock()
+  if vhost != nil {
+    r := new(http.Request)
+    *r = *req
+    r.URL = new(url.URL)
+    *r.URL = *req.URL
+    r.URL.Path = strings.TrimSuffix(app.PublishUrl(), SLASH) + path
+    r.URL.RawPath = ""
+    proxy.Target = app.Host
+    vhost.ServeHTTP(proxy, r)
+    return
+  }
 
   var system []string
-  system = append(system, API_URL, RPC_URL, WEBSOCKET_URL)
+  system = append(system, API_URL, RPC_URL, WEBSOCKET_URL, METRICS_URL)
 	// Look for system services first
 	for _, u := range system {
 		if strings.HasPrefix(path, u) {
+			proxy.Target = u
 			handler, _ = h.Mux.Handler(req)
 			handler.ServeHTTP(proxy, req)
 			return
@@ -84,6 +152,7 @@ func (h ServerHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	// Serve the highest score which is the longest
 	// matching URL path.
 	var score int
+  h.MountpointManager.RLock()
 	for k, v := range h.MountpointManager.MountpointMap {
 		if strings.HasPrefix(path, k) {
 			if handler != nil && len(k) < score {
@@ -91,11 +160,30 @@ func (h ServerHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 			}
 			handler = v
 			score = len(k)
+			proxy.Target = k
 		}
 	}
+  h.MountpointManager.RUnlock()
 
 	if handler == nil {
 		handler = http.NotFoundHandler()
 	}
 	handler.ServeHTTP(proxy, req)
 }
+
+// Write an access log record for a request.
+func logRequest(proxy *ResponseWriterProxy, req *http.Request, start time.Time) {
+  // Nothing written, the server sends an empty response
+  if proxy.Status == 0 {
+    proxy.Status = http.StatusOK
+  }
+  AccessLog.Info("request", Fields{
+    "request-id": ContextRequestId(req.Context()),
+    "remote": req.RemoteAddr,
+    "method": req.Method,
+    "path": req.URL.Path,
+    "target": proxy.Target,
+    "status": proxy.Status,
+    "bytes": proxy.Bytes,
+    "duration": time.Since(start).Seconds()})
+}
@@ -1,12 +1,15 @@
 package handler
 
 import (
-  //"fmt"
-  "log"
+  "fmt"
+  "sync"
+  "time"
   "bytes"
+  "context"
 	"net/http"
   "github.com/gorilla/rpc/v2"
   "github.com/gorilla/rpc/v2/json"
+  "github.com/gorilla/rpc/v2/json2"
   "github.com/gorilla/websocket"
   . "github.com/tmpfs/pageloop/core"
   . "github.com/tmpfs/pageloop/model"
@@ -18,12 +21,62 @@ import (
 var(
   ping = []byte("{}")
   codec *json.Codec = json.NewCodec()
+  // Codec for messages with a jsonrpc version and batches
+  codec2 *json2.Codec = json2.NewCodec()
   connections []*WebsocketConnection
+  // Protects the connections list
+  connLock sync.Mutex
+  // Messages currently being processed
+  inflight = &messageTracker{}
   upgrader = websocket.Upgrader{
     ReadBufferSize:  1024,
-    WriteBufferSize: 1024}
+    WriteBufferSize: 1024,
+    // Negotiate permessage-deflate with clients that support it
+    EnableCompression: true}
 )
 
+// Tracks messages that are being processed so that shutdown
+// can wait for service calls to complete.
+type messageTracker struct {
+  sync.Mutex
+  wg sync.WaitGroup
+  closed bool
+}
+
+// Start processing a message, returns false once closed.
+func (t *messageTracker) Begin() bool {
+  t.Lock()
+  defer t.Unlock()
+  if t.closed {
+    return false
+  }
+  t.wg.Add(1)
+  return true
+}
+
+// Finish processing a message.
+func (t *messageTracker) End() {
+  t.wg.Done()
+}
+
+// Stop accepting messages and wait for those being processed.
+func (t *messageTracker) Close(ctx context.Context) error {
+  t.Lock()
+  t.closed = true
+  t.Unlock()
+  done := make(chan struct{})
+  go func() {
+    t.wg.Wait()
+    close(done)
+  }()
+  select {
+    case <-done:
+      return nil
+    case <-ctx.Done():
+      return ctx.Err()
+  }
+}
+
 // Wrapped result object for JSON-RPC messages so the client
 // can test on status code
 type RpcWebsocketReply struct {
@@ -34,6 +87,14 @@ type RpcWebsocketReply struct {
 type WebsocketConnection struct {
   Handler WebsocketHandler
   Conn *websocket.Conn
+  // User authenticated when the connection was upgraded
+  User string
+  // Request identifier for the upgrade request
+  RequestId string
+  // Number of messages read, used to identify each message
+  messages uint64
+  // Request identifier for the message being handled
+  message string
 }
 
 // Implements http.ResponseWriter for JSON-RPC responses
@@ -41,6 +102,9 @@ type WebsocketWriter struct {
   MessageType int
   Socket *WebsocketConnection
   Request rpc.CodecRequest
+  // Responses are written to the buffer when set so that
+  // batch responses can be grouped
+  Buffer *bytes.Buffer
 }
 
 func (writer *WebsocketWriter) WriteHeader(int) {}
@@ -50,185 +114,198 @@ func (writer *WebsocketWriter) Header() http.Header {
 }
 
 func (writer *WebsocketWriter) Write(p []byte) (int, error) {
+  if writer.Buffer != nil {
+    return writer.Buffer.Write(p)
+  }
   if err := writer.Socket.Conn.WriteMessage(writer.MessageType, p); err != nil {
     return 0, err
   }
   return len(p), nil
 }
 
-// Write an error response to the result object so that clients
-// can inspect the status code for the error.
-func (writer *WebsocketWriter) WriteError(err *StatusError) {
+// Write an error response so that clients can inspect the status
+// code for the error.
+//
+// For JSON-RPC 2.0 the error object has the code and the status
+// error is the data, otherwise the error is written to the result
+// object and the code is not used.
+func (writer *WebsocketWriter) WriteError(code json2.ErrorCode, err *StatusError) {
+  if req, ok := writer.Request.(*json2.CodecRequest); ok {
+    req.WriteError(writer, err.Status, &json2.Error{Code: code, Message: err.Message, Data: err})
+    return
+  }
   m := make(map[string]*StatusError)
   m["error"] = err
-  // TODO: use rpc v2 style error handling?
   writer.Request.WriteResponse(writer, m)
 }
 
-// Determine the type of argument for the given service method and
-// call ReadRequest() on the CodecRequest to parse the input params
-// into the correct type.
-func (w *WebsocketConnection) RequestArgv(req rpc.CodecRequest, writer http.ResponseWriter, method string) (argv interface{}, err error) {
-  argv = &VoidArgs{}
-  switch(method) {
-    case "Archive.Export":
-      argv = &ArchiveRequest{Writer: writer}
-    case "Container.Read":
-      argv = &ContainerRequest{}
-    case "Container.CreateApp":
-      fallthrough
-    case "Application.DeleteFiles":
-      argv = &ApplicationBatchRequest{}
-    case "Application.RunTask":
-      argv = &ApplicationTaskRequest{}
-    case "Application.Delete":
-      fallthrough
-    case "Application.ReadFiles":
-      fallthrough
-    case "Application.ReadPages":
-      fallthrough
-    case "Application.Read":
-      argv = &ApplicationReferenceRequest{}
-    case "File.Move":
-      argv = &FileMoveRequest{}
-    case "File.Delete":
-      fallthrough
-    case "File.ReadPage":
-      fallthrough
-    case "File.ReadSource":
-      fallthrough
-    case "File.ReadSourceRaw":
-      fallthrough
-    case "File.Read":
-      argv = &FileReferenceRequest{}
-    case "File.CreateTemplate":
-      argv = &FileTemplateRequest{}
-    case "File.Create":
-      fallthrough
-    case "File.Save":
-      argv = &FileContentRequest{}
-    case "Service.Read":
-      argv = &ServiceRequest{}
-    case "Service.ReadMethodCalls":
-      fallthrough
-    case "Service.ReadMethod":
-      argv = &ServiceMethodRequest{}
-    case "Job.Delete":
-      fallthrough
-    case "Job.Read":
-      argv = &JobRequest{}
-
-  }
-  if argv != nil {
-    // Read in the request params to the type we expect
-    err = req.ReadRequest(argv)
-  }
-  return
-}
-
 func (w *WebsocketConnection) ReadRequest() {
   for {
     // Read in the message
     messageType, p, err := w.Conn.ReadMessage()
     if err != nil {
-      log.Println(err.Error())
+      Log.Debug("websocket closed", Fields{"request-id": w.RequestId, "error": err})
       // Cannot re-read now, we need to stop reading
       // close the socket connection on unrecoverable error
       w.Conn.Close()
       return
     }
 
-    // Treat text messages as JSON-RPC
-    if messageType == websocket.TextMessage {
-      // Drop ping requests
-      if bytes.Equal(p, ping) {
-        continue
-      }
+    // Stop processing messages once shutdown has started
+    if !inflight.Begin() {
+      return
+    }
+    w.HandleMessage(messageType, p)
+    inflight.End()
+  }
+}
 
-      // TODO: restore create app validation!
-
-      r := bytes.NewBuffer(p)
-      if fake, err := http.NewRequest(http.MethodPost, "/ws/", r); err != nil {
-        log.Println(err.Error())
-        continue
-      } else {
-        req := codec.NewRequest(fake)
-        writer := &WebsocketWriter{Socket: w, MessageType: messageType, Request: req}
-        if method, err := req.Method(); err != nil {
-          //req.WriteResponse(writer, nil, err)
-          writer.WriteError(CommandError(http.StatusInternalServerError, err.Error()))
-          continue
-        } else {
-          hasServiceMethod := w.Handler.Services.HasMethod(method)
-          // Check if the service method is available
-          if !hasServiceMethod {
-            writer.WriteError(
-              CommandError(http.StatusNotFound, "Service %s does not exist", method))
-            continue
-          }
-
-          // Get a service method call request
-          if rpcreq, err := w.Handler.Services.Request(method, 0); err != nil {
-            writer.WriteError(
-              CommandError(http.StatusInternalServerError, err.Error()))
-            continue
-          } else {
-            if argv, err := w.RequestArgv(req, writer, method); err != nil {
-              // If we had an error while reading the request
-              // if is likely a JSON unmarshal error so treat as
-              // a bad request
-              writer.WriteError(
-                CommandError(http.StatusBadRequest, err.Error()))
-              continue
-            } else {
-              if argv != nil {
-                rpcreq.Argv(argv)
-              }
-            }
-
-            // Call the service function
-            Stats.Rpc.Add("calls", 1)
-            if reply, err := w.Handler.Services.Call(rpcreq); err != nil {
-              Stats.Rpc.Add("errors", 1)
-              if ex, ok := err.(*StatusError); ok {
-                writer.WriteError(ex)
-              } else {
-                writer.WriteError(CommandError(http.StatusInternalServerError, err.Error()))
-              }
-              continue
-            } else {
-              // NOTE: we don't need to test reply.Error as the error is always returned
-
-              // Success send the response to the client
-              status := http.StatusOK
-              replyData := reply.Reply
-
-              if result, ok := replyData.(*ServiceReply); ok {
-                replyData = result.Reply
-                if result.Status != 0 {
-                  status = result.Status
-                }
-              }
-
-              if method == "Container.CreateApp" {
-                // Mount the application, needs to be done here due to some funky
-                // package cyclic references
-                if app, ok := replyData.(*Application); ok {
-                  MountApplication(w.Handler.Mountpoints.MountpointMap, w.Handler.Host, app)
-                }
-              }
-
-              // Wrap the result object so we can extract
-              // status code client side
-              replyData = &RpcWebsocketReply{Document: replyData, Status: status}
-
-              req.WriteResponse(writer, replyData)
-            }
-          }
-        }
-      }
+// Handle a single message read from the socket.
+func (w *WebsocketConnection) HandleMessage(messageType int, p []byte) {
+  // Treat text messages as JSON-RPC
+  if messageType == websocket.TextMessage {
+    // Drop ping requests
+    if bytes.Equal(p, ping) {
+      return
+    }
+
+    // Messages are read sequentially so each is numbered
+    // within the connection
+    w.messages++
+    w.message = fmt.Sprintf("%s.%d", w.RequestId, w.messages)
+
+    if batch, err := ParseBatch(p); err != nil {
+      w.writeBatchError(messageType, json2.E_PARSE, CommandError(http.StatusBadRequest, err.Error()))
+      return
+    } else if batch != nil {
+      w.HandleBatch(messageType, batch)
+      return
+    }
+
+    w.call(messageType, p, messageCodec(p), nil, nil)
+  }
+}
+
+// Called with the decoded arguments before a service method,
+// returning an error prevents the call.
+type callHook func(method string, args interface{}) *StatusError
+
+// Make a single JSON-RPC call and write the response, notifications
+// (calls without an id) do not have a response.
+//
+// The response is written to out when given otherwise it is sent
+// to the socket. Returns the error sent to the client.
+func (w *WebsocketConnection) call(messageType int, p []byte, c rpc.Codec, out *bytes.Buffer, before callHook) *StatusError {
+  var method string
+  status := http.StatusOK
+  start := time.Now()
+  defer func() {
+    AccessLog.Info("message", Fields{
+      "request-id": w.message,
+      "method": method,
+      "status": status,
+      "duration": time.Since(start).Seconds()})
+  }()
+
+  r := bytes.NewBuffer(p)
+  fake, err := http.NewRequest(http.MethodPost, "/ws/", r)
+  if err != nil {
+    status = http.StatusInternalServerError
+    return CommandError(status, err.Error())
+  }
+
+  req := c.NewRequest(fake)
+  writer := &WebsocketWriter{Socket: w, MessageType: messageType, Request: req, Buffer: out}
+  fail := func(code json2.ErrorCode, err *StatusError) *StatusError {
+    status = err.Status
+    writer.WriteError(code, err)
+    return err
+  }
+
+  method, err = req.Method()
+  if err != nil {
+    code := json2.E_INVALID_REQ
+    if e, ok := err.(*json2.Error); ok {
+      code = e.Code
+    }
+    return fail(code, CommandError(http.StatusInternalServerError, err.Error()))
+  }
+
+  // Check if the service method is available
+  if !w.Handler.Services.HasMethod(method) {
+    return fail(json2.E_NO_METHOD, CommandError(http.StatusNotFound, "Service %s does not exist", method))
+  }
+
+  // Get a service method call request
+  rpcreq, err := w.Handler.Services.Request(method, 0)
+  if err != nil {
+    return fail(json2.E_INTERNAL, CommandError(http.StatusInternalServerError, err.Error()))
+  }
+
+  // Decode the params to the method arguments
+  args := rpcreq.Args()
+  if err := BindMessage(args, req, writer); err != nil {
+    // If we had an error while reading the request
+    // if is likely a JSON unmarshal error so treat as
+    // a bad request
+    return fail(json2.E_BAD_PARAMS, CommandError(http.StatusBadRequest, err.Error()))
+  } else if err := ValidateArgs(method, args); err != nil {
+    return fail(json2.E_BAD_PARAMS, err)
+  }
+  if caller, ok := args.(UserArgs); ok {
+    caller.SetUser(w.User)
+  }
+  if traced, ok := args.(TracedArgs); ok {
+    traced.SetRequestId(w.message)
+  }
+
+  // Rollback state for a batch is captured under the same lock
+  unlock := lockCall(w.Handler.Mountpoints, method)
+  if before != nil {
+    if err := before(method, args); err != nil {
+      unlock()
+      return fail(json2.E_SERVER, err)
+    }
+  }
+
+  // Call the service function
+  Stats.Rpc.Add("calls", 1)
+  called := time.Now()
+  reply, err := w.Handler.Services.Call(rpcreq)
+  if err == nil {
+    mountCreated(w.Handler.Mountpoints, w.Handler.Host, method, reply)
+  }
+  unlock()
+  observeCall(method, "websocket", called, err)
+  if err != nil {
+    Stats.Rpc.Add("errors", 1)
+    audit(method, args, 0, err)
+    if ex, ok := err.(*StatusError); ok {
+      return fail(json2.E_SERVER, ex)
+    }
+    return fail(json2.E_SERVER, CommandError(http.StatusInternalServerError, err.Error()))
+  }
+
+  // NOTE: we don't need to test reply.Error as the error is always returned
+
+  // Success send the response to the client
+  replyData := reply.Reply
+
+  if result, ok := replyData.(*ServiceReply); ok {
+    replyData = result.Reply
+    if result.Status != 0 {
+      status = result.Status
     }
   }
+
+  audit(method, args, status, nil)
+
+  // Wrap the result object so we can extract
+  // status code client side
+  replyData = &RpcWebsocketReply{Document: replyData, Status: status}
+
+  req.WriteResponse(writer, replyData)
+  return nil
 }
 
 // Handles requests for application data.
@@ -236,29 +313,43 @@ type WebsocketHandler struct {
   Services *ServiceMap
   Host *Host
   Mountpoints *MountpointManager
+  Policy *Policy
+  // Deleted files are restored from the trash when a batch is rolled back
+  Trash *Trash
 }
 
 // Configure the service. Adds a handler for the websocket URL to
 // the passed servemux.
-func WebsocketService(mux *http.ServeMux, services *ServiceMap, host *Host, mountpoints *MountpointManager) http.Handler {
-  handler := WebsocketHandler{Services: services, Host: host, Mountpoints: mountpoints}
+func WebsocketService(mux *http.ServeMux, services *ServiceMap, host *Host, mountpoints *MountpointManager, policy *Policy, trash *Trash) http.Handler {
+  handler := WebsocketHandler{Services: services, Host: host, Mountpoints: mountpoints, Policy: policy, Trash: trash}
   mux.Handle(WEBSOCKET_URL, http.StripPrefix(WEBSOCKET_URL, handler))
 	return handler
 }
 
 // Handle websocket endpoint requests.
 func (h WebsocketHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+  // Identify the user before upgrading the connection
+  user, ex := h.Policy.Authenticate(req)
+  if ex != nil {
+    http.Error(res, ex.Error(), ex.Status)
+    return
+  }
+
   conn, err := upgrader.Upgrade(res, req, nil)
   if err != nil {
-    log.Println(err)
+    Log.Warn("websocket upgrade failed", Fields{"request-id": ContextRequestId(req.Context()), "error": err})
     return
   }
 
-  ws := &WebsocketConnection{Conn: conn, Handler: h}
+  ws := &WebsocketConnection{Conn: conn, Handler: h, User: user, RequestId: ContextRequestId(req.Context())}
+  connLock.Lock()
   connections = append(connections, ws)
+  connLock.Unlock()
   Stats.Websocket.Add("connections", 1)
 
   conn.SetCloseHandler(func(code int, text string) error {
+    connLock.Lock()
+    defer connLock.Unlock()
     for i, ws := range connections {
       if ws.Conn == conn {
         before := connections[0:i]
@@ -273,3 +364,27 @@ func (h WebsocketHandler) ServeHTTP(res http.ResponseWriter, req *http.Request)
   // Start reading messages from socket
   go ws.ReadRequest()
 }
+
+// Close all websocket connections for server shutdown.
+//
+// Messages that are being processed are allowed to complete then each
+// client is sent a close frame. Returns the number of connections
+// that were closed.
+func CloseWebsockets(ctx context.Context) (int, error) {
+  err := inflight.Close(ctx)
+
+  connLock.Lock()
+  defer connLock.Unlock()
+  msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "Server shutting down")
+  deadline := time.Now().Add(time.Second)
+  for _, ws := range connections {
+    if e := ws.Conn.WriteControl(websocket.CloseMessage, msg, deadline); e != nil {
+      Log.Warn("websocket close failed", Fields{"request-id": ws.RequestId, "error": e})
+    }
+    ws.Conn.Close()
+  }
+  closed := len(connections)
+  connections = nil
+  Stats.Websocket.Add("connections", int64(-closed))
+  return closed, err
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+  "os"
+  "testing"
+  "io/ioutil"
+  "path/filepath"
+)
+
+// Write files to the source directory of an application in a
+// temporary directory and load the application.
+//
+// Returns the application and the temporary directory which the
+// caller must remove.
+func loadTestApp(t *testing.T, name string, files map[string]string) (*Application, string) {
+  dir, err := ioutil.TempDir("", "pageloop-" + name)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  path := filepath.Join(dir, name)
+  if err := os.MkdirAll(filepath.Join(path, SOURCE), 0755); err != nil {
+    os.RemoveAll(dir)
+    t.Fatal(err)
+  }
+  for file, content := range files {
+    pth := filepath.Join(path, SOURCE, filepath.FromSlash(file))
+    if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+      os.RemoveAll(dir)
+      t.Fatal(err)
+    }
+    if err := ioutil.WriteFile(pth, []byte(content), 0644); err != nil {
+      os.RemoveAll(dir)
+      t.Fatal(err)
+    }
+  }
+
+  app := NewApplication("/user/" + name + "/", "")
+  app.FileSystem = NewUrlFileSystem(app)
+  if err := app.Load(path); err != nil {
+    os.RemoveAll(dir)
+    t.Fatal(err)
+  }
+  return app, dir
+}
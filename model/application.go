@@ -6,6 +6,7 @@ import (
   "os"
   "path"
   "strings"
+  "time"
   "io/ioutil"
   "path/filepath"
   . "github.com/tmpfs/pageloop/util"
@@ -50,12 +51,22 @@ type Application struct {
 
 	FileSystem ApplicationFileSystem `json:"-"`
 
-	// A protected application cannot be deleted.
+	// Anonymous users cannot delete a protected application,
+	// assigned from the access policy.
 	Protected bool `json:"protected,omitempty"`
 
   // Mark this application as a template
   IsTemplate bool `json:"is-template,omitempty"`
 
+  // Cache-Control header for published files
+  CacheControl string `json:"cache-control,omitempty"`
+
+  // Virtual host name the published files are also served from
+  Host string `json:"host,omitempty"`
+
+  // Publish a search index of the pages for client side search
+  PublishSearch bool `json:"publish-search,omitempty"`
+
   ContainerName string `json:"container"`
 
   Task string `json:"task,omitempty"`
@@ -67,11 +78,17 @@ type Application struct {
   // For applications with no build file this is nil.
   Builder *BuildFile `json:"build,omitempty"`
 
+  // Routing rules loaded from _routes.yml.
+  Routes *RoutesFile `json:"routes,omitempty"`
+
   // Source file path
   sourcePath string
 
   // Public publish path
   publicPath string
+
+  // Index of the file source and rendered page text
+  index *SearchIndex
 }
 
 func NewApplication(mountpoint, description string) *Application {
@@ -120,53 +137,40 @@ func (app *Application) ExistsConflict(url string) bool {
 
 // Create a new file and publish it, the file cannot already exist on disc.
 func (app *Application) Create(url string, content []byte) (*File, error) {
-	path := app.GetPathFromUrl(url)
-
-	var err error
-	var fh *os.File
-	// The file must not exist in order to create
-	if fh, err = os.Open(path); err != nil {
-		if !os.IsNotExist(err) {
-			return nil, err
-		}
-	}
-
-	if fh != nil {
-		defer fh.Close()
-	}
-
-  isDir := strings.HasSuffix(url, SLASH)
-
-  file := app.NewFile(path, nil, content)
-  if isDir {
-    file.Directory = true
+  file, err := app.create(url, content)
+  if err != nil {
+    return nil, err
   }
-	if err := app.FileSystem.SaveFile(file); err != nil {
-		return nil, err
-	}
-
-  // Must add before publish for all fields to be available
-	app.Add(file)
-
-	if err := app.FileSystem.PublishFile(app.PublicDirectory(), file, &DefaultPublishFilter{}); err != nil {
-		return nil, err
-	}
-
-	return file, nil
+	return file, app.changed(file.Url)
 }
 
-// Move a file to a new URL
+// Move a file to a new URL, moving a directory moves all the
+// files below the directory.
 func (app *Application) Move(file *File, dest string) error {
   u := path.Clean(dest)
   if !strings.HasPrefix(u, "/") {
     u = "/" + u
   }
 
-  if app.Urls[u] != nil {
+  if app.Urls[u] != nil || app.Urls[u + SLASH] != nil {
     return fmt.Errorf("Cannot move file, destination %s exists", dest)
   }
 
+  if file.Directory && strings.HasPrefix(u + SLASH, file.Url) {
+    return fmt.Errorf("Cannot move directory %s inside itself", file.Url)
+  }
+
+  // Destination parent directories must exist
+  parent, err := app.ensureDirectory(parentUrl(u))
+  if err != nil {
+    return err
+  }
+
   pth := app.GetPathFromUrl(u)
+  from := file.Url
+  oldPath := file.Path
+  oldUri := file.Uri
+  descendants := file.Descendants()
 
   // Move the source and published files
 	if err := app.FileSystem.MoveFile(file, u, pth, nil); err != nil {
@@ -174,40 +178,87 @@ func (app *Application) Move(file *File, dest string) error {
 	}
 
   file.Path = pth
-  delete(app.Urls, file.Url)
+  delete(app.Urls, from)
   app.setComputedFileFields(file)
   if file.Page() != nil {
     app.setComputedPageFields(file.Page())
   }
-  return nil
+
+  // Files below a directory were moved with the directory
+  for _, f := range descendants {
+    delete(app.Urls, f.Url)
+  }
+  for _, f := range descendants {
+    f.Path = pth + strings.TrimPrefix(f.Path, oldPath)
+    f.Uri = file.Uri + strings.TrimPrefix(f.Uri, oldUri)
+    app.setComputedFileFields(f)
+    if f.page != nil {
+      f.page.Uri = f.Uri
+      app.setComputedPageFields(f.page)
+    }
+  }
+
+  if file.parent != nil {
+    file.parent.removeChild(file)
+  }
+  parent.addChild(file)
+
+  urls := []string{from, file.Url}
+  for _, f := range descendants {
+    urls = append(urls, f.Url)
+  }
+  return app.changed(urls...)
 }
 
-// Update an existing file source and publish it, file must already exist on disc.
-func (app *Application) Update(file *File, content []byte) error {
-	var err error
-	var fh *os.File
-	// The file must exist in order to create
-	if fh, err = os.Open(file.Path); err != nil {
-		return err
-	}
-	defer fh.Close()
+// Copy a file to a new URL, copying a directory copies all the files
+// below the directory. When a file cannot be copied the files that
+// were copied are deleted.
+func (app *Application) Copy(file *File, dest string) (*File, error) {
+  u := path.Clean(dest)
+  if !strings.HasPrefix(u, "/") {
+    u = "/" + u
+  }
 
-	file.source = content
-  if file.page != nil {
-    if err := file.page.ParsePageData(); err != nil {
-      return err
+  if app.Urls[u] != nil || app.Urls[u + SLASH] != nil {
+    return nil, fmt.Errorf("Cannot copy file, destination %s exists", dest)
+  }
+
+  if !file.Directory {
+    return app.Create(u, append([]byte(nil), file.Source(true)...))
+  }
+
+  if strings.HasPrefix(u + SLASH, file.Url) {
+    return nil, fmt.Errorf("Cannot copy directory %s inside itself", file.Url)
+  }
+
+  // Create all the files before the routes and site index are updated once
+  descendants := file.Descendants()
+  copied, err := app.create(u + SLASH, nil)
+  if err != nil {
+    return nil, err
+  }
+  urls := []string{copied.Url}
+  for _, f := range descendants {
+    var content []byte
+    if !f.Directory {
+      content = append([]byte(nil), f.Source(true)...)
     }
-  } else {
-    // Update in-memory file data
-    file.data = content
+    created, err := app.create(u + SLASH + strings.TrimPrefix(f.Url, file.Url), content)
+    if err != nil {
+      app.Del(copied)
+      return nil, err
+    }
+    urls = append(urls, created.Url)
   }
-	if err := app.FileSystem.SaveFile(file); err != nil {
-		return err
-	}
-	if err := app.FileSystem.PublishFile(app.PublicDirectory(), file, &DefaultPublishFilter{}); err != nil {
-		return err
-	}
-	return nil
+  return copied, app.changed(urls...)
+}
+
+// Update an existing file source and publish it, file must already exist on disc.
+func (app *Application) Update(file *File, content []byte) error {
+  if err := app.update(file, content); err != nil {
+    return err
+  }
+	return app.changed(file.Url)
 }
 
 // Delete a file.
@@ -218,6 +269,95 @@ func (app *Application) Update(file *File, content []byte) error {
 //
 // Source and published versions are deleted from the filesystem.
 func (app *Application) Del(file *File) error {
+	if file.Directory {
+    if err := app.FileSystem.RemoveAll(file); err != nil {
+      return err
+    }
+	} else if err := app.FileSystem.Remove(file); err != nil {
+    return err
+  }
+  return app.detach(file)
+}
+
+// Move a file to a path outside the application, moving a directory
+// moves all the files below it. The file is removed from the
+// application as if it were deleted.
+func (app *Application) Discard(file *File, dest string) error {
+  if err := app.FileSystem.Discard(file, dest); err != nil {
+    return err
+  }
+  return app.detach(file)
+}
+
+// Move a file or directory from a path outside the application
+// to a URL, the files are added to the application and published.
+func (app *Application) Restore(src string, url string) (*File, error) {
+  info, err := os.Stat(src)
+  if err != nil {
+    return nil, err
+  }
+
+  u := path.Clean(url)
+  if !strings.HasPrefix(u, "/") {
+    u = "/" + u
+  }
+  if app.Urls[u] != nil || app.Urls[u + SLASH] != nil {
+    return nil, fmt.Errorf("Cannot restore file, destination %s exists", url)
+  }
+
+  if _, err := app.ensureDirectory(parentUrl(u)); err != nil {
+    return nil, err
+  }
+
+  pth := app.GetPathFromUrl(u)
+  if err := MoveFile(src, pth); err != nil {
+    return nil, err
+  }
+
+  file, err := app.FileSystem.LoadFile(pth)
+  if err != nil {
+    return nil, err
+  }
+  if err := app.Add(file); err != nil {
+    return nil, err
+  }
+  if info.IsDir() {
+    if err := app.FileSystem.Load(pth); err != nil {
+      return nil, err
+    }
+  }
+
+  restored := append([]*File{file}, file.Descendants()...)
+  var urls []string
+  for _, f := range restored {
+    if err := app.FileSystem.PublishFile(app.PublicDirectory(), f, &DefaultPublishFilter{}); err != nil {
+      return nil, err
+    }
+    app.SearchIndex().Add(f)
+    urls = append(urls, f.Url)
+  }
+  return file, app.changed(urls...)
+}
+
+// Remove a file and the files below it from the application
+// once they have been removed from disc.
+func (app *Application) detach(file *File) error {
+  // Files below a directory are deleted with the directory
+  removed := append([]*File{file}, file.Descendants()...)
+  var urls []string
+  for _, f := range removed {
+    app.unlink(f)
+    app.SearchIndex().Remove(f)
+    urls = append(urls, f.Url)
+  }
+  if file.parent != nil {
+    file.parent.removeChild(file)
+  }
+  return app.changed(urls...)
+}
+
+// Remove a file from the URL map and the lists of files and pages.
+func (app *Application) unlink(file *File) {
 	// Remove from the URL map
 	delete(app.Urls, file.Url)
 
@@ -227,6 +367,7 @@ func (app *Application) Del(file *File) error {
       before := app.Pages[0:i]
       after := app.Pages[i+1:]
       app.Pages = append(before, after...)
+      break
 		}
 	}
 
@@ -236,16 +377,9 @@ func (app *Application) Del(file *File) error {
       before := app.Files[0:i]
       after := app.Files[i+1:]
       app.Files = append(before, after...)
+      break
 		}
 	}
-
-	/*
-	if file.Directory {
-		return app.FileSystem.RemoveAll(file)
-	}
-	*/
-
-	return app.FileSystem.Remove(file)
 }
 
 // Add a file or page inspecting the file path to determine
@@ -263,6 +397,13 @@ func (app *Application) Add(file *File) error {
 		// Must add the file before page for computed proxied fields
 		app.AddFile(file)
 
+    // Add to the parent directory
+    if parent, err := app.ensureDirectory(parentUrl(file.Url)); err != nil {
+      return err
+    } else {
+      parent.addChild(file)
+    }
+
 		// Add to the list of pages
 		if pageType != PageNone {
 			page := &Page{file: file, Path: file.Path, Type: pageType}
@@ -281,6 +422,71 @@ func (app *Application) NewFile(path string, info os.FileInfo, data []byte) *Fil
 	return &File{Path: path, info: info, data: data, source: data}
 }
 
+// Check the page data of page content before it is saved so
+// that a page with an invalid publish date is not written.
+func (app *Application) validatePage(url, path string, content []byte) error {
+  pageType := app.GetPageType(path)
+  if pageType == PageNone {
+    return nil
+  }
+  page := &Page{file: &File{Path: path, source: content}, Path: path, Url: url, Type: pageType}
+  if _, err := page.parsePageData(); err != nil {
+    return err
+  }
+  _, err := page.PublishStatus(time.Now())
+  return err
+}
+
+// Get the root directory of the file tree, the root is
+// the source directory and is not in the list of files.
+func (app *Application) RootDirectory() *File {
+  if app.Root == nil {
+    info, _ := os.Stat(app.SourceDirectory())
+    app.Root = &File{
+      Path: app.SourceDirectory(), Url: SLASH, Uri: SLASH, Directory: true, Owner: app, info: info}
+  }
+  return app.Root
+}
+
+// Get the directory for a URL, a directory that has not been added
+// is created on disc when necessary and added to the application.
+func (app *Application) ensureDirectory(url string) (*File, error) {
+  if url == SLASH {
+    return app.RootDirectory(), nil
+  }
+  if dir := app.Urls[url]; dir != nil {
+    if !dir.Directory {
+      return nil, fmt.Errorf("Cannot use file %s as a directory", url)
+    }
+    return dir, nil
+  }
+  pth := app.GetPathFromUrl(url)
+  if err := os.MkdirAll(pth, os.ModeDir | 0755); err != nil {
+    return nil, err
+  }
+  info, err := os.Stat(pth)
+  if err != nil {
+    return nil, err
+  }
+  dir := app.NewFile(pth, info, nil)
+  dir.Directory = true
+  if err := app.Add(dir); err != nil {
+    return nil, err
+  }
+  // Directories are not renamed when published
+  dir.Uri = dir.Url
+  return dir, nil
+}
+
+// Get the URL of the parent directory for a file URL.
+func parentUrl(url string) string {
+  dir := path.Dir(strings.TrimSuffix(url, SLASH))
+  if dir == SLASH || dir == "." {
+    return SLASH
+  }
+  return dir + SLASH
+}
+
 // Add a file to this application.
 func (app *Application) AddFile(file *File) int {
 	app.setComputedFileFields(file)
@@ -352,6 +558,8 @@ func (app *Application) Load(path string) error {
 	app.Name = filepath.Base(path)
   app.SetPath(path)
   app.Urls = make(map[string] *File)
+  app.Root = nil
+  app.index = NewSearchIndex()
 
   if builder, err = ReadBuildFile(app); err != nil {
     return err
@@ -361,10 +569,43 @@ func (app *Application) Load(path string) error {
     app.Builder = builder
   }
 
+  // Invalid routing rules are ignored so the application is served
+  if app.Routes, err = ReadRoutesFile(app); err != nil {
+    Log.Warn("routes ignored", Fields{"app": app.Url, "error": err})
+    app.Routes = nil
+  }
+
   if err = app.FileSystem.Load(app.sourcePath); err != nil {
     return err
   }
 
+  for _, f := range app.Files {
+    app.index.Add(f)
+  }
+  return nil
+}
+
+// Reload the routes and publish the search index after files change.
+func (app *Application) changed(urls ...string) error {
+  if err := app.reloadRoutes(urls...); err != nil {
+    return err
+  }
+  return app.PublishSiteIndex(app.PublicDirectory())
+}
+
+// Read the routes file again when one of the file URLs
+// is the routes file.
+func (app *Application) reloadRoutes(urls ...string) error {
+  for _, u := range urls {
+    if u == SLASH + RoutesFileName {
+      routes, err := ReadRoutesFile(app)
+      if err != nil {
+        return err
+      }
+      app.Routes = routes
+      return nil
+    }
+  }
   return nil
 }
 
@@ -383,7 +624,50 @@ func (app *Application) Publish(dir string) error {
     app.Build(&DefaultTaskComplete{})
     return nil
   }
-  return app.FileSystem.Publish(dir, nil)
+  if err := app.FileSystem.Publish(dir, nil); err != nil {
+    return err
+  }
+  // Index the rendered text of the pages
+  for _, p := range app.Pages {
+    app.SearchIndex().Add(p.file)
+  }
+  return nil
+}
+
+// Publish the pages whose publish status changed since they were
+// last published, a publish date has passed or a page expired.
+func (app *Application) PublishScheduled(now time.Time) ([]*File, error) {
+  var files []*File
+  var urls []string
+  for _, p := range app.Pages {
+    status, err := p.PublishStatus(now)
+    if err != nil || p.Status == "" || status == p.Status {
+      continue
+    }
+    if err := app.FileSystem.PublishFile(app.PublicDirectory(), p.file, &DefaultPublishFilter{}); err != nil {
+      return files, err
+    }
+    app.SearchIndex().Add(p.file)
+    files = append(files, p.file)
+    urls = append(urls, p.file.Url)
+  }
+  if len(files) == 0 {
+    return nil, nil
+  }
+  return files, app.changed(urls...)
+}
+
+// Get the search index for the application files.
+func (app *Application) SearchIndex() *SearchIndex {
+  if app.index == nil {
+    app.index = NewSearchIndex()
+  }
+  return app.index
+}
+
+// Search the source and rendered page text of the application files.
+func (app *Application) Search(opts *SearchOptions) ([]*SearchResult, error) {
+  return app.SearchIndex().Search(opts)
 }
 
 // Get a file pointer by URL.
@@ -440,6 +724,99 @@ func (app *Application) PublishUrl() string {
 
 // Private methods
 
+// Save and publish a new file without reloading the routes or
+// publishing the site index, callers must call changed() once the
+// files are created.
+func (app *Application) create(url string, content []byte) (*File, error) {
+	path := app.GetPathFromUrl(url)
+
+	var err error
+	var fh *os.File
+	// The file must not exist in order to create
+	if fh, err = os.Open(path); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	if fh != nil {
+		defer fh.Close()
+	}
+
+  isDir := strings.HasSuffix(url, SLASH)
+
+  if url == SLASH + RoutesFileName {
+    if _, err := ParseRoutes(content); err != nil {
+      return nil, err
+    }
+  }
+
+  if !isDir {
+    if err := app.validatePage(url, path, content); err != nil {
+      return nil, err
+    }
+  }
+
+  file := app.NewFile(path, nil, content)
+  if isDir {
+    file.Directory = true
+  }
+	if err := app.FileSystem.SaveFile(file); err != nil {
+		return nil, err
+	}
+
+  // Must add before publish for all fields to be available
+	app.Add(file)
+
+	if err := app.FileSystem.PublishFile(app.PublicDirectory(), file, &DefaultPublishFilter{}); err != nil {
+		return nil, err
+	}
+  app.SearchIndex().Add(file)
+
+  return file, nil
+}
+
+// Save and publish new content for a file without reloading the
+// routes or publishing the site index, callers must call changed()
+// once the files are saved.
+func (app *Application) update(file *File, content []byte) error {
+	var err error
+	var fh *os.File
+	// The file must exist in order to create
+	if fh, err = os.Open(file.Path); err != nil {
+		return err
+	}
+	defer fh.Close()
+
+  if file.Url == SLASH + RoutesFileName {
+    if _, err := ParseRoutes(content); err != nil {
+      return err
+    }
+  }
+
+  if err := app.validatePage(file.Url, file.Path, content); err != nil {
+    return err
+  }
+
+	file.source = content
+  if file.page != nil {
+    if err := file.page.ParsePageData(); err != nil {
+      return err
+    }
+  } else {
+    // Update in-memory file data
+    file.data = content
+  }
+	if err := app.FileSystem.SaveFile(file); err != nil {
+		return err
+	}
+	if err := app.FileSystem.PublishFile(app.PublicDirectory(), file, &DefaultPublishFilter{}); err != nil {
+		return err
+	}
+  app.SearchIndex().Add(file)
+  return nil
+}
+
 // Extract a name, relative path and URL for a file.
 func (app *Application) getFileFields(file *File, base string) (string, string, string) {
 	name := filepath.Base(file.Path)
@@ -61,6 +61,15 @@ func (t *Task) Id() string {
   return t.Namespace + ":" + t.Key
 }
 
+// Get the container and application names from the task namespace.
+func (t *Task) Target() (string, string) {
+  parts := strings.SplitN(t.Namespace, ":", 2)
+  if len(parts) < 2 {
+    return parts[0], ""
+  }
+  return parts[0], parts[1]
+}
+
 // Abort this task
 func (t *Task) Abort() error {
   ps := t.Cmd.Process
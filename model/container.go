@@ -2,32 +2,51 @@ package model
 
 import (
 	"fmt"
+  "net"
   "errors"
   "regexp"
+  "strings"
 )
 
 var(
 	NamePattern string = `^[a-zA-Z0-9]+[-a-zA-Z0-9]*$`
 	NamePatternRe = regexp.MustCompile(NamePattern)
+	HostPattern string = `^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	HostPatternRe = regexp.MustCompile(HostPattern)
 )
 
 func ValidName(name string) bool {
   return NamePatternRe.MatchString(name)
 }
 
+// Test if a normalized name is a valid virtual host name.
+func ValidHost(host string) bool {
+  return len(host) <= 253 && HostPatternRe.MatchString(host)
+}
+
+// Normalize a host name for comparison, the name is converted to
+// lower case and any port and trailing dot are removed.
+func NormalizeHost(host string) string {
+  if h, _, err := net.SplitHostPort(host); err == nil {
+    host = h
+  }
+  return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
 // Contains a slice of applications.
 type Container struct {
 	Name string `json:"name"`
 	Description string `json:"description,omitempty"`
 	Apps []*Application `json:"apps,omitempty"`
 
-	// A protected container makes all it's applications protected
+	// Anonymous users cannot administer a protected container,
+	// assigned from the access policy.
 	Protected bool `json:"protected,omitempty"`
 }
 
 // Create a new container.
-func NewContainer(name string, description string, protected bool) *Container {
-	return &Container{Name: name, Description: description, Protected: protected}
+func NewContainer(name string, description string) *Container {
+	return &Container{Name: name, Description: description}
 }
 
 // Add an application to the container, the application must
@@ -51,7 +70,6 @@ func (c *Container) Add(app *Application) error {
 		return fmt.Errorf("Application exists with name %s", app.Name)
 	}
 
-	app.Protected = c.Protected
 	app.Container = c
   app.ContainerName = c.Name
 
@@ -2,8 +2,10 @@ package model
 
 import (
   "os"
+  "time"
   //"fmt"
 	"mime"
+  "sort"
   "strings"
   "path/filepath"
 )
@@ -51,6 +53,12 @@ type File struct {
 
 	// A corresponding page if this file represents a page
 	page *Page
+
+  // Parent directory, nil for the root directory
+  parent *File
+
+  // Direct children of a directory sorted by URL
+  children []*File
 }
 
 type DirectoryListing struct {
@@ -61,25 +69,70 @@ type DirectoryListing struct {
   Children []*File
 }
 
+// List the direct children of a directory.
 func (f *File) DirectoryListing () *DirectoryListing {
   listing := &DirectoryListing{Parent: f}
-  for _, child := range f.Owner.Urls {
-    if child == f {
+  for _, child := range f.children {
+    // Drafts, scheduled and expired pages are not listed
+    if child.page != nil && child.page.Unpublished() {
       continue
     }
-    if (strings.HasPrefix(child.Url, f.Url)) {
-      if child.Directory {
-        listing.Directories++
-      } else {
-        listing.Files++
-      }
-      listing.Children = append(listing.Children, child)
+    listing.Children = append(listing.Children, child)
+    if child.Directory {
+      listing.Directories++
+    } else {
+      listing.Files++
     }
   }
   listing.Length = len(listing.Children)
   return listing
 }
 
+// Get the parent directory, nil for the root directory.
+func (f *File) Parent() *File {
+  return f.parent
+}
+
+// Get a copy of the direct children of a directory.
+func (f *File) Children() []*File {
+  children := make([]*File, len(f.children))
+  copy(children, f.children)
+  return children
+}
+
+// Get all the files below a directory, parents are
+// listed before their children.
+func (f *File) Descendants() []*File {
+  var list []*File
+  for _, child := range f.children {
+    list = append(list, child)
+    list = append(list, child.Descendants()...)
+  }
+  return list
+}
+
+// Add a child keeping the children sorted by URL.
+func (f *File) addChild(child *File) {
+  child.parent = f
+  i := sort.Search(len(f.children), func(i int) bool {
+    return f.children[i].Url >= child.Url
+  })
+  f.children = append(f.children, nil)
+  copy(f.children[i+1:], f.children[i:])
+  f.children[i] = child
+}
+
+// Remove a child from this directory.
+func (f *File) removeChild(child *File) {
+  for i, c := range f.children {
+    if c == child {
+      f.children = append(f.children[:i], f.children[i+1:]...)
+      break
+    }
+  }
+  child.parent = nil
+}
+
 // TODO: http.File implementation
 func (f *File) Seek(offset int64, whence int) (int64, error) {
 	return 0, nil
@@ -128,6 +181,15 @@ func (f *File) Info() os.FileInfo {
 	return f.info
 }
 
+// Get the modification time of the source file, the zero
+// time when the file has not been written to disc.
+func (f *File) ModTime() time.Time {
+  if f.info == nil {
+    return time.Time{}
+  }
+  return f.info.ModTime()
+}
+
 func getMimeType(path string) string {
 	m := mime.TypeByExtension(filepath.Ext(path))
 	if m == "" {
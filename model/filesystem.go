@@ -2,6 +2,8 @@ package model
 
 import(
   "os"
+  "mime"
+  "time"
 	"errors"
 	"strings"
 	"net/http"
@@ -44,6 +46,10 @@ type ApplicationFileSystem interface {
 	Remove(f *File) error
 	RemoveAll(f *File) error
 
+	// Move the source files for a file reference to a path outside
+	// the application and remove the published files
+	Discard(f *File, dest string) error
+
 	// Save the source file to the underlying file system
 	SaveFile(f *File) error
 
@@ -65,8 +71,12 @@ type FileFilter interface {
 
 type DefaultPublishFilter struct {}
 
-// Default file filter used during publishing.
+// Default file filter used during publishing, the routes file
+// is never published.
 func (f *DefaultPublishFilter) Rename(path string) string {
+  if filepath.Clean(path) == RoutesFileName {
+    return ""
+  }
 	name := filepath.Base(path)
 	ext := filepath.Ext(path)
 	if ext == ".md" || ext == ".markdown" {
@@ -105,6 +115,13 @@ func (fs *UrlFileSystem) MoveFile(f *File, url string, target string, filter Fil
   }
 
   base := f.Owner.SourceDirectory()
+
+  // Files ignored by the filter do not have a published file
+  var published bool
+  if rel, err = filepath.Rel(base, f.Path); err == nil {
+    published = filter.Rename(rel) != ""
+  }
+
   parts := strings.Split(url, SLASH)
   destPath := filepath.Join(parts...)
   destPath = filepath.Join(base, destPath)
@@ -114,6 +131,17 @@ func (fs *UrlFileSystem) MoveFile(f *File, url string, target string, filter Fil
     return err
   }
 
+  // Put the source file back when the published file cannot be moved
+  oldPath, oldUri := f.Path, f.Uri
+  undo := func(err error) error {
+    os.Rename(destPath, oldPath)
+    f.Path, f.Uri = oldPath, oldUri
+    if f.page != nil {
+      f.page.Uri = oldUri
+    }
+    return err
+  }
+
   base = f.Owner.PublicDirectory()
   parts = strings.Split(f.Uri, SLASH)
   publishPath := filepath.Join(parts...)
@@ -122,14 +150,22 @@ func (fs *UrlFileSystem) MoveFile(f *File, url string, target string, filter Fil
   // Update path before filter
   f.Path = target
   if rel, _, err = fs.FilterAndAssign(f, filter); err != nil {
-    return err
+    return undo(err)
   }
 
-  // Filter says do nothing
+  // Filter says do nothing, remove the file published for the old name
   if (rel == "") {
+    if published {
+      return unpublish(publishPath)
+    }
     return nil
   }
 
+  // Publish a file that was ignored by the filter for the old name
+  if !published {
+    return fs.PublishFile(base, f, filter)
+  }
+
   filteredName := filepath.Base(rel)
 
   parts = strings.Split(path.Dir(url), SLASH)
@@ -137,9 +173,22 @@ func (fs *UrlFileSystem) MoveFile(f *File, url string, target string, filter Fil
   newPath = filepath.Join(base, newPath)
   newPath = filepath.Join(newPath, filteredName)
 
-  // Move published file
+  if err := os.MkdirAll(filepath.Dir(newPath), os.ModeDir | 0755); err != nil {
+    return undo(err)
+  }
+
+  // Move published file, pages that are not published have no file
   if err := os.Rename(publishPath, newPath); err != nil {
-    return err
+    if os.IsNotExist(err) && f.page != nil && f.page.Unpublished() {
+      return nil
+    }
+    return undo(err)
+  }
+
+  // Move the precompressed copy
+  if err := os.Rename(publishPath + GzipExt, newPath + GzipExt); err != nil && !os.IsNotExist(err) {
+    os.Rename(newPath, publishPath)
+    return undo(err)
   }
 
   return nil
@@ -260,6 +309,15 @@ func (fs *UrlFileSystem) PublishFile(dir string, f *File, filter FileFilter) err
 		if err = f.page.Update(); err != nil {
 			return err
 		}
+    if f.page.Status, err = f.page.PublishStatus(time.Now()); err != nil {
+      // Do not fail loading the application for a bad date
+      Log.Warn("page not published", Fields{"url": f.Url, "error": err})
+      f.page.Status = PageStatusInvalid
+    }
+    // Drafts, scheduled and expired pages are only rendered for preview
+    if f.page.Unpublished() {
+      return unpublish(out)
+    }
 	}
 
 
@@ -282,10 +340,37 @@ func (fs *UrlFileSystem) PublishFile(dir string, f *File, filter FileFilter) err
 		if err = ioutil.WriteFile(out, f.data, mode); err != nil {
 			return err
 		}
+		if err = writeCompressed(out, f.data, mode); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// Remove a published file and the compressed copy, a file
+// that was not published is ignored.
+func unpublish(out string) error {
+  for _, name := range []string{out, out + GzipExt} {
+    if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+      return err
+    }
+  }
+  return nil
+}
+
+// Write a gzip copy of a published file so that it can be served
+// without compressing each response, a stale copy is removed when
+// the file is no longer worth compressing.
+func writeCompressed(out string, data []byte, mode os.FileMode) error {
+  if len(data) >= CompressMinSize && Compressible(mime.TypeByExtension(filepath.Ext(out))) {
+    return WriteGzip(out + GzipExt, data, mode)
+  }
+  if err := os.Remove(out + GzipExt); err != nil && !os.IsNotExist(err) {
+    return err
+  }
+  return nil
+}
+
 // Publishes the application to a directory.
 //
 // Writes all application files using the current data bytes.
@@ -331,7 +416,7 @@ func (fs *UrlFileSystem) Publish(dir string, filter FileFilter) error {
 			return err
 		}
   }
-  return nil
+  return app.PublishSiteIndex(dir)
 }
 
 // Save the source file back to disc from the current source data.
@@ -398,7 +483,7 @@ func (fs *UrlFileSystem) Remove(f *File) error {
 	src := f.Path
   uri := filepath.Join(path.Split(f.Uri))
 	pub := filepath.Join(app.PublicDirectory(), uri)
-	if err := os.Remove(pub); err != nil {
+	if err := unpublish(pub); err != nil {
 		return err
 	}
 	return os.Remove(src)
@@ -406,12 +491,62 @@ func (fs *UrlFileSystem) Remove(f *File) error {
 
 // Recursively deletes a directory including source and
 // published versions of the files.
+//
+// The directories are moved aside before they are deleted so
+// a failure does not leave a partially deleted tree.
 func (fs *UrlFileSystem) RemoveAll(f *File) error {
 	app := fs.App()
 	src := f.Path
 	pub := filepath.Join(app.PublicDirectory(), f.Relative)
-	if err := os.RemoveAll(pub); err != nil {
-		return err
+
+  tmp, err := ioutil.TempDir(app.Path, ".delete-")
+  if err != nil {
+    return err
+  }
+  defer os.RemoveAll(tmp)
+
+  if err := os.Rename(src, filepath.Join(tmp, SOURCE)); err != nil {
+    return err
+  }
+  if err := os.Rename(pub, filepath.Join(tmp, PUBLIC)); err != nil && !os.IsNotExist(err) {
+    os.Rename(filepath.Join(tmp, SOURCE), src)
+    return err
+  }
+  return nil
+}
+
+// Move the source file or directory to dest and delete the published
+// versions, the source is moved back when the published files cannot
+// be removed.
+func (fs *UrlFileSystem) Discard(f *File, dest string) error {
+	app := fs.App()
+	src := f.Path
+	pub := filepath.Join(app.PublicDirectory(), filepath.Join(path.Split(f.Uri)))
+	if f.Directory {
+		pub = filepath.Join(app.PublicDirectory(), f.Relative)
 	}
-	return os.RemoveAll(src)
+
+  // The destination may be on another file system
+  if err := MoveFile(src, dest); err != nil {
+    return err
+  }
+
+  // Move the published files aside so they are removed together
+  tmp, err := ioutil.TempDir(app.Path, ".delete-")
+  if err != nil {
+    MoveFile(dest, src)
+    return err
+  }
+  defer os.RemoveAll(tmp)
+
+  if err := os.Rename(pub, filepath.Join(tmp, PUBLIC)); err != nil && !os.IsNotExist(err) {
+    MoveFile(dest, src)
+    return err
+  }
+  if err := os.Rename(pub + GzipExt, filepath.Join(tmp, PUBLIC) + GzipExt); err != nil && !os.IsNotExist(err) {
+    os.Rename(filepath.Join(tmp, PUBLIC), pub)
+    MoveFile(dest, src)
+    return err
+  }
+  return nil
 }
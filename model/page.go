@@ -2,8 +2,9 @@
 package model
 
 import(
-  //"fmt"
   "os"
+  "fmt"
+  "time"
   "bytes"
 	"strings"
 	"regexp"
@@ -28,11 +29,29 @@ const(
 	Layout = "layout.html"
 	Content = "content"
 
+  // Publish status of a page determined from the page data.
+  PageStatusPublished = "published"
+  PageStatusDraft = "draft"
+  PageStatusScheduled = "scheduled"
+  PageStatusExpired = "expired"
+  // Page data dates could not be parsed.
+  PageStatusInvalid = "invalid"
+
 )
 
 var(
 	FragmentTop = regexp.MustCompile(`^<html><head></head><body>`)
 	FragmentTail = regexp.MustCompile(`</body></html>$`)
+
+  // Formats accepted for the publishDate and expiryDate page data,
+  // times without a zone are in the server time zone.
+  pageDateLayouts = []string{
+    time.RFC3339,
+    "2006-01-02T15:04:05",
+    "2006-01-02 15:04:05",
+    "2006-01-02T15:04",
+    "2006-01-02 15:04",
+    "2006-01-02"}
 )
 
 type Page struct {
@@ -49,6 +68,10 @@ type Page struct {
   Blocks []Block  `json:"blocks,omitempty"`
   Dom *vdom.Vdom `json:"-"`
 
+  // Publish status when the page was last published, pages
+  // that are not published can only be previewed.
+  Status string `json:"status,omitempty"`
+
 	Type int `json:"-"`
 
 	// Owner application
@@ -111,6 +134,53 @@ func (p *Page) Parse(data []byte) (*vdom.Vdom, error) {
   return p.Dom, nil
 }
 
+// Determine the publish status of a page at a time from the draft,
+// publishDate and expiryDate page data.
+func (p *Page) PublishStatus(now time.Time) (string, error) {
+  if draft, ok := p.PageData["draft"].(bool); ok && draft {
+    return PageStatusDraft, nil
+  }
+  publish, err := p.pageDate("publishDate")
+  if err != nil {
+    return "", err
+  }
+  expiry, err := p.pageDate("expiryDate")
+  if err != nil {
+    return "", err
+  }
+  if !publish.IsZero() && publish.After(now) {
+    return PageStatusScheduled, nil
+  }
+  if !expiry.IsZero() && !expiry.After(now) {
+    return PageStatusExpired, nil
+  }
+  return PageStatusPublished, nil
+}
+
+// Determine if the page was left out of the public directory
+// when it was last published.
+func (p *Page) Unpublished() bool {
+  return p.Status != "" && p.Status != PageStatusPublished
+}
+
+// Get a time from the page data, the zero time when the
+// field is not set.
+func (p *Page) pageDate(name string) (time.Time, error) {
+  switch value := p.PageData[name].(type) {
+    case nil:
+      return time.Time{}, nil
+    case time.Time:
+      return value, nil
+    case string:
+      for _, layout := range pageDateLayouts {
+        if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+          return t, nil
+        }
+      }
+  }
+  return time.Time{}, fmt.Errorf("Invalid %s %v in %s, use a date such as 2006-01-02 or 2006-01-02T15:04:05Z", name, p.PageData[name], p.Url)
+}
+
 // Attempts to find a layout.html file for a page.
 //
 // Starts by looking in the directory containing the file
@@ -1,9 +1,12 @@
 package model
 
 import (
-  //"os"
+  "os"
+  "time"
   "testing"
+  "io/ioutil"
   "encoding/json"
+  "path/filepath"
 )
 
 func TestBlock(t *testing.T) {
@@ -73,3 +76,68 @@ func TestJson(t *testing.T) {
   }
   */
 }
+
+func TestPublishStatus(t *testing.T) {
+  now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+  var tests = []struct {
+    data map[string]interface{}
+    expected string
+  }{
+    {nil, PageStatusPublished},
+    {map[string]interface{}{"draft": true}, PageStatusDraft},
+    {map[string]interface{}{"draft": false, "publishDate": "2026-03-09"}, PageStatusPublished},
+    {map[string]interface{}{"publishDate": "2026-03-10T13:00:00Z"}, PageStatusScheduled},
+    {map[string]interface{}{"publishDate": now.Add(time.Hour)}, PageStatusScheduled},
+    {map[string]interface{}{"expiryDate": "2026-03-10T12:00:00Z"}, PageStatusExpired},
+    {map[string]interface{}{"expiryDate": "2026-03-11T00:00:00+02:00"}, PageStatusPublished},
+  }
+
+  for _, test := range tests {
+    p := &Page{PageData: test.data}
+    if status, err := p.PublishStatus(now); err != nil || status != test.expected {
+      t.Errorf("Expected %s for %v, got %s %v", test.expected, test.data, status, err)
+    }
+  }
+
+  p := &Page{Url: "/post.md", PageData: map[string]interface{}{"publishDate": "next week"}}
+  if _, err := p.PublishStatus(now); err == nil {
+    t.Errorf("Expected error for invalid publish date")
+  }
+
+  // Pages that were never published are not hidden
+  if (&Page{}).Unpublished() || !(&Page{Status: PageStatusExpired}).Unpublished() {
+    t.Errorf("Unexpected unpublished state")
+  }
+}
+
+func TestInvalidPublishDate(t *testing.T) {
+  // An existing page with a bad date is loaded but not published
+  bad := "---\npublishDate: next week\n---\n# Post\n"
+  app, dir := loadTestApp(t, "blog", map[string]string{"old.md": bad})
+  defer os.RemoveAll(dir)
+  if err := app.Publish(app.PublicDirectory()); err != nil {
+    t.Fatal(err)
+  }
+  if page := app.Urls["/old.md"].Page(); page.Status != PageStatusInvalid {
+    t.Errorf("Expected invalid status, got %s", page.Status)
+  }
+
+  // New and updated pages with a bad date are not saved
+  if _, err := app.Create("/new.md", []byte(bad)); err == nil {
+    t.Errorf("Expected error creating page with invalid publish date")
+  }
+  if _, err := os.Stat(filepath.Join(app.SourceDirectory(), "new.md")); !os.IsNotExist(err) {
+    t.Errorf("Expected page with invalid publish date not to be written")
+  }
+  good := "---\ntitle: Post\n---\n# Post\n"
+  if err := app.Update(app.Urls["/old.md"], []byte(good)); err != nil {
+    t.Fatal(err)
+  }
+  if err := app.Update(app.Urls["/old.md"], []byte(bad)); err == nil {
+    t.Errorf("Expected error updating page with invalid publish date")
+  }
+  if content, _ := ioutil.ReadFile(filepath.Join(app.SourceDirectory(), "old.md")); string(content) != good {
+    t.Errorf("Expected page source to be unchanged, got %q", content)
+  }
+}
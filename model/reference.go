@@ -100,6 +100,10 @@ func (asset *AssetReference) FindFile(host *Host) (*Container, *Application, *Fi
       return nil, nil, nil, CommandError(http.StatusBadRequest, err.Error())
     }
     file := application.Urls[asset.url]
+    // Directory referenced without a trailing slash
+    if file == nil && !strings.HasSuffix(asset.url, SLASH) {
+      file = application.Urls[asset.url + SLASH]
+    }
     if file == nil {
       return nil, nil, nil, CommandError(http.StatusNotFound, "File %s not found", asset.url)
     }
@@ -107,6 +111,24 @@ func (asset *AssetReference) FindFile(host *Host) (*Container, *Application, *Fi
   }
 }
 
+// Attempt to find a directory matching this reference, an empty
+// file url references the root directory of the application.
+func (asset *AssetReference) FindDirectory(host *Host) (*Container, *Application, *File, *StatusError) {
+  if container, application, err := asset.FindApplication(host); err != nil {
+    return nil, nil, nil, err
+  } else {
+    if asset.url == "" || asset.url == SLASH {
+      return container, application, application.RootDirectory(), nil
+    }
+    url := strings.TrimSuffix(asset.url, SLASH) + SLASH
+    file := application.Urls[url]
+    if file == nil || !file.Directory {
+      return nil, nil, nil, CommandError(http.StatusNotFound, "Directory %s not found", url)
+    }
+    return container, application, file, nil
+  }
+}
+
 // Parse a URL into this asset reference.
 func (asset *AssetReference) ParseUrl(uri string) (ref Reference, err error) {
   var u *url.URL
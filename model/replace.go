@@ -0,0 +1,107 @@
+package model
+
+import(
+  "fmt"
+  "sort"
+  "regexp"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+// Criteria for a find and replace across the files of an application.
+type ReplaceOptions struct {
+  // Text to find, a regular expression when Regexp is set.
+  Pattern string
+  // Replacement text, a regular expression replacement may
+  // refer to submatches, eg: $1 or ${name}
+  Replacement string
+  Regexp bool
+  // Glob of files to change, a glob without a slash is matched
+  // against the file name, eg: *.md or /docs/*
+  Include string
+  // Glob of files to leave unchanged.
+  Exclude string
+  // Preview the changes without saving any files.
+  DryRun bool
+}
+
+// Changes made to a file by a find and replace.
+type ReplaceResult struct {
+  Url string `json:"url"`
+  // Number of replacements in the file.
+  Count int `json:"count"`
+  // Unified diff of the changed lines.
+  Diff string `json:"diff,omitempty"`
+
+  source []byte
+  content []byte
+}
+
+// Replace a pattern in the source of every text file in the application.
+//
+// A dry run returns the results with a diff for each file that
+// would change, otherwise the files are saved and published as
+// a batch; when a file cannot be saved the files already saved
+// are reverted.
+func (app *Application) Replace(opts *ReplaceOptions) ([]*ReplaceResult, error) {
+  if opts.Pattern == "" {
+    return nil, fmt.Errorf("Replace pattern is empty")
+  }
+  expr := regexp.QuoteMeta(opts.Pattern)
+  if opts.Regexp {
+    expr = opts.Pattern
+  }
+  re, err := regexp.Compile(expr)
+  if err != nil {
+    return nil, err
+  }
+  replacement := []byte(opts.Replacement)
+
+  results := make([]*ReplaceResult, 0)
+  for _, file := range app.Files {
+    if file.Directory || file.Binary {
+      continue
+    }
+    if opts.Include != "" && !matchGlob(opts.Include, file) {
+      continue
+    }
+    if opts.Exclude != "" && matchGlob(opts.Exclude, file) {
+      continue
+    }
+    source := append([]byte(nil), file.Source(true)...)
+    matches := re.FindAllIndex(source, -1)
+    if len(matches) == 0 {
+      continue
+    }
+    var content []byte
+    if opts.Regexp {
+      content = re.ReplaceAll(source, replacement)
+    } else {
+      content = re.ReplaceAllLiteral(source, replacement)
+    }
+    result := &ReplaceResult{Url: file.Url, Count: len(matches), source: source, content: content}
+    if opts.DryRun {
+      result.Diff = UnifiedDiff(file.Url, source, content)
+    }
+    results = append(results, result)
+  }
+  sort.Slice(results, func(i, j int) bool {
+    return results[i].Url < results[j].Url
+  })
+
+  if opts.DryRun {
+    return results, nil
+  }
+  // Save all the files before the routes and site index are updated once
+  var urls []string
+  for i, result := range results {
+    if err := app.update(app.Urls[result.Url], result.content); err != nil {
+      // Restore the previous content of this file and those already saved
+      for _, prev := range results[:i + 1] {
+        app.update(app.Urls[prev.Url], prev.source)
+      }
+      return nil, fmt.Errorf("Replace failed for %s, changes reverted: %s", result.Url, err)
+    }
+    urls = append(urls, result.Url)
+  }
+  return results, app.changed(urls...)
+}
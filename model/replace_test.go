@@ -0,0 +1,55 @@
+package model
+
+import (
+  "os"
+  "strings"
+  "testing"
+  "io/ioutil"
+  "path/filepath"
+)
+
+func TestReplace(t *testing.T) {
+  files := map[string]string{
+    "products.txt": "Acme rockets\nAcme anvils\n",
+    "docs/about.txt": "About Acme Corp\n",
+    "docs/legal.txt": "Acme Corp is a trademark\n"}
+  app, dir := loadTestApp(t, "shop", files)
+  defer os.RemoveAll(dir)
+
+  // A dry run previews the changes
+  results, err := app.Replace(&ReplaceOptions{Pattern: "Acme", Replacement: "Wile", Exclude: "legal.txt", DryRun: true})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(results) != 2 || results[0].Url != "/docs/about.txt" || results[1].Count != 2 {
+    t.Fatalf("Unexpected results %v", results)
+  }
+  if !strings.Contains(results[1].Diff, "-Acme anvils\n+Wile rockets\n") {
+    t.Errorf("Unexpected diff %q", results[1].Diff)
+  }
+  if string(app.Urls["/products.txt"].Source(true)) != files["products.txt"] {
+    t.Errorf("Expected dry run to leave files unchanged")
+  }
+
+  // Regular expression replacements are saved and published
+  results, err = app.Replace(&ReplaceOptions{Pattern: `Acme (\w+)`, Replacement: "$1 by Wile", Regexp: true, Include: "/docs/*"})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(results) != 2 || results[0].Diff != "" {
+    t.Fatalf("Unexpected results %v", results)
+  }
+  if content, _ := ioutil.ReadFile(filepath.Join(app.SourceDirectory(), "docs", "legal.txt")); string(content) != "Corp by Wile is a trademark\n" {
+    t.Errorf("Unexpected source %q", content)
+  }
+  if content, _ := ioutil.ReadFile(filepath.Join(app.PublicDirectory(), "docs", "about.txt")); string(content) != "About Corp by Wile\n" {
+    t.Errorf("Unexpected published file %q", content)
+  }
+  if results, _ := app.Search(&SearchOptions{Query: "wile"}); len(results) != 2 {
+    t.Errorf("Expected changed files to be indexed, got %d", len(results))
+  }
+
+  if _, err := app.Replace(&ReplaceOptions{Pattern: "(", Regexp: true}); err == nil {
+    t.Errorf("Expected error for invalid pattern")
+  }
+}
@@ -0,0 +1,174 @@
+package model
+
+import(
+  "os"
+  "fmt"
+  "strings"
+  "io/ioutil"
+  "net/http"
+  "path/filepath"
+  "gopkg.in/yaml.v2"
+)
+
+const(
+  RoutesFileName = "_routes.yml"
+
+  // Placeholder in a redirect or rewrite target replaced
+  // by the path matched by the wildcard.
+  Splat = ":splat"
+)
+
+// Application routing rules loaded from _routes.yml in the
+// source directory and applied when serving published files.
+//
+// Paths are relative to the application root and may end with
+// a * wildcard that matches the rest of the path.
+type RoutesFile struct {
+  // Redirects are applied before files are served
+  Redirects []*Redirect `json:"redirects,omitempty" yaml:"redirects"`
+
+  // Rewrites are applied when no published file exists
+  Rewrites []*Rewrite `json:"rewrites,omitempty" yaml:"rewrites"`
+
+  // Response headers for matching paths
+  Headers []*HeaderRule `json:"headers,omitempty" yaml:"headers"`
+
+  // Published file sent when no file exists for a path
+  NotFound string `json:"not-found,omitempty" yaml:"not-found"`
+}
+
+type Redirect struct {
+  From string `json:"from" yaml:"from"`
+  To string `json:"to" yaml:"to"`
+  // Redirect status code, default is 301
+  Status int `json:"status" yaml:"status"`
+}
+
+type Rewrite struct {
+  From string `json:"from" yaml:"from"`
+  To string `json:"to" yaml:"to"`
+}
+
+type HeaderRule struct {
+  Path string `json:"path" yaml:"path"`
+  Values map[string]string `json:"values" yaml:"values"`
+}
+
+// Parse and validate routing rules.
+func ParseRoutes(content []byte) (*RoutesFile, error) {
+  var routes *RoutesFile = &RoutesFile{}
+  if err := yaml.Unmarshal(content, routes); err != nil {
+    return nil, err
+  }
+  for _, r := range routes.Redirects {
+    if err := checkRoutePath(r.From); err != nil {
+      return nil, err
+    }
+    if r.To == "" {
+      return nil, fmt.Errorf("Redirect from %s does not have a target", r.From)
+    }
+    if r.Status == 0 {
+      r.Status = http.StatusMovedPermanently
+    }
+    switch r.Status {
+      case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+        http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+      default:
+        return nil, fmt.Errorf("Redirect from %s has invalid status %d", r.From, r.Status)
+    }
+  }
+  for _, r := range routes.Rewrites {
+    if err := checkRoutePath(r.From); err != nil {
+      return nil, err
+    }
+    if err := checkRoutePath(r.To); err != nil {
+      return nil, err
+    }
+  }
+  for _, h := range routes.Headers {
+    if err := checkRoutePath(h.Path); err != nil {
+      return nil, err
+    }
+  }
+  if routes.NotFound != "" {
+    if err := checkRoutePath(routes.NotFound); err != nil {
+      return nil, err
+    }
+  }
+  return routes, nil
+}
+
+// Read the routes file for an application, returns nil when
+// the application does not have a routes file.
+func ReadRoutesFile(app *Application) (*RoutesFile, error) {
+  var input string = filepath.Join(app.SourceDirectory(), RoutesFileName)
+  content, err := ioutil.ReadFile(input)
+  if err != nil {
+    if os.IsNotExist(err) {
+      return nil, nil
+    }
+    return nil, err
+  }
+  routes, err := ParseRoutes(content)
+  if err != nil {
+    return nil, fmt.Errorf("%s: %s", input, err.Error())
+  }
+  return routes, nil
+}
+
+// Get the target and status code of the first redirect matching a path.
+func (r *RoutesFile) MatchRedirect(path string) (string, int) {
+  for _, rule := range r.Redirects {
+    if splat, ok := MatchRoute(rule.From, path); ok {
+      return strings.Replace(rule.To, Splat, splat, -1), rule.Status
+    }
+  }
+  return "", 0
+}
+
+// Get the target of the first rewrite matching a path.
+func (r *RoutesFile) MatchRewrite(path string) string {
+  for _, rule := range r.Rewrites {
+    if splat, ok := MatchRoute(rule.From, path); ok {
+      return strings.Replace(rule.To, Splat, splat, -1)
+    }
+  }
+  return ""
+}
+
+// Get the headers for a path, later rules replace values
+// assigned by earlier rules.
+func (r *RoutesFile) MatchHeaders(path string) map[string]string {
+  headers := make(map[string]string)
+  for _, rule := range r.Headers {
+    if _, ok := MatchRoute(rule.Path, path); ok {
+      for k, v := range rule.Values {
+        headers[k] = v
+      }
+    }
+  }
+  return headers
+}
+
+// Match a path against a route pattern, a trailing * matches the
+// rest of the path which is returned as the splat.
+func MatchRoute(pattern string, path string) (string, bool) {
+  if strings.HasSuffix(pattern, "*") {
+    prefix := strings.TrimSuffix(pattern, "*")
+    if strings.HasPrefix(path, prefix) {
+      return strings.TrimPrefix(path, prefix), true
+    }
+    return "", false
+  }
+  return "", pattern == path
+}
+
+func checkRoutePath(path string) error {
+  if !strings.HasPrefix(path, "/") {
+    return fmt.Errorf("Route path %s must begin with a slash", path)
+  }
+  if strings.Contains(strings.TrimSuffix(path, "*"), "*") {
+    return fmt.Errorf("Route path %s may only have a wildcard at the end", path)
+  }
+  return nil
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+  "os"
+  "testing"
+  "path/filepath"
+)
+
+func TestRoutesFileNotPublished(t *testing.T) {
+  // Invalid routing rules are ignored
+  app, dir := loadTestApp(t, "blog", map[string]string{
+    "index.html": "<p>Index</p>",
+    RoutesFileName: "redirects:\n  - from: old\n    to: /new\n"})
+  defer os.RemoveAll(dir)
+  if app.Routes != nil {
+    t.Errorf("Expected invalid routes to be ignored")
+  }
+  if err := app.Publish(app.PublicDirectory()); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := os.Stat(filepath.Join(app.PublicDirectory(), RoutesFileName)); !os.IsNotExist(err) {
+    t.Errorf("Expected routes file not to be published")
+  }
+
+  if err := app.Update(app.Urls["/" + RoutesFileName], []byte("not-found: /404.html\n")); err != nil {
+    t.Fatal(err)
+  }
+  if app.Routes == nil || app.Routes.NotFound != "/404.html" {
+    t.Errorf("Expected routes to be loaded after update")
+  }
+  if _, err := os.Stat(filepath.Join(app.PublicDirectory(), RoutesFileName)); !os.IsNotExist(err) {
+    t.Errorf("Expected updated routes file not to be published")
+  }
+
+  // Moving the routes file publishes it under the new name
+  if err := app.Move(app.Urls["/" + RoutesFileName], "/routes.yml"); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := os.Stat(filepath.Join(app.PublicDirectory(), "routes.yml")); err != nil {
+    t.Errorf("Expected moved routes file to be published, %s", err)
+  }
+}
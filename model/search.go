@@ -0,0 +1,528 @@
+package model
+
+import(
+  "fmt"
+  "math"
+  "bytes"
+  "path"
+  "sort"
+  "sync"
+  "strings"
+  "unicode"
+  "unicode/utf8"
+  "golang.org/x/net/html"
+)
+
+const(
+  // Fields a match is found in.
+  SearchSource = "source"
+  SearchPage = "page"
+
+  // Default maximum number of results.
+  SearchLimit = 50
+
+  // Maximum number of matching lines for each result.
+  searchMatches = 5
+
+  // Maximum length of a snippet, longer lines are cut around the first match.
+  searchSnippet = 160
+)
+
+var(
+  // Elements that end a line in the rendered text of a page.
+  blockElements = map[string]bool{
+    "address": true, "article": true, "aside": true, "blockquote": true, "br": true,
+    "dd": true, "div": true, "dl": true, "dt": true, "figcaption": true, "figure": true,
+    "footer": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+    "header": true, "hr": true, "li": true, "main": true, "nav": true, "ol": true,
+    "p": true, "pre": true, "section": true, "table": true, "td": true, "th": true,
+    "title": true, "tr": true, "ul": true}
+)
+
+// Criteria for a search.
+type SearchOptions struct {
+  // Words that must all match, quoted words match a phrase.
+  Query string
+  // MIME type of matching files, a type ending with /* matches
+  // all the subtypes, eg: text/*
+  Mime string
+  // Glob matched against file URLs, a glob without a slash is
+  // matched against the file name, eg: *.md or /docs/*
+  Path string
+  // Maximum number of results, zero uses the default limit.
+  Limit int
+}
+
+// A file matching a search.
+type SearchResult struct {
+  Container string `json:"container,omitempty"`
+  Application string `json:"application,omitempty"`
+  Url string `json:"url"`
+  Name string `json:"name"`
+  Mime string `json:"mime"`
+  // Relevance of the file, higher scores are better matches.
+  Score float64 `json:"score"`
+  Matches []*SearchMatch `json:"matches"`
+}
+
+// A line containing words that matched a search.
+type SearchMatch struct {
+  // Either source or page for the rendered text of a page.
+  Field string `json:"field"`
+  // Line number starting at one.
+  Line int `json:"line"`
+  // Text of the line, long lines are cut around the first match.
+  Text string `json:"text"`
+  // Byte offsets of the matched words in the text.
+  Highlights [][2]int `json:"highlights"`
+}
+
+// Inverted index for the source and rendered page text of
+// application files, the positions of each word are kept
+// so that phrases can be matched.
+type SearchIndex struct {
+  // Positions of words in each document by word.
+  words map[string]map[*File]*searchPosting
+  docs map[*File]*searchDocument
+  mu sync.RWMutex
+}
+
+// Indexed text for a file.
+type searchDocument struct {
+  source string
+  page string
+  length int
+  words []string
+}
+
+// Word positions in each field of a document.
+type searchPosting struct {
+  source []int
+  page []int
+}
+
+// A word found in text.
+type searchToken struct {
+  word string
+  start int
+  end int
+}
+
+// Create an empty search index.
+func NewSearchIndex() *SearchIndex {
+  return &SearchIndex{
+    words: make(map[string]map[*File]*searchPosting),
+    docs: make(map[*File]*searchDocument)}
+}
+
+// Add a file to the index replacing any previous text for the
+// file, directories and binary files are not indexed.
+func (idx *SearchIndex) Add(file *File) {
+  if file.Directory || file.Binary {
+    idx.Remove(file)
+    return
+  }
+  doc := &searchDocument{source: string(file.Source(true))}
+  if page := file.Page(); page != nil && page.Dom != nil {
+    doc.page = pageText(page.Dom.Document)
+  }
+
+  postings := make(map[string]*searchPosting)
+  posting := func(word string) *searchPosting {
+    if postings[word] == nil {
+      postings[word] = &searchPosting{}
+      doc.words = append(doc.words, word)
+    }
+    return postings[word]
+  }
+  for i, t := range tokenize(doc.source) {
+    p := posting(t.word)
+    p.source = append(p.source, i)
+    doc.length++
+  }
+  for i, t := range tokenize(doc.page) {
+    p := posting(t.word)
+    p.page = append(p.page, i)
+    doc.length++
+  }
+
+  idx.mu.Lock()
+  defer idx.mu.Unlock()
+  idx.remove(file)
+  idx.docs[file] = doc
+  for word, p := range postings {
+    if idx.words[word] == nil {
+      idx.words[word] = make(map[*File]*searchPosting)
+    }
+    idx.words[word][file] = p
+  }
+}
+
+// Remove a file from the index.
+func (idx *SearchIndex) Remove(file *File) {
+  idx.mu.Lock()
+  defer idx.mu.Unlock()
+  idx.remove(file)
+}
+
+// Get the files matching a search ordered by score.
+func (idx *SearchIndex) Search(opts *SearchOptions) ([]*SearchResult, error) {
+  clauses := parseQuery(opts.Query)
+  if len(clauses) == 0 {
+    return nil, fmt.Errorf("Search query does not contain any words")
+  }
+  if opts.Path != "" {
+    if _, err := path.Match(opts.Path, ""); err != nil {
+      return nil, fmt.Errorf("Invalid path glob %s", opts.Path)
+    }
+  }
+
+  idx.mu.RLock()
+  defer idx.mu.RUnlock()
+
+  // Candidates must contain every word
+  var candidates map[*File]*searchPosting
+  for i, c := range clauses {
+    for j, word := range c {
+      if (i == 0 && j == 0) || len(idx.words[word]) < len(candidates) {
+        candidates = idx.words[word]
+      }
+    }
+  }
+
+  results := make([]*SearchResult, 0)
+  for file := range candidates {
+    if !matchFile(file, opts) {
+      continue
+    }
+    var score float64
+    var fields = make(map[string]bool)
+    matched := true
+    for _, c := range clauses {
+      source := idx.phrase(file, c, SearchSource)
+      page := idx.phrase(file, c, SearchPage)
+      count := len(source) + len(page)
+      if count == 0 {
+        matched = false
+        break
+      }
+      if len(source) > 0 {
+        fields[SearchSource] = true
+      }
+      if len(page) > 0 {
+        fields[SearchPage] = true
+      }
+      // Rare words and phrases count for more
+      idf := math.Log(1 + float64(len(idx.docs)) / float64(len(idx.words[c[0]])))
+      score += idf * float64(len(c)) * (1 + math.Log(float64(count)))
+    }
+    if !matched {
+      continue
+    }
+    doc := idx.docs[file]
+    score = score / math.Sqrt(float64(doc.length))
+    for _, c := range clauses {
+      if strings.Contains(strings.ToLower(file.Name), strings.Join(c, " ")) {
+        score *= 2
+      }
+    }
+
+    result := &SearchResult{Url: file.Url, Name: file.Name, Mime: file.Mime, Score: score}
+    if fields[SearchSource] {
+      result.Matches = append(result.Matches, snippets(doc.source, SearchSource, clauses, searchMatches)...)
+    }
+    if fields[SearchPage] && len(result.Matches) < searchMatches {
+      result.Matches = append(result.Matches,
+        snippets(doc.page, SearchPage, clauses, searchMatches - len(result.Matches))...)
+    }
+    results = append(results, result)
+  }
+
+  SortSearchResults(results)
+  limit := opts.Limit
+  if limit <= 0 {
+    limit = SearchLimit
+  }
+  if len(results) > limit {
+    results = results[0:limit]
+  }
+  return results, nil
+}
+
+// Search the applications in every container, the allow function
+// selects the applications that are searched.
+func (h *Host) Search(opts *SearchOptions, allow func(app *Application) bool) ([]*SearchResult, error) {
+  results := make([]*SearchResult, 0)
+  for _, c := range h.Containers {
+    for _, app := range c.Apps {
+      if allow != nil && !allow(app) {
+        continue
+      }
+      found, err := app.Search(opts)
+      if err != nil {
+        return nil, err
+      }
+      for _, r := range found {
+        r.Container = c.Name
+        r.Application = app.Name
+      }
+      results = append(results, found...)
+    }
+  }
+
+  SortSearchResults(results)
+  limit := opts.Limit
+  if limit <= 0 {
+    limit = SearchLimit
+  }
+  if len(results) > limit {
+    results = results[0:limit]
+  }
+  return results, nil
+}
+
+// Sort results by descending score then by URL.
+func SortSearchResults(results []*SearchResult) {
+  sort.SliceStable(results, func(i, j int) bool {
+    if results[i].Score != results[j].Score {
+      return results[i].Score > results[j].Score
+    }
+    return results[i].Url < results[j].Url
+  })
+}
+
+// Private
+
+func (idx *SearchIndex) remove(file *File) {
+  doc := idx.docs[file]
+  if doc == nil {
+    return
+  }
+  for _, word := range doc.words {
+    delete(idx.words[word], file)
+    if len(idx.words[word]) == 0 {
+      delete(idx.words, word)
+    }
+  }
+  delete(idx.docs, file)
+}
+
+// Get the positions where a phrase starts in a field of a file.
+func (idx *SearchIndex) phrase(file *File, words []string, field string) []int {
+  positions := func(word string) []int {
+    p := idx.words[word][file]
+    if p == nil {
+      return nil
+    }
+    if field == SearchPage {
+      return p.page
+    }
+    return p.source
+  }
+
+  starts := positions(words[0])
+  for i, word := range words[1:] {
+    next := make(map[int]bool)
+    for _, pos := range positions(word) {
+      next[pos] = true
+    }
+    var kept []int
+    for _, pos := range starts {
+      if next[pos + i + 1] {
+        kept = append(kept, pos)
+      }
+    }
+    starts = kept
+  }
+  return starts
+}
+
+// Determine if a file matches the MIME type and path filters.
+func matchFile(file *File, opts *SearchOptions) bool {
+  if opts.Mime != "" {
+    mime := strings.SplitN(file.Mime, ";", 2)[0]
+    if strings.HasSuffix(opts.Mime, "/*") {
+      if !strings.HasPrefix(mime, strings.TrimSuffix(opts.Mime, "*")) {
+        return false
+      }
+    } else if mime != opts.Mime {
+      return false
+    }
+  }
+  if opts.Path != "" && !matchGlob(opts.Path, file) {
+    return false
+  }
+  return true
+}
+
+// Match a glob against the URL of a file, a glob without a slash
+// is matched against the file name.
+func matchGlob(glob string, file *File) bool {
+  target := file.Url
+  if !strings.Contains(glob, "/") {
+    target = file.Name
+  }
+  ok, _ := path.Match(glob, target)
+  return ok
+}
+
+// Split a query into clauses of words, a quoted phrase is a
+// single clause.
+func parseQuery(query string) [][]string {
+  var clauses [][]string
+  for i, part := range strings.Split(query, `"`) {
+    var words []string
+    for _, t := range tokenize(part) {
+      words = append(words, t.word)
+    }
+    // Text between quotes is a phrase
+    if i % 2 == 1 {
+      if len(words) > 0 {
+        clauses = append(clauses, words)
+      }
+      continue
+    }
+    for _, word := range words {
+      clauses = append(clauses, []string{word})
+    }
+  }
+  return clauses
+}
+
+// Split text into lower case words of letters and digits.
+func tokenize(text string) []searchToken {
+  var tokens []searchToken
+  start := -1
+  for i, r := range text {
+    if unicode.IsLetter(r) || unicode.IsDigit(r) {
+      if start < 0 {
+        start = i
+      }
+      continue
+    }
+    if start >= 0 {
+      tokens = append(tokens, searchToken{word: strings.ToLower(text[start:i]), start: start, end: i})
+      start = -1
+    }
+  }
+  if start >= 0 {
+    tokens = append(tokens, searchToken{word: strings.ToLower(text[start:]), start: start, end: len(text)})
+  }
+  return tokens
+}
+
+// Get the lines of text containing matches for the clauses.
+func snippets(text string, field string, clauses [][]string, max int) []*SearchMatch {
+  var matches []*SearchMatch
+  for n, line := range strings.Split(text, "\n") {
+    tokens := tokenize(line)
+    var highlights [][2]int
+    for i := range tokens {
+      for _, c := range clauses {
+        if i + len(c) > len(tokens) {
+          continue
+        }
+        found := true
+        for j, word := range c {
+          if tokens[i + j].word != word {
+            found = false
+            break
+          }
+        }
+        if found {
+          highlights = append(highlights, [2]int{tokens[i].start, tokens[i + len(c) - 1].end})
+        }
+      }
+    }
+    if len(highlights) == 0 {
+      continue
+    }
+    matches = append(matches, snippet(line, field, n + 1, highlights))
+    if len(matches) == max {
+      break
+    }
+  }
+  return matches
+}
+
+// Create a match for a line, long lines are cut around the first highlight.
+func snippet(line string, field string, number int, highlights [][2]int) *SearchMatch {
+  start := 0
+  if len(line) > searchSnippet {
+    start = highlights[0][0] - searchSnippet / 4
+    if start < 0 {
+      start = 0
+    }
+  }
+  for start > 0 && !utf8.RuneStart(line[start]) {
+    start--
+  }
+  end := start + searchSnippet
+  if end > len(line) {
+    end = len(line)
+  }
+  for end < len(line) && !utf8.RuneStart(line[end]) {
+    end++
+  }
+
+  // Offsets are relative to the trimmed text
+  text := strings.TrimLeftFunc(line[start:end], unicode.IsSpace)
+  offset := start + (end - start - len(text))
+  text = strings.TrimRightFunc(text, unicode.IsSpace)
+
+  var list [][2]int
+  for _, h := range highlights {
+    if h[0] >= offset && h[1] <= offset + len(text) {
+      list = append(list, [2]int{h[0] - offset, h[1] - offset})
+    }
+  }
+  return &SearchMatch{Field: field, Line: number, Text: text, Highlights: list}
+}
+
+// Get the visible text of a document, block elements start a new line.
+func pageText(node *html.Node) string {
+  b := new(bytes.Buffer)
+  var walk func(n *html.Node)
+  walk = func(n *html.Node) {
+    switch n.Type {
+      case html.TextNode:
+        // Collapse white space keeping the space between words in adjacent nodes
+        words := strings.Fields(n.Data)
+        if len(words) == 0 {
+          b.WriteString(" ")
+          return
+        }
+        if r, _ := utf8.DecodeRuneInString(n.Data); unicode.IsSpace(r) {
+          b.WriteString(" ")
+        }
+        b.WriteString(strings.Join(words, " "))
+        if r, _ := utf8.DecodeLastRuneInString(n.Data); unicode.IsSpace(r) {
+          b.WriteString(" ")
+        }
+        return
+      case html.ElementNode:
+        switch n.Data {
+          case "script", "style", "template":
+            return
+        }
+    }
+    for c := n.FirstChild; c != nil; c = c.NextSibling {
+      walk(c)
+    }
+    if n.Type == html.ElementNode && blockElements[n.Data] {
+      b.WriteString("\n")
+    }
+  }
+  if node != nil {
+    walk(node)
+  }
+
+  // Drop blank lines
+  var lines []string
+  for _, line := range strings.Split(b.String(), "\n") {
+    if line = strings.TrimSpace(line); line != "" {
+      lines = append(lines, line)
+    }
+  }
+  return strings.Join(lines, "\n")
+}
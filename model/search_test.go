@@ -0,0 +1,90 @@
+package model
+
+import (
+  "os"
+  "testing"
+  "golang.org/x/net/html"
+)
+
+func TestSearchIndex(t *testing.T) {
+  app, dir := loadTestApp(t, "shop", map[string]string{
+    "products.txt": "Price list\n\nThe Acme Rocket ships today.\nAcme rockets are fast"})
+  defer os.RemoveAll(dir)
+
+  results, err := app.Search(&SearchOptions{Query: `"acme rocket"`})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(results) != 1 || results[0].Url != "/products.txt" || len(results[0].Matches) != 1 {
+    t.Fatalf("Unexpected results %#v", results)
+  }
+  match := results[0].Matches[0]
+  if match.Line != 3 || match.Field != SearchSource || len(match.Highlights) != 1 {
+    t.Errorf("Unexpected match %#v", match)
+  }
+  if h := match.Highlights[0]; match.Text[h[0]:h[1]] != "Acme Rocket" {
+    t.Errorf("Unexpected highlight %s", match.Text[h[0]:h[1]])
+  }
+
+  // All words must match
+  if results, _ := app.Search(&SearchOptions{Query: "acme missing"}); len(results) != 0 {
+    t.Errorf("Expected no results, got %d", len(results))
+  }
+
+  // Index is updated when files change
+  if _, err := app.Create("/docs/acme.txt", []byte("About Acme")); err != nil {
+    t.Fatal(err)
+  }
+  if results, _ := app.Search(&SearchOptions{Query: "acme"}); len(results) != 2 || results[0].Url != "/docs/acme.txt" {
+    t.Errorf("Expected file name match to rank first, got %v", results)
+  }
+  if results, _ := app.Search(&SearchOptions{Query: "acme", Path: "/docs/*"}); len(results) != 1 {
+    t.Errorf("Expected path filter to match one file, got %d", len(results))
+  }
+  if results, _ := app.Search(&SearchOptions{Query: "acme", Mime: "image/*"}); len(results) != 0 {
+    t.Errorf("Expected MIME filter to exclude files, got %d", len(results))
+  }
+  if err := app.Update(app.Urls["/products.txt"], []byte("Sold out")); err != nil {
+    t.Fatal(err)
+  }
+  if err := app.Del(app.Urls["/docs/"]); err != nil {
+    t.Fatal(err)
+  }
+  if results, _ := app.Search(&SearchOptions{Query: "acme"}); len(results) != 0 {
+    t.Errorf("Expected changed and deleted files to be removed, got %v", results)
+  }
+
+  if _, err := app.Search(&SearchOptions{Query: `" "`}); err == nil {
+    t.Errorf("Expected error for query without words")
+  }
+}
+
+func TestPageText(t *testing.T) {
+  text := func(s string) *html.Node {
+    return &html.Node{Type: html.TextNode, Data: s}
+  }
+  element := func(tag string, children ...*html.Node) *html.Node {
+    n := &html.Node{Type: html.ElementNode, Data: tag}
+    var prev *html.Node
+    for _, c := range children {
+      c.Parent = n
+      if prev == nil {
+        n.FirstChild = c
+      } else {
+        prev.NextSibling = c
+        c.PrevSibling = prev
+      }
+      prev = c
+    }
+    n.LastChild = prev
+    return n
+  }
+
+  doc := element("body",
+    element("h1", text("Products")),
+    element("script", text("var acme = 1")),
+    element("p", text("The "), element("b", text("Acme")), text(" rocket\n  ships")))
+  if out := pageText(doc); out != "Products\nThe Acme rocket ships" {
+    t.Errorf("Unexpected page text %q", out)
+  }
+}
@@ -0,0 +1,118 @@
+package model
+
+import(
+  "os"
+  "sort"
+  "strings"
+  "io/ioutil"
+  "unicode/utf8"
+  "encoding/json"
+  "path/filepath"
+  "golang.org/x/net/html"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+const(
+  // Name of the search index written to the public directory.
+  SiteIndexFileName = "search.json"
+
+  // Maximum length of the text excerpt for a page.
+  siteIndexExcerpt = 280
+)
+
+var(
+  headingElements = map[string]bool{
+    "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true}
+)
+
+// Entry in the search index published for client side search.
+type SiteIndexEntry struct {
+  // URL of the published page relative to the application
+  Url string `json:"url"`
+  Title string `json:"title,omitempty"`
+  Headings []string `json:"headings,omitempty"`
+  // Start of the rendered text of the page
+  Text string `json:"text,omitempty"`
+}
+
+// Build search index entries for the application pages.
+//
+// Layout files, pages that are not published and pages with
+// search set to false in the page data are not included.
+func (app *Application) SiteIndex() []*SiteIndexEntry {
+  entries := make([]*SiteIndexEntry, 0)
+  for _, p := range app.Pages {
+    if p.Dom == nil || p.Name == Layout || p.Uri == "" || p.Unpublished() {
+      continue
+    }
+    if search, ok := p.PageData["search"].(bool); ok && !search {
+      continue
+    }
+    url := strings.TrimPrefix(p.Uri, SLASH)
+    if path := strings.TrimSuffix(url, "index.html"); path == "" || strings.HasSuffix(path, SLASH) {
+      url = path
+    }
+    entry := &SiteIndexEntry{Url: url, Text: excerpt(pageText(p.Dom.Document), siteIndexExcerpt)}
+    if title, ok := p.PageData["title"].(string); ok {
+      entry.Title = title
+    }
+    var walk func(n *html.Node)
+    walk = func(n *html.Node) {
+      if n.Type == html.ElementNode && headingElements[n.Data] {
+        if text := strings.Join(strings.Fields(pageText(n)), " "); text != "" {
+          entry.Headings = append(entry.Headings, text)
+        }
+        return
+      }
+      for c := n.FirstChild; c != nil; c = c.NextSibling {
+        walk(c)
+      }
+    }
+    walk(p.Dom.Document)
+    if entry.Title == "" && len(entry.Headings) > 0 {
+      entry.Title = entry.Headings[0]
+    }
+    entries = append(entries, entry)
+  }
+  sort.Slice(entries, func(i, j int) bool {
+    return entries[i].Url < entries[j].Url
+  })
+  return entries
+}
+
+// Write the search index to a public directory when enabled
+// for the application, an application file with the same name
+// takes precedence.
+func (app *Application) PublishSiteIndex(dir string) error {
+  if !app.PublishSearch || app.Urls[SLASH + SiteIndexFileName] != nil {
+    return nil
+  }
+  data, err := json.Marshal(app.SiteIndex())
+  if err != nil {
+    return err
+  }
+  if err := os.MkdirAll(dir, os.ModeDir | 0755); err != nil {
+    return err
+  }
+  out := filepath.Join(dir, SiteIndexFileName)
+  if err := ioutil.WriteFile(out, data, 0644); err != nil {
+    return err
+  }
+  return writeCompressed(out, data, 0644)
+}
+
+// Cut text to a maximum length at the last space.
+func excerpt(text string, max int) string {
+  text = strings.Join(strings.Fields(text), " ")
+  if len(text) <= max {
+    return text
+  }
+  for max > 0 && !utf8.RuneStart(text[max]) {
+    max--
+  }
+  cut := text[:max]
+  if i := strings.LastIndex(cut, " "); i > 0 {
+    cut = cut[:i]
+  }
+  return cut + "…"
+}
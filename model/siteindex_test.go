@@ -0,0 +1,79 @@
+package model
+
+import (
+  "os"
+  "testing"
+  "io/ioutil"
+  "encoding/json"
+  "path/filepath"
+  "golang.org/x/net/html"
+  "github.com/tmpfs/pageloop/vdom"
+)
+
+func TestSiteIndex(t *testing.T) {
+  app, dir := loadTestApp(t, "docs", nil)
+  defer os.RemoveAll(dir)
+
+  appendChildren := func(n *html.Node, children ...*html.Node) *html.Node {
+    var prev *html.Node
+    for _, c := range children {
+      c.Parent = n
+      if prev == nil {
+        n.FirstChild = c
+      } else {
+        prev.NextSibling = c
+        c.PrevSibling = prev
+      }
+      prev = c
+    }
+    n.LastChild = prev
+    return n
+  }
+  element := func(tag string, text string) *html.Node {
+    return appendChildren(&html.Node{Type: html.ElementNode, Data: tag}, &html.Node{Type: html.TextNode, Data: text})
+  }
+  page := func(uri string, data map[string]interface{}, nodes ...*html.Node) *Page {
+    doc := appendChildren(&html.Node{Type: html.DocumentNode}, nodes...)
+    return &Page{Name: filepath.Base(uri), Uri: uri, PageData: data, Dom: &vdom.Vdom{Document: doc}}
+  }
+
+  app.Pages = []*Page{
+    page("/guide/index.html", map[string]interface{}{"title": "Guide"},
+      element("h2", "Install"), element("p", "Download  the\nrelease.")),
+    page("/about.html", nil, element("h1", "About us"), element("p", "History")),
+    page("/layout.html", nil, element("p", "Layout")),
+    page("/toc.html", map[string]interface{}{"search": false}, element("p", "Contents"))}
+
+  entries := app.SiteIndex()
+  if len(entries) != 2 {
+    t.Fatalf("Expected two entries, got %d", len(entries))
+  }
+  if e := entries[0]; e.Url != "about.html" || e.Title != "About us" || e.Text != "About us History" {
+    t.Errorf("Unexpected entry %#v", e)
+  }
+  if e := entries[1]; e.Url != "guide/" || e.Title != "Guide" || len(e.Headings) != 1 || e.Text != "Install Download the release." {
+    t.Errorf("Unexpected entry %#v", e)
+  }
+
+  // Only written when enabled for the application
+  if err := app.PublishSiteIndex(dir); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := os.Stat(filepath.Join(dir, SiteIndexFileName)); !os.IsNotExist(err) {
+    t.Errorf("Expected no search index")
+  }
+  app.PublishSearch = true
+  if err := app.PublishSiteIndex(dir); err != nil {
+    t.Fatal(err)
+  }
+  var published []*SiteIndexEntry
+  if content, err := ioutil.ReadFile(filepath.Join(dir, SiteIndexFileName)); err != nil {
+    t.Fatal(err)
+  } else if err := json.Unmarshal(content, &published); err != nil || len(published) != 2 {
+    t.Errorf("Unexpected search index %s", content)
+  }
+
+  if out := excerpt("one two three", 9); out != "one two…" {
+    t.Errorf("Unexpected excerpt %q", out)
+  }
+}
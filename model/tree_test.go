@@ -0,0 +1,71 @@
+package model
+
+import (
+  "os"
+  "testing"
+  "path/filepath"
+)
+
+func TestFileTree(t *testing.T) {
+  app, dir := loadTestApp(t, "blog", nil)
+  defer os.RemoveAll(dir)
+
+  if _, err := app.Create("/docs/guide/intro.txt", []byte("Intro")); err != nil {
+    t.Fatal(err)
+  }
+  docs := app.Urls["/docs/"]
+  guide := app.Urls["/docs/guide/"]
+  if docs == nil || guide == nil || !guide.Directory {
+    t.Fatalf("Expected parent directories to be created")
+  }
+  if children := app.RootDirectory().Children(); len(children) != 1 || children[0] != docs {
+    t.Errorf("Unexpected root children %v", children)
+  }
+  if listing := guide.DirectoryListing(); listing.Files != 1 || listing.Children[0].Url != "/docs/guide/intro.txt" {
+    t.Errorf("Unexpected listing %#v", listing)
+  }
+
+  // Moving a directory updates the files below it
+  if err := app.Move(guide, "/manual/guide"); err != nil {
+    t.Fatal(err)
+  }
+  intro := app.Urls["/manual/guide/intro.txt"]
+  if intro == nil || app.Urls["/docs/guide/intro.txt"] != nil {
+    t.Fatalf("Expected file URL to be updated")
+  }
+  if intro.Uri != "/manual/guide/intro.txt" || intro.Relative != filepath.FromSlash("/manual/guide/intro.txt") {
+    t.Errorf("Unexpected fields %s %s", intro.Uri, intro.Relative)
+  }
+  if intro.Parent() != guide || guide.Parent() != app.Urls["/manual/"] || len(docs.Children()) != 0 {
+    t.Errorf("Expected directory to be moved in the tree")
+  }
+  if _, err := os.Stat(filepath.Join(app.PublicDirectory(), "manual", "guide", "intro.txt")); err != nil {
+    t.Errorf("Expected published file to be moved: %s", err)
+  }
+
+  // Copying a directory copies the files below it
+  copied, err := app.Copy(app.Urls["/manual/"], "/archive")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if copied.Url != "/archive/" || app.Urls["/archive/guide/intro.txt"] == nil || app.Urls["/manual/guide/intro.txt"] == nil {
+    t.Errorf("Expected directory tree to be copied")
+  }
+  if _, err := app.Copy(app.Urls["/manual/"], "/manual/guide/nested"); err == nil {
+    t.Errorf("Expected error copying a directory inside itself")
+  }
+  if err := app.Del(copied); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := os.Stat(filepath.Join(app.SourceDirectory(), "archive")); !os.IsNotExist(err) {
+    t.Errorf("Expected copied directory to be deleted")
+  }
+
+  // Deleting a directory deletes the files below it
+  if err := app.Del(app.Urls["/manual/"]); err != nil {
+    t.Fatal(err)
+  }
+  if app.Urls["/manual/guide/intro.txt"] != nil || len(app.Files) != 1 {
+    t.Errorf("Expected files below the directory to be removed, got %d files", len(app.Files))
+  }
+}
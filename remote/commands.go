@@ -0,0 +1,424 @@
+package remote
+
+import (
+  "io"
+  "fmt"
+  "time"
+  "sort"
+  "strings"
+  "strconv"
+  "net/http"
+  "io/ioutil"
+  "encoding/json"
+  . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/service"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+// How arguments for a command are completed.
+const(
+  completeNone = iota
+  completePath
+  completeService
+)
+
+var(
+  commands map[string]*command
+
+  // Interval for following audit records.
+  TailInterval = time.Second
+)
+
+// A shell command.
+type command struct {
+  name string
+  usage string
+  description string
+  // Minimum number of arguments
+  min int
+  complete int
+  run func(s *Shell, args []string) error
+}
+
+// Get the shell commands sorted by name.
+func Commands() []string {
+  var list []string
+  for name := range commands {
+    list = append(list, name)
+  }
+  sort.Strings(list)
+  return list
+}
+
+// Private
+
+// List containers, applications or files.
+func ls(s *Shell, args []string) error {
+  p := ""
+  if len(args) > 0 {
+    p = args[0]
+  }
+  list, err := s.list(p)
+  if err != nil {
+    return err
+  }
+  for _, name := range list {
+    fmt.Fprintln(s.Out, name)
+  }
+  return nil
+}
+
+// Change the current directory.
+func cd(s *Shell, args []string) error {
+  p := "/"
+  if len(args) > 0 {
+    p = args[0]
+  }
+  loc := s.resolve(p)
+  // Verify the directory exists
+  if _, err := s.list(p); err != nil {
+    return err
+  }
+  s.Dir = loc.container
+  if loc.app != "" {
+    s.Dir += "/" + loc.app + loc.url
+  }
+  return nil
+}
+
+// Print the current directory.
+func pwd(s *Shell, args []string) error {
+  fmt.Fprintln(s.Out, "/" + s.Dir)
+  return nil
+}
+
+// Print file source including frontmatter.
+func cat(s *Shell, args []string) error {
+  for _, p := range args {
+    loc, err := s.resolveFile(p)
+    if err != nil {
+      return err
+    }
+    content, err := s.Client.FileReadSourceRaw(&FileReferenceRequest{Ref: loc.fileRef()})
+    if err != nil {
+      return err
+    }
+    if _, err = s.Out.Write(content); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// Upload a local file, saves existing files otherwise the file is created.
+func put(s *Shell, args []string) error {
+  loc, err := s.resolveFile(args[1])
+  if err != nil {
+    return err
+  }
+
+  var content []byte
+  if args[0] == "-" {
+    content, err = ioutil.ReadAll(s.In)
+  } else {
+    content, err = ioutil.ReadFile(args[0])
+  }
+  if err != nil {
+    return err
+  }
+
+  ref := loc.fileRef()
+  if _, err = s.Client.FileRead(&FileReferenceRequest{Ref: ref}); err == nil {
+    _, err = s.Client.FileSave(&FileContentRequest{Ref: ref, Bytes: content})
+    return err
+  } else if ex, ok := err.(*StatusError); ok && ex.Status == http.StatusNotFound {
+    _, err = s.Client.FileCreate(&FileContentRequest{Ref: ref, Bytes: content})
+    return err
+  }
+  return err
+}
+
+// Move a file within an application.
+func mv(s *Shell, args []string) error {
+  src, err := s.resolveFile(args[0])
+  if err != nil {
+    return err
+  }
+  dest, err := s.resolveFile(args[1])
+  if err != nil {
+    return err
+  }
+  if src.container != dest.container || src.app != dest.app {
+    return fmt.Errorf("Cannot move %s to %s, files may only be moved within an application", args[0], args[1])
+  }
+  _, err = s.Client.FileMove(&FileMoveRequest{Ref: src.fileRef(), Destination: dest.url})
+  return err
+}
+
+// Copy a file or directory within an application.
+func cp(s *Shell, args []string) error {
+  src, err := s.resolveFile(args[0])
+  if err != nil {
+    return err
+  }
+  dest, err := s.resolveFile(args[1])
+  if err != nil {
+    return err
+  }
+  if src.container != dest.container || src.app != dest.app {
+    return fmt.Errorf("Cannot copy %s to %s, files may only be copied within an application", args[0], args[1])
+  }
+  _, err = s.Client.FileCopy(&FileMoveRequest{Ref: src.fileRef(), Destination: dest.url})
+  return err
+}
+
+// Delete files, directories are deleted with the -r flag.
+func rm(s *Shell, args []string) error {
+  recursive := len(args) > 0 && args[0] == "-r"
+  if recursive {
+    args = args[1:]
+  }
+  for _, p := range args {
+    loc, err := s.resolveFile(p)
+    if err != nil {
+      return err
+    }
+    if _, err = s.Client.FileDelete(&FileDeleteRequest{Ref: loc.fileRef(), Recursive: recursive}); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// List all applications.
+func apps(s *Shell, args []string) error {
+  containers, err := s.Client.HostList()
+  if err != nil {
+    return err
+  }
+  for _, c := range containers {
+    for _, app := range c.Apps {
+      fmt.Fprintf(s.Out, "%-30s %s\n", c.Name + "/" + app.Name, app.Url)
+    }
+  }
+  return nil
+}
+
+// Search the files of all applications, the arguments are
+// joined to make the query.
+func search(s *Shell, args []string) error {
+  results, err := s.Client.HostSearch(&SearchRequest{Query: strings.Join(args, " ")})
+  if err != nil {
+    return err
+  }
+  for _, r := range results {
+    for _, m := range r.Matches {
+      fmt.Fprintf(s.Out, "%s/%s%s:%d: %s\n", r.Container, r.Application, r.Url, m.Line, m.Text)
+    }
+  }
+  return nil
+}
+
+// Run an application build task, the application is the current
+// directory unless a path is given before the task name.
+func run(s *Shell, args []string) error {
+  p, task := "", args[0]
+  if len(args) > 1 {
+    p, task = args[0], args[1]
+  }
+  loc, err := s.resolveApp(p)
+  if err != nil {
+    return err
+  }
+  job, err := s.Client.ApplicationRunTask(&ApplicationTaskRequest{Ref: loc.appRef(), Task: task})
+  if err != nil {
+    return err
+  }
+  fmt.Fprintf(s.Out, "Started job %s (%d)\n", job.Id, job.Number)
+  return nil
+}
+
+// List active jobs.
+func jobs(s *Shell, args []string) error {
+  list, err := s.Client.JobList()
+  if err != nil {
+    return err
+  }
+  for _, job := range list {
+    fmt.Fprintf(s.Out, "%-6d %-40s %s\n", job.Number, job.Id, job.Runtime)
+  }
+  return nil
+}
+
+// List deleted files and applications, restore items or
+// purge them, purging without identifiers empties the trash.
+func trash(s *Shell, args []string) error {
+  if len(args) == 0 {
+    list, err := s.Client.TrashList()
+    if err != nil {
+      return err
+    }
+    for _, item := range list {
+      user := item.User
+      if user == "" {
+        user = "-"
+      }
+      fmt.Fprintf(s.Out, "%-16s %s %-12s %-8s %s\n",
+        item.Id, item.Time.Format(time.RFC3339), user, PrettyBytes(item.Size), item.Ref)
+    }
+    return nil
+  }
+
+  ids := args[1:]
+  switch args[0] {
+    case "restore":
+      if len(ids) == 0 {
+        return fmt.Errorf("No trash item to restore")
+      }
+      for _, id := range ids {
+        if _, err := s.Client.TrashRestore(&TrashRequest{Id: id}); err != nil {
+          return err
+        }
+      }
+    case "purge":
+      if len(ids) == 0 {
+        ids = []string{""}
+      }
+      for _, id := range ids {
+        if _, err := s.Client.TrashPurge(&TrashRequest{Id: id}); err != nil {
+          return err
+        }
+      }
+    default:
+      return fmt.Errorf("Unknown trash command %s", args[0])
+  }
+  return nil
+}
+
+// Print the latest audit records, with -f new records are
+// printed until the connection is closed.
+func tail(s *Shell, args []string) error {
+  follow := false
+  count := 10
+  for _, arg := range args {
+    if arg == "-f" {
+      follow = true
+    } else if n, err := strconv.Atoi(arg); err == nil && n > 0 {
+      count = n
+    } else {
+      return fmt.Errorf("Invalid argument %s", arg)
+    }
+  }
+
+  // Get the total to find the offset for the last records
+  page, err := s.Client.AuditList(&AuditRequest{Limit: 1})
+  if err != nil {
+    return err
+  }
+  offset := page.Total - count
+  if offset < 0 {
+    offset = 0
+  }
+  for {
+    page, err = s.Client.AuditList(&AuditRequest{Offset: offset})
+    if err != nil {
+      return err
+    }
+    for _, record := range page.Records {
+      printRecord(s.Out, record)
+    }
+    offset += len(page.Records)
+    if !follow {
+      return nil
+    }
+    time.Sleep(TailInterval)
+  }
+}
+
+func printRecord(w io.Writer, record *AuditRecord) {
+  user := record.User
+  if user == "" {
+    user = "-"
+  }
+  fmt.Fprintf(w, "%s %-12s %-24s %d %s", record.Time.Format(time.RFC3339), user, record.ServiceMethod, record.Status, record.Target)
+  if record.Error != "" {
+    fmt.Fprintf(w, " (%s)", record.Error)
+  }
+  fmt.Fprintln(w)
+}
+
+// List service methods.
+func services(s *Shell, args []string) error {
+  list := s.completeService()
+  sort.Strings(list)
+  for _, name := range list {
+    fmt.Fprintln(s.Out, name)
+  }
+  return nil
+}
+
+// Call a service method with JSON arguments and print the reply.
+func call(s *Shell, args []string) error {
+  params := json.RawMessage("{}")
+  if len(args) > 1 {
+    params = json.RawMessage(args[1])
+  }
+  var reply json.RawMessage
+  if err := s.Client.Call(args[0], params, &reply); err != nil {
+    return err
+  }
+  out, err := json.MarshalIndent(reply, "", "  ")
+  if err != nil {
+    return err
+  }
+  fmt.Fprintln(s.Out, string(out))
+  return nil
+}
+
+// Print completions for a command line.
+func complete(s *Shell, args []string) error {
+  for _, c := range s.Complete(args) {
+    fmt.Fprintln(s.Out, c)
+  }
+  return nil
+}
+
+func help(s *Shell, args []string) error {
+  for _, name := range Commands() {
+    cmd := commands[name]
+    fmt.Fprintf(s.Out, "  %-28s %s\n", cmd.name + " " + cmd.usage, cmd.description)
+  }
+  return nil
+}
+
+func exit(s *Shell, args []string) error {
+  return ErrExit
+}
+
+func init() {
+  commands = make(map[string]*command)
+  add := func(name string, usage string, min int, complete int, description string, run func(*Shell, []string) error) {
+    commands[name] = &command{
+      name: name, usage: usage, min: min, complete: complete, description: description, run: run}
+  }
+
+  add("ls", "[path]", 0, completePath, "List containers, applications or files", ls)
+  add("cd", "[path]", 0, completePath, "Change the current directory", cd)
+  add("pwd", "", 0, completeNone, "Print the current directory", pwd)
+  add("cat", "<file...>", 1, completePath, "Print file source", cat)
+  add("put", "<local> <file>", 2, completePath, "Create or save a file from a local file or - for stdin", put)
+  add("mv", "<file> <dest>", 2, completePath, "Move a file or directory within an application", mv)
+  add("cp", "<file> <dest>", 2, completePath, "Copy a file or directory within an application", cp)
+  add("rm", "[-r] <file...>", 1, completePath, "Delete files, -r deletes directories", rm)
+  add("apps", "", 0, completeNone, "List all applications", apps)
+  add("search", "<words...>", 1, completeNone, "Search the files of all applications", search)
+  add("run", "[app] <task>", 1, completePath, "Run an application build task", run)
+  add("jobs", "", 0, completeNone, "List active jobs", jobs)
+  add("trash", "[restore|purge] [id...]", 0, completeNone, "List, restore or purge deleted files", trash)
+  add("tail", "[-f] [count]", 0, completeNone, "Print the latest audit records", tail)
+  add("services", "", 0, completeNone, "List service methods", services)
+  add("call", "<method> [json]", 1, completeService, "Call a service method", call)
+  add("complete", "<words...>", 0, completeNone, "Print completions for a command line", complete)
+  add("help", "", 0, completeNone, "Show this help", help)
+  add("exit", "", 0, completeNone, "Exit the shell", exit)
+}
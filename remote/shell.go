@@ -0,0 +1,398 @@
+// Package remote provides a shell for a running server using the
+// websocket JSON-RPC transport.
+package remote
+
+import (
+  "io"
+  "os"
+  "fmt"
+  "sort"
+  "bufio"
+  "errors"
+  "strings"
+  "path"
+  "golang.org/x/term"
+  "github.com/tmpfs/pageloop/client"
+  . "github.com/tmpfs/pageloop/service"
+)
+
+const(
+  // Prompt for interactive sessions.
+  Prompt = "pageloop> "
+)
+
+var(
+  // Returned by the exit command.
+  ErrExit = errors.New("exit")
+)
+
+// Shell runs commands against a server.
+type Shell struct {
+  Client *client.Client
+  // Output for command results.
+  Out io.Writer
+  // Output for errors and the prompt.
+  Err io.Writer
+  // Input for commands that read content, eg: put -
+  In io.Reader
+  // Current directory in the form container/application/path.
+  Dir string
+}
+
+// Create a shell for a client.
+func NewShell(c *client.Client) *Shell {
+  return &Shell{Client: c, Out: os.Stdout, Err: os.Stderr, In: os.Stdin}
+}
+
+// Execute a command, the first argument is the command name.
+func (s *Shell) Exec(args []string) error {
+  if len(args) == 0 {
+    return nil
+  }
+  cmd := commands[args[0]]
+  if cmd == nil {
+    return fmt.Errorf("Unknown command %s, try help", args[0])
+  }
+  if len(args) - 1 < cmd.min {
+    return fmt.Errorf("Usage: %s %s", cmd.name, cmd.usage)
+  }
+  return cmd.run(s, args[1:])
+}
+
+// Read and execute commands one per line.
+//
+// When interactive a prompt is written before each command and errors
+// are printed, otherwise the first error stops execution and is returned.
+// Interactive sessions on a terminal can edit the line and press tab
+// to complete the word before the cursor.
+func (s *Shell) Run(r io.Reader, interactive bool) error {
+  if f, ok := r.(*os.File); ok && interactive && term.IsTerminal(int(f.Fd())) {
+    return s.runTerminal(f)
+  }
+  scanner := bufio.NewScanner(r)
+  for {
+    if interactive {
+      fmt.Fprint(s.Err, Prompt)
+    }
+    if !scanner.Scan() {
+      break
+    }
+    if err := s.execLine(scanner.Text(), interactive); err == ErrExit {
+      return nil
+    } else if err != nil {
+      return err
+    }
+  }
+  if interactive {
+    fmt.Fprintln(s.Err)
+  }
+  return scanner.Err()
+}
+
+// Get completions for the last word of a command line.
+//
+// Command names are completed for the first word, arguments are
+// completed using service names or the containers, applications and
+// files on the server depending upon the command.
+func (s *Shell) Complete(words []string) []string {
+  var prefix string
+  if len(words) > 0 {
+    prefix = words[len(words) - 1]
+  }
+  var candidates []string
+  if len(words) <= 1 {
+    for name := range commands {
+      candidates = append(candidates, name)
+    }
+  } else if cmd := commands[words[0]]; cmd != nil {
+    switch cmd.complete {
+      case completePath:
+        candidates = s.completePath(prefix)
+      case completeService:
+        candidates = s.completeService()
+    }
+  }
+
+  var list []string
+  for _, c := range candidates {
+    if strings.HasPrefix(c, prefix) {
+      list = append(list, c)
+    }
+  }
+  sort.Strings(list)
+  return list
+}
+
+// Complete the word before the cursor position in a line.
+//
+// The word is extended to the longest common prefix of the completions
+// and a space is added after a single completion that is not a directory.
+// Returns the new line and cursor position with the completions, the
+// line is not changed when the word cannot be extended.
+func (s *Shell) CompleteLine(line string, pos int) (string, int, []string) {
+  // Split with a marker so that quotes and escapes are respected
+  // and a new word is started after a space
+  words := Split(line[0:pos] + "\x00")
+  words[len(words) - 1] = strings.TrimSuffix(words[len(words) - 1], "\x00")
+  prefix := words[len(words) - 1]
+
+  list := s.Complete(words)
+  if len(list) == 0 {
+    return line, pos, nil
+  }
+  word := list[0]
+  for _, c := range list[1:] {
+    for !strings.HasPrefix(c, word) {
+      word = word[0:len(word) - 1]
+    }
+  }
+  insert := strings.Replace(word[len(prefix):], " ", "\\ ", -1)
+  if len(list) == 1 && !strings.HasSuffix(word, "/") {
+    insert += " "
+  }
+  return line[0:pos] + insert + line[pos:], pos + len(insert), list
+}
+
+// Split a command line into words, single and double quotes
+// group words and a backslash escapes the next character.
+func Split(line string) []string {
+  var words []string
+  var word strings.Builder
+  var quote rune
+  inWord := false
+  escape := false
+  for _, c := range line {
+    switch {
+      case escape:
+        word.WriteRune(c)
+        escape = false
+      case c == '\\' && quote != '\'':
+        escape = true
+        inWord = true
+      case quote != 0:
+        if c == quote {
+          quote = 0
+        } else {
+          word.WriteRune(c)
+        }
+      case c == '"' || c == '\'':
+        quote = c
+        inWord = true
+      case c == ' ' || c == '\t':
+        if inWord {
+          words = append(words, word.String())
+          word.Reset()
+          inWord = false
+        }
+      default:
+        word.WriteRune(c)
+        inWord = true
+    }
+  }
+  if inWord {
+    words = append(words, word.String())
+  }
+  return words
+}
+
+// Private
+
+// Execute a line of input, blank lines and comments are ignored.
+//
+// When interactive errors are printed, returns ErrExit or the error
+// when execution should stop.
+func (s *Shell) execLine(line string, interactive bool) error {
+  line = strings.TrimSpace(line)
+  if line == "" || strings.HasPrefix(line, "#") {
+    return nil
+  }
+  err := s.Exec(Split(line))
+  if err != nil && err != ErrExit && interactive {
+    fmt.Fprintln(s.Err, err.Error())
+    return nil
+  }
+  return err
+}
+
+// Read commands from a terminal with line editing, the terminal is
+// only in raw mode while a line is read so commands can be interrupted.
+func (s *Shell) runTerminal(f *os.File) error {
+  fd := int(f.Fd())
+  t := term.NewTerminal(struct {
+    io.Reader
+    io.Writer
+  }{f, s.Err}, Prompt)
+  t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+    if key != '\t' {
+      return "", 0, false
+    }
+    newLine, newPos, list := s.CompleteLine(line, pos)
+    // Show the completions when the word cannot be extended
+    if newLine == line && len(list) > 1 {
+      fmt.Fprintln(t, strings.Join(list, "  "))
+    }
+    return newLine, newPos, newLine != line
+  }
+  for {
+    state, err := term.MakeRaw(fd)
+    if err != nil {
+      return err
+    }
+    line, err := t.ReadLine()
+    term.Restore(fd, state)
+    if err == io.EOF {
+      fmt.Fprintln(s.Err)
+      return nil
+    } else if err != nil {
+      return err
+    }
+    if err := s.execLine(line, true); err == ErrExit {
+      return nil
+    }
+  }
+}
+
+// A path on the server.
+type location struct {
+  container string
+  app string
+  // File URL, empty for the application
+  url string
+}
+
+// Application reference.
+func (l *location) appRef() string {
+  return fmt.Sprintf("file://pageloop.com/%s/%s", l.container, l.app)
+}
+
+// File reference.
+func (l *location) fileRef() string {
+  return l.appRef() + "#" + l.url
+}
+
+// Resolve a path relative to the current directory, a leading
+// slash makes the path absolute.
+func (s *Shell) resolve(p string) *location {
+  dir := strings.HasSuffix(p, "/")
+  if !strings.HasPrefix(p, "/") {
+    p = s.Dir + "/" + p
+  }
+  p = strings.TrimPrefix(path.Clean("/" + p), "/")
+  loc := &location{}
+  if p == "" {
+    return loc
+  }
+  parts := strings.SplitN(p, "/", 3)
+  loc.container = parts[0]
+  if len(parts) > 1 {
+    loc.app = parts[1]
+  }
+  if len(parts) > 2 {
+    loc.url = "/" + parts[2]
+    // Trailing slash indicates a directory
+    if dir {
+      loc.url += "/"
+    }
+  }
+  return loc
+}
+
+// Resolve a path that must refer to a file.
+func (s *Shell) resolveFile(p string) (*location, error) {
+  loc := s.resolve(p)
+  if loc.url == "" {
+    return nil, fmt.Errorf("Not a file path: %s", p)
+  }
+  return loc, nil
+}
+
+// Resolve a path that must refer to an application.
+func (s *Shell) resolveApp(p string) (*location, error) {
+  loc := s.resolve(p)
+  if loc.app == "" {
+    return nil, fmt.Errorf("Not an application path: %s", p)
+  }
+  return loc, nil
+}
+
+// Complete a path using the entries in it's directory.
+func (s *Shell) completePath(prefix string) []string {
+  // Directory of the word being completed
+  base := ""
+  if i := strings.LastIndex(prefix, "/"); i > -1 {
+    base = prefix[0:i + 1]
+  }
+  entries, err := s.list(base)
+  if err != nil {
+    return nil
+  }
+  var list []string
+  for _, e := range entries {
+    list = append(list, base + e)
+  }
+  return list
+}
+
+// Complete service method names.
+func (s *Shell) completeService() []string {
+  services, err := s.Client.ServiceList()
+  if err != nil {
+    return nil
+  }
+  var list []string
+  for _, info := range services {
+    for _, m := range info.Methods {
+      list = append(list, m.ServiceMethod)
+    }
+  }
+  return list
+}
+
+// Get the entries in a directory, directories have a trailing slash.
+func (s *Shell) list(p string) ([]string, error) {
+  loc := s.resolve(p)
+  var list []string
+  switch {
+    case loc.container == "":
+      containers, err := s.Client.HostList()
+      if err != nil {
+        return nil, err
+      }
+      for _, c := range containers {
+        list = append(list, c.Name + "/")
+      }
+    case loc.app == "":
+      container, err := s.Client.ContainerRead(&ContainerRequest{Name: loc.container})
+      if err != nil {
+        return nil, err
+      }
+      for _, app := range container.Apps {
+        list = append(list, app.Name + "/")
+      }
+    default:
+      files, err := s.Client.ApplicationReadFiles(&ApplicationReferenceRequest{Ref: loc.appRef()})
+      if err != nil {
+        return nil, err
+      }
+      dir := strings.TrimSuffix(loc.url, "/") + "/"
+      seen := make(map[string]bool)
+      for _, f := range files {
+        if !strings.HasPrefix(f.Url, dir) || f.Url == dir {
+          continue
+        }
+        // Direct children only
+        name := strings.TrimPrefix(f.Url, dir)
+        if i := strings.Index(name, "/"); i > -1 {
+          name = name[0:i + 1]
+        } else if f.Directory {
+          name += "/"
+        }
+        if !seen[name] {
+          seen[name] = true
+          list = append(list, name)
+        }
+      }
+  }
+  sort.Strings(list)
+  return list, nil
+}
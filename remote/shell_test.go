@@ -0,0 +1,50 @@
+package remote
+
+import (
+  "reflect"
+  "testing"
+)
+
+func TestSplit(t *testing.T) {
+  words := Split(`put "my file.md" user/blog/a\ b.md 'x "y"'`)
+  expected := []string{"put", "my file.md", "user/blog/a b.md", `x "y"`}
+  if !reflect.DeepEqual(words, expected) {
+    t.Errorf("Unexpected words %#v", words)
+  }
+}
+
+func TestResolve(t *testing.T) {
+  s := &Shell{Dir: "user/blog"}
+  loc := s.resolve("docs/../index.md")
+  if loc.fileRef() != "file://pageloop.com/user/blog#/index.md" {
+    t.Errorf("Unexpected reference %s", loc.fileRef())
+  }
+  loc = s.resolve("/template/")
+  if loc.container != "template" || loc.app != "" {
+    t.Errorf("Unexpected location %#v", loc)
+  }
+  loc = s.resolve("docs/")
+  if loc.url != "/docs/" {
+    t.Errorf("Expected directory url, got %s", loc.url)
+  }
+  if _, err := s.resolveFile("/user/blog"); err == nil {
+    t.Errorf("Expected error for application path")
+  }
+}
+
+func TestCompleteLine(t *testing.T) {
+  s := &Shell{}
+  if line, pos, _ := s.CompleteLine("he", 2); line != "help " || pos != 5 {
+    t.Errorf("Unexpected completion %q %d", line, pos)
+  }
+  if line, pos, _ := s.CompleteLine("pw ls", 2); line != "pwd  ls" || pos != 4 {
+    t.Errorf("Unexpected completion %q %d", line, pos)
+  }
+  line, pos, list := s.CompleteLine("ca", 2)
+  if line != "ca" || pos != 2 || !reflect.DeepEqual(list, []string{"call", "cat"}) {
+    t.Errorf("Expected ambiguous completion, got %q %d %v", line, pos, list)
+  }
+  if line, pos, list = s.CompleteLine("zz", 2); line != "zz" || list != nil {
+    t.Errorf("Unexpected completion %q %d %v", line, pos, list)
+  }
+}
@@ -123,10 +123,22 @@ type ServiceMethodInfo struct {
   ArgFields []*MethodArgField `json:"fields"`
   // Type for the reply value (second argument)
   ReplyType string `json:"reply"`
+  // Argument type, used to generate schemas
+  Arg reflect.Type `json:"-"`
+  // Reply type, used to generate schemas
+  Reply reflect.Type `json:"-"`
   // Placeholder for meta data associated with the service (description, notes etc)
   UserMeta interface{} `json:"meta,omitempty"`
   // Placeholder for user data associated with the service (route information)
   UserData interface{} `json:"info,omitempty"`
+  method *methodType
+}
+
+// Get the number of calls for the method.
+func (info *ServiceMethodInfo) NumCalls() uint {
+  info.method.Lock()
+  defer info.method.Unlock()
+  return info.method.numCalls
 }
 
 // Set argv for a service method call request.
@@ -141,6 +153,12 @@ func (req *Request) Argv(args interface{}) {
   req.Arguments.Argv = reflect.ValueOf(args)
 }
 
+// Get the arguments for a service method call request, a pointer
+// to a new value of the method argument type unless Argv() was called.
+func (req *Request) Args() interface{} {
+  return req.Arguments.Argv.Interface()
+}
+
 // Register a service and panic on error.
 func (server *ServiceMap) MustRegister(rcvr interface{}, name string) {
   if err := server.Register(rcvr, name); err != nil {
@@ -197,7 +215,10 @@ func (server *ServiceMap) Map() map[string]*ServiceInfo {
           Calls: &mt.numCalls,
           ArgType: mt.ArgType.String(),
           ReplyType: mt.ReplyType.String(),
-          Name: mt.method.Name}
+          Arg: mt.ArgType,
+          Reply: mt.ReplyType,
+          Name: mt.method.Name,
+          method: mt}
 
         // Service methods must use a pointer for argument type
         // If they don't this will error on the call to Elem()
@@ -3,7 +3,9 @@ package pageloop
 
 import (
 	"fmt"
+  "os"
   "log"
+  "context"
 	"mime"
   "net/http"
   "time"
@@ -13,6 +15,7 @@ import (
   . "github.com/tmpfs/pageloop/model"
   . "github.com/tmpfs/pageloop/service"
   . "github.com/tmpfs/pageloop/rpc"
+  . "github.com/tmpfs/pageloop/util"
 )
 
 type PageLoop struct {
@@ -33,15 +36,39 @@ type PageLoop struct {
 
   // Map of services
   Services *ServiceMap
+
+  // Access policy for service calls
+  Policy *Policy `json:"-"`
+
+  // Deleted files and applications
+  Trash *Trash `json:"-"`
+
+  // Certificate and key files when serving HTTPS
+  certFile string
+  keyFile string
+
+  // Plain HTTP server that redirects to HTTPS
+  redirect *http.Server
+
+  // Log files closed on shutdown
+  logFiles []*os.File
+
+  // Closed on shutdown to stop background tasks
+  done chan struct{}
 }
 
 // Creates an HTTP server.
 func (l *PageLoop) NewServer(config *ServerConfig) (*http.Server, error) {
+  var err error
   var handler http.Handler
 
   // Configuration for the server
   l.Config = config
 
+  if err = l.initLogging(); err != nil {
+    return nil, err
+  }
+
   // Initialize server multiplexer
   l.Mux = http.NewServeMux()
 
@@ -53,36 +80,65 @@ func (l *PageLoop) NewServer(config *ServerConfig) (*http.Server, error) {
   // Application mountpoints are dynamic (they can be added and removed at runtime)
   // so they need special care.
   l.MountpointManager = NewMountpointManager(l.Config, l.Host)
+  l.MountpointManager.Mount = l.mount
+  l.MountpointManager.ProxyHandler = NewProxyHandler
+
+  // Load the access policy that lives next to the config file
+  if l.Policy, err = LoadPolicy(config.PolicyPath()); err != nil {
+    return nil, err
+  }
+
+  // Record mutating service calls
+  Audit = NewAuditLog(config.AuditPath())
+
+  // Deleted files and applications are kept until they expire
+  maxAge := time.Duration(config.TrashMaxAge) * 24 * time.Hour
+  l.Trash = NewTrash(config.TrashPath(), maxAge, int64(config.TrashMaxSize) << 20)
+  if err = l.Trash.Load(); err != nil {
+    return nil, err
+  }
+  l.done = make(chan struct{})
+
+  // Certificates for HTTPS, may generate a self-signed certificate
+  if l.certFile, l.keyFile, err = config.TLSFiles(); err != nil {
+    return nil, err
+  }
 
   l.initServices()
+  l.initMetrics()
 
 	// Configure application containers.
-	sys := NewContainer("system", "System applications.", true)
-	tpl := NewContainer("template", "Application & document templates.", true)
-	usr := NewContainer("user", "User applications.", false)
+	sys := NewContainer("system", "System applications.")
+	tpl := NewContainer("template", "Application & document templates.")
+	usr := NewContainer("user", "User applications.")
 	l.Host.Add(usr)
 	l.Host.Add(sys)
 	l.Host.Add(tpl)
 
 	// REST API global endpoint (/api/)
-	handler = RestService(l.Mux, l.Services, l.Host, l.MountpointManager)
+	handler = RestService(l.Mux, l.Services, l.Host, l.MountpointManager, l.Policy)
 	l.MountpointManager.MountpointMap[API_URL] = handler
-	log.Printf("Serving rest service from %s", API_URL)
+	Log.Info("serving rest service", Fields{"url": API_URL})
 
 	// Websocket global endpoint (/ws/)
-	handler = WebsocketService(l.Mux, l.Services, l.Host, l.MountpointManager)
+	handler = WebsocketService(l.Mux, l.Services, l.Host, l.MountpointManager, l.Policy, l.Trash)
 	l.MountpointManager.MountpointMap[WEBSOCKET_URL] = handler
-	log.Printf("Serving websocket service from %s", WEBSOCKET_URL)
+	Log.Info("serving websocket service", Fields{"url": WEBSOCKET_URL})
+
+	// Prometheus metrics endpoint (/metrics)
+	handler = MetricsService(l.Mux)
+	l.MountpointManager.MountpointMap[METRICS_URL] = handler
+	Log.Info("serving metrics", Fields{"url": METRICS_URL})
 
 	// RPC global endpoint (/rpc/)
   /*
 	handler = RpcService(l.Mux, l.Host)
 	l.MountpointManager.MountpointMap[RPC_URL] = handler
-	log.Printf("Serving rpc service from %s", RPC_URL)
+	Log.Info("serving rpc service", Fields{"url": RPC_URL})
   */
 
   // Collect mountpoints by container name
-  if collection, err := l.MountpointManager.Collect(config.Mountpoints, config.UserConfig().Mountpoints); err != nil {
+  if collection, err := l.MountpointManager.Collect(config.Mountpoints, config.UserMountpoints()); err != nil {
     return nil, err
   // Load the mountpoints using the container map
   } else {
@@ -97,12 +153,18 @@ func (l *PageLoop) NewServer(config *ServerConfig) (*http.Server, error) {
 	l.MountContainer(tpl)
 	l.MountContainer(usr)
 
+  // Proxy mountpoints for backend services
+  if err := l.MountpointManager.LoadProxies(config.Mountpoints, config.UserMountpoints()); err != nil {
+    return nil, err
+  }
+
   s := &http.Server{
     Addr:           config.Addr,
     Handler:        ServerHandler{MountpointManager: l.MountpointManager, Mux: l.Mux},
     ReadTimeout:    10 * time.Second,
     WriteTimeout:   10 * time.Second,
     MaxHeaderBytes: 1 << 20,
+    ErrorLog:       log.New(Log.Writer(LevelWarn), "", 0),
   }
 
   return s, nil
@@ -110,11 +172,19 @@ func (l *PageLoop) NewServer(config *ServerConfig) (*http.Server, error) {
 
 // Mount all applications in a container.
 func (l *PageLoop) MountContainer(container *Container) {
+  l.Policy.Protect(container)
 	for _, a := range container.Apps {
 		MountApplication(l.MountpointManager.MountpointMap, l.Host, a)
 	}
 }
 
+// Reload the configuration file and apply mountpoint changes.
+func (l *PageLoop) ReloadConfig() (*MountpointChanges, error) {
+  l.MountpointManager.Lock()
+  defer l.MountpointManager.Unlock()
+  return l.MountpointManager.Reload()
+}
+
 // Start the HTTP server listening.
 func (l *PageLoop) Listen(server *http.Server) error {
 	var err error
@@ -122,7 +192,28 @@ func (l *PageLoop) Listen(server *http.Server) error {
 		return fmt.Errorf("Cannot listen without a server, call NewServer().")
 	}
 
-	log.Printf("Listen %s", server.Addr)
+  go l.expireTrash()
+  go l.publishScheduled()
+
+  if l.certFile != "" {
+    // Plain HTTP listener that redirects to HTTPS
+    if l.Config.RedirectAddr != "" {
+      l.redirect = &http.Server{
+        Addr: l.Config.RedirectAddr,
+        Handler: NewRedirectHandler(server.Addr),
+        ReadTimeout: 10 * time.Second,
+        WriteTimeout: 10 * time.Second}
+      go l.listenRedirect()
+    }
+
+    Log.Info("listen", Fields{"addr": server.Addr, "tls": true})
+    if err = server.ListenAndServeTLS(l.certFile, l.keyFile); err != nil {
+      return err
+    }
+    return nil
+  }
+
+	Log.Info("listen", Fields{"addr": server.Addr})
 
   if err = server.ListenAndServe(); err != nil {
 		return err
@@ -131,6 +222,171 @@ func (l *PageLoop) Listen(server *http.Server) error {
 	return nil
 }
 
+// Mount an application loaded at runtime.
+func (l *PageLoop) mount(app *Application) {
+  app.Protected = !l.Policy.Allow("", PermissionAdmin, app.Container.Name, app.Name)
+  MountApplication(l.MountpointManager.MountpointMap, l.Host, app)
+}
+
+// Start a plain HTTP server that redirects to the HTTPS server.
+func (l *PageLoop) listenRedirect() {
+  Log.Info("redirect to https", Fields{"addr": l.redirect.Addr})
+  if err := l.redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+    Log.Error("redirect listener failed", Fields{"addr": l.redirect.Addr, "error": err})
+  }
+}
+
+// Gracefully shut down the HTTP server.
+//
+// Stops accepting connections, lets websocket messages and in-flight
+// requests finish and sends websocket clients a close frame. Active
+// jobs are then waited on or aborted when the configuration says so,
+// jobs still running when the shutdown timeout expires are aborted.
+func (l *PageLoop) Shutdown(server *http.Server) error {
+  var err error
+  start := time.Now()
+
+  timeout := time.Duration(l.Config.ShutdownTimeout) * time.Second
+  if timeout <= 0 {
+    timeout = 30 * time.Second
+  }
+  ctx, cancel := context.WithTimeout(context.Background(), timeout)
+  defer cancel()
+
+  Log.Info("shutdown started", Fields{"timeout": timeout})
+
+  if l.done != nil {
+    close(l.done)
+  }
+
+  if l.redirect != nil {
+    l.redirect.Shutdown(ctx)
+  }
+
+  // Wait for in-flight requests
+  if err = server.Shutdown(ctx); err != nil {
+    Log.Warn("shutdown did not drain requests", Fields{"error": err})
+  }
+
+  sockets, e := CloseWebsockets(ctx)
+  if e != nil {
+    Log.Warn("shutdown did not drain websocket messages", Fields{"error": e})
+  }
+
+  var waited int
+  var aborted int
+  if l.Config.AbortJobs {
+    aborted = Jobs.AbortAll()
+  } else {
+    waited = len(Jobs.List())
+    if remaining := Jobs.Wait(ctx); len(remaining) > 0 {
+      waited -= len(remaining)
+      aborted = Jobs.AbortAll()
+    }
+  }
+
+  Log.Info("shutdown complete", Fields{
+    "duration": time.Since(start), "websockets": sockets, "waited": waited, "aborted": aborted})
+
+  for _, f := range l.logFiles {
+    f.Close()
+  }
+  return err
+}
+
+// Purge expired trash items every hour until the server is shut down.
+func (l *PageLoop) expireTrash() {
+  ticker := time.NewTicker(time.Hour)
+  defer ticker.Stop()
+  for {
+    select {
+      case <-ticker.C:
+        if purged, err := l.Trash.Expire(); err != nil {
+          Log.Warn("trash purge failed", Fields{"error": err})
+        } else if len(purged) > 0 {
+          Log.Info("trash purged", Fields{"items": len(purged)})
+        }
+      case <-l.done:
+        return
+    }
+  }
+}
+
+// Check every minute for pages with a publish date that has passed
+// or that expired and publish them until the server is shut down.
+//
+// Holds the mountpoint write lock so pages are not published while
+// a service call reads or modifies the applications.
+func (l *PageLoop) publishScheduled() {
+  ticker := time.NewTicker(time.Minute)
+  defer ticker.Stop()
+  for {
+    select {
+      case now := <-ticker.C:
+        l.MountpointManager.Lock()
+        for _, c := range l.Host.Containers {
+          for _, app := range c.Apps {
+            // Build tasks publish the files for these applications
+            if app.HasBuilder() {
+              continue
+            }
+            if files, err := app.PublishScheduled(now); err != nil {
+              Log.Warn("scheduled publish failed", Fields{"app": app.Url, "error": err})
+            } else if len(files) > 0 {
+              Log.Info("scheduled pages published", Fields{"app": app.Url, "pages": len(files)})
+            }
+          }
+        }
+        l.MountpointManager.Unlock()
+      case <-l.done:
+        return
+    }
+  }
+}
+
+// Configure the server log and access log.
+//
+// Output from packages that use the standard logger is written
+// to the server log.
+func (l *PageLoop) initLogging() error {
+  if l.Config.LogLevel != "" {
+    level, err := ParseLevel(l.Config.LogLevel)
+    if err != nil {
+      return err
+    }
+    Log.Level = level
+  }
+  if l.Config.LogFile != "" {
+    f, err := l.openLog(l.Config.LogFile)
+    if err != nil {
+      return err
+    }
+    Log.Out = f
+  }
+  log.SetFlags(0)
+  log.SetOutput(Log.Writer(LevelInfo))
+
+  AccessLog = Log
+  if l.Config.AccessLog != "" {
+    f, err := l.openLog(l.Config.AccessLog)
+    if err != nil {
+      return err
+    }
+    AccessLog = NewLogger(f, LevelInfo)
+  }
+  return nil
+}
+
+// Open a log file for appending.
+func (l *PageLoop) openLog(path string) (*os.File, error) {
+  f, err := os.OpenFile(path, os.O_CREATE | os.O_WRONLY | os.O_APPEND, 0644)
+  if err != nil {
+    return nil, err
+  }
+  l.logFiles = append(l.logFiles, f)
+  return f, nil
+}
+
 // Initialize services
 func (l *PageLoop) initServices() {
   l.Services = &ServiceMap{}
@@ -144,6 +400,9 @@ func (l *PageLoop) initServices() {
   file := new(FileService)
   job := new(JobService)
   tpl := new(TemplateService)
+  audit := new(AuditService)
+  proxy := new(ProxyService)
+  trash := new(TrashService)
 
   srv.Services = l.Services
   srv.Router = DefaultRouter
@@ -154,9 +413,28 @@ func (l *PageLoop) initServices() {
   zip.Host = l.Host
   file.Host = l.Host
   tpl.Host = l.Host
+  trash.Host = l.Host
 
+  core.Mountpoints = l.MountpointManager
   ctx.Mountpoints = l.MountpointManager
   app.Mountpoints = l.MountpointManager
+  proxy.Mountpoints = l.MountpointManager
+  trash.Mountpoints = l.MountpointManager
+
+  core.Policy = l.Policy
+  host.Policy = l.Policy
+  job.Policy = l.Policy
+  ctx.Policy = l.Policy
+  app.Policy = l.Policy
+  zip.Policy = l.Policy
+  file.Policy = l.Policy
+  audit.Policy = l.Policy
+  proxy.Policy = l.Policy
+  trash.Policy = l.Policy
+
+  app.Trash = l.Trash
+  file.Trash = l.Trash
+  trash.Trash = l.Trash
 
   l.Services.MustRegister(core, "Core")
   l.Services.MustRegister(host, "Host")
@@ -166,9 +444,55 @@ func (l *PageLoop) initServices() {
   l.Services.MustRegister(file, "File")
   l.Services.MustRegister(job, "Job")
   l.Services.MustRegister(tpl, "Template")
+  l.Services.MustRegister(audit, "Audit")
+  l.Services.MustRegister(proxy, "Proxy")
+  l.Services.MustRegister(trash, "Trash")
   l.Services.MustRegister(srv, "Service")
 }
 
+// Register gauges computed from the server state.
+func (l *PageLoop) initMetrics() {
+  Metrics.Gauge("pageloop_jobs_active", "Active jobs.", func(set func(float64, ...string)) {
+    set(float64(len(Jobs.List())))
+  })
+  // Applications and files change during service calls which
+  // hold the mountpoint lock
+  Metrics.Gauge("pageloop_applications_mounted", "Mounted applications.", func(set func(float64, ...string)) {
+    var n int
+    l.MountpointManager.RLock()
+    for _, c := range l.Host.Containers {
+      n += len(c.Apps)
+    }
+    l.MountpointManager.RUnlock()
+    set(float64(n))
+  })
+  Metrics.Gauge("pageloop_files_bytes", "Source bytes of loaded application files.", func(set func(float64, ...string)) {
+    var n int
+    l.MountpointManager.RLock()
+    for _, c := range l.Host.Containers {
+      for _, app := range c.Apps {
+        for _, f := range app.Files {
+          n += len(f.Source(false))
+        }
+      }
+    }
+    l.MountpointManager.RUnlock()
+    set(float64(n))
+  })
+  Metrics.Register(&MetricVec{
+    Name: "pageloop_rpc_method_calls_total",
+    Help: "Service method calls counted by the service map.",
+    Type: MetricCounter,
+    Labels: []string{"method"},
+    Collect: func(set func(float64, ...string)) {
+      for _, info := range l.Services.Map() {
+        for _, mt := range info.Methods {
+          set(float64(mt.NumCalls()), mt.ServiceMethod)
+        }
+      }
+    }})
+}
+
 func init() {
   // Mime types set to those for code mirror modes
 	mime.AddExtensionType(".json", "application/json")
@@ -2,6 +2,7 @@ package service
 
 import(
   "fmt"
+  "regexp"
   "net/http"
   "strings"
   . "github.com/tmpfs/pageloop/core"
@@ -10,20 +11,31 @@ import(
 )
 
 // Handler for asynchronous background tasks.
-type TaskJobComplete struct {}
+type TaskJobComplete struct {
+  // Identifier for the request that started the job
+  RequestId string
+}
 
 func (tj *TaskJobComplete) Done(err error, job *Job) {
   // TODO: send reply to the client over websocket
-  fmt.Printf("[job:%d] completed %s\n", job.Number, job.Id)
   Jobs.Stop(job)
+  fields := Fields{"request-id": tj.RequestId, "job": job.Number, "id": job.Id, "runtime": job.Runtime}
+  if err != nil {
+    fields["error"] = err
+    Log.Warn("job failed", fields)
+    return
+  }
+  Log.Info("job completed", fields)
 }
 
 type ApplicationRequest struct {
+  Caller
+
   // Application name (id)
   Name string `json:"name"`
 
   // Container name
-  Container string `json:"container"`
+  Container string `json:"container" bind:"path:context"`
 
   // Application display name
   DisplayName string `json:"display"`
@@ -34,6 +46,9 @@ type ApplicationRequest struct {
   // Mark this application as a template
   IsTemplate bool `json:"is-template,omitempty"`
 
+  // Virtual host name for the application
+  Host string `json:"host,omitempty"`
+
 	// A source template for this application
 	Template *ApplicationTemplate `json:"template,omitempty"`
 }
@@ -44,28 +59,109 @@ func (req *ApplicationRequest) ToApplication(container *Container) *Application
     Name: req.Name,
     DisplayName: req.DisplayName,
     Description: req.Description,
-    IsTemplate: req.IsTemplate}
+    IsTemplate: req.IsTemplate,
+    Host: req.Host}
+}
+
+// Target reference for audit records.
+func (req *ApplicationRequest) Target() string {
+  return fmt.Sprintf("file://pageloop.com/%s/%s", req.Container, req.Name)
 }
 
 type ApplicationReferenceRequest struct {
+  Caller
+
   // A reference to an application in the form: file://pageloop.com/{container}/{application}
-  Ref string `json:"ref,omitempty"`
+  Ref string `json:"ref,omitempty" bind:"ref:app"`
+}
+
+// Target reference for audit records.
+func (req *ApplicationReferenceRequest) Target() string {
+  return req.Ref
 }
 
 type ApplicationBatchRequest struct {
+  Caller
+
   // A reference to an application in the form: file://pageloop.com/{container}/{application}
-  Ref string `json:"ref,omitempty"`
+  Ref string `json:"ref,omitempty" bind:"ref:app"`
 
   // List used for batch operations
-  Batch *UrlList `json:"batch,omitempty"`
+  Batch *UrlList `json:"batch,omitempty" bind:"body"`
+}
+
+// Target reference for audit records.
+func (req *ApplicationBatchRequest) Target() string {
+  return req.Ref
 }
 
 type ApplicationTaskRequest struct {
+  Caller
+
   // A reference to an application in the form: file://pageloop.com/{container}/{application}
-  Ref string `json:"ref,omitempty"`
+  Ref string `json:"ref,omitempty" bind:"ref:app"`
 
   // Name of a task to find
-  Task string `json:"task,omitempty"`
+  Task string `json:"task,omitempty" bind:"path:item"`
+}
+
+// Target reference for audit records.
+func (req *ApplicationTaskRequest) Target() string {
+  return req.Ref
+}
+
+type ApplicationSearchRequest struct {
+  Caller
+
+  // A reference to an application in the form: file://pageloop.com/{container}/{application}
+  Ref string `json:"ref,omitempty" bind:"ref:app"`
+
+  // Words to find, quoted words match a phrase
+  Query string `json:"query" bind:"query:q"`
+  // Filter by MIME type, eg: text/html or text/*
+  Mime string `json:"mime,omitempty" bind:"query:mime"`
+  // Filter by a glob matched against file URLs or names, eg: /docs/* or *.md
+  Path string `json:"path,omitempty" bind:"query:path"`
+  // Maximum number of results
+  Limit int `json:"limit,omitempty" bind:"query:limit"`
+}
+
+type ApplicationReplaceRequest struct {
+  Caller
+
+  // A reference to an application in the form: file://pageloop.com/{container}/{application}
+  Ref string `json:"ref,omitempty" bind:"ref:app"`
+
+  // Text to find, a regular expression when regexp is set
+  Pattern string `json:"pattern"`
+  // Replacement text, may refer to regular expression submatches, eg: $1
+  Replacement string `json:"replacement"`
+  Regexp bool `json:"regexp,omitempty"`
+  // Globs matched against file URLs or names, eg: /docs/* or *.md
+  Include string `json:"include,omitempty"`
+  Exclude string `json:"exclude,omitempty"`
+  // Preview the changes without saving
+  DryRun bool `json:"dry-run,omitempty"`
+}
+
+// Target reference for audit records.
+func (req *ApplicationReplaceRequest) Target() string {
+  return req.Ref
+}
+
+type ApplicationHostRequest struct {
+  Caller
+
+  // A reference to an application in the form: file://pageloop.com/{container}/{application}
+  Ref string `json:"ref,omitempty" bind:"ref:app"`
+
+  // Virtual host name, the empty string removes the virtual host
+  Host string `json:"host"`
+}
+
+// Target reference for audit records.
+func (req *ApplicationHostRequest) Target() string {
+  return req.Ref
 }
 
 type AppService struct {
@@ -73,15 +169,24 @@ type AppService struct {
 
   // Reference to the mountpoint manager
   Mountpoints *MountpointManager
+
+  // Access policy
+  Policy *Policy
+
+  // Deleted files and applications are moved to the trash when enabled
+  Trash *Trash
 }
 
 // Read an application.
 func (s *AppService) Read(req *ApplicationReferenceRequest, reply *ServiceReply) *StatusError {
   ref := &AssetReference{}
   ref.ParseUrl(req.Ref)
-  if _, app, err := ref.FindApplication(s.Host); err != nil {
+  if container, app, err := ref.FindApplication(s.Host); err != nil {
     return err
   } else {
+    if err := s.Policy.Authorize(req.User, PermissionRead, container.Name, app.Name); err != nil {
+      return err
+    }
     reply.Reply = app
   }
   return nil
@@ -91,9 +196,12 @@ func (s *AppService) Read(req *ApplicationReferenceRequest, reply *ServiceReply)
 func (s *AppService) ReadFiles(req *ApplicationReferenceRequest, reply *ServiceReply) *StatusError {
   ref := &AssetReference{}
   ref.ParseUrl(req.Ref)
-  if _, app, err := ref.FindApplication(s.Host); err != nil {
+  if container, app, err := ref.FindApplication(s.Host); err != nil {
     return err
   } else {
+    if err := s.Policy.Authorize(req.User, PermissionRead, container.Name, app.Name); err != nil {
+      return err
+    }
     reply.Reply = app.Files
   }
   return nil
@@ -103,14 +211,79 @@ func (s *AppService) ReadFiles(req *ApplicationReferenceRequest, reply *ServiceR
 func (s *AppService) ReadPages(req *ApplicationReferenceRequest, reply *ServiceReply) *StatusError {
   ref := &AssetReference{}
   ref.ParseUrl(req.Ref)
-  if _, app, err := ref.FindApplication(s.Host); err != nil {
+  if container, app, err := ref.FindApplication(s.Host); err != nil {
     return err
   } else {
+    if err := s.Policy.Authorize(req.User, PermissionRead, container.Name, app.Name); err != nil {
+      return err
+    }
     reply.Reply = app.Pages
   }
   return nil
 }
 
+// Search the source and rendered page text of the application files.
+func (s *AppService) Search(req *ApplicationSearchRequest, reply *ServiceReply) *StatusError {
+  ref := &AssetReference{}
+  ref.ParseUrl(req.Ref)
+  if container, app, err := ref.FindApplication(s.Host); err != nil {
+    return err
+  } else {
+    if err := s.Policy.Authorize(req.User, PermissionRead, container.Name, app.Name); err != nil {
+      return err
+    }
+    if req.Limit < 0 {
+      return CommandError(http.StatusBadRequest, "Limit may not be negative")
+    }
+    opts := &SearchOptions{Query: req.Query, Mime: req.Mime, Path: req.Path, Limit: req.Limit}
+    if results, err := app.Search(opts); err != nil {
+      return CommandError(http.StatusBadRequest, err.Error())
+    } else {
+      reply.Reply = results
+    }
+  }
+  return nil
+}
+
+// Find and replace text in the source of the application files,
+// a dry run replies with a diff for each file that would change.
+func (s *AppService) Replace(req *ApplicationReplaceRequest, reply *ServiceReply) *StatusError {
+  ref := &AssetReference{}
+  ref.ParseUrl(req.Ref)
+  if container, app, err := ref.FindApplication(s.Host); err != nil {
+    return err
+  } else {
+    perm := PermissionWrite
+    if req.DryRun {
+      perm = PermissionRead
+    }
+    if err := s.Policy.Authorize(req.User, perm, container.Name, app.Name); err != nil {
+      return err
+    }
+    opts := &ReplaceOptions{
+      Pattern: req.Pattern,
+      Replacement: req.Replacement,
+      Regexp: req.Regexp,
+      Include: req.Include,
+      Exclude: req.Exclude,
+      DryRun: req.DryRun}
+    if req.Pattern == "" {
+      return CommandError(http.StatusBadRequest, "Replace pattern is empty")
+    }
+    if req.Regexp {
+      if _, err := regexp.Compile(req.Pattern); err != nil {
+        return CommandError(http.StatusBadRequest, err.Error())
+      }
+    }
+    if results, err := app.Replace(opts); err != nil {
+      return CommandError(http.StatusInternalServerError, err.Error())
+    } else {
+      reply.Reply = results
+    }
+  }
+  return nil
+}
+
 // Delete an application.
 func (s *AppService) Delete(req *ApplicationReferenceRequest, reply *ServiceReply) *StatusError {
   //println("application delete called")
@@ -120,10 +293,13 @@ func (s *AppService) Delete(req *ApplicationReferenceRequest, reply *ServiceRepl
     //println("returning err")
     return err
   } else {
-    if app.Protected {
-      return CommandError(http.StatusForbidden, "Cannot delete protected application")
+    if err := s.Policy.Authorize(req.User, PermissionAdmin, container.Name, app.Name); err != nil {
+      return err
     }
 
+    // Kept so the application can be restored from the trash
+    mountpoint, persisted := s.Mountpoints.ApplicationMountpoint(app)
+
     // Stop serving files for the application
     s.Mountpoints.UnmountApplication(app)
 
@@ -133,7 +309,11 @@ func (s *AppService) Delete(req *ApplicationReferenceRequest, reply *ServiceRepl
     }
 
     // Delete the files
-    if err := app.DeleteApplicationFiles(); err != nil {
+    if s.Trash.Enabled() && persisted {
+      if _, err := s.Trash.AddApplication(app, mountpoint, req.User); err != nil {
+        return CommandError(http.StatusInternalServerError, err.Error())
+      }
+    } else if err := app.DeleteApplicationFiles(); err != nil {
       return CommandError(http.StatusInternalServerError, err.Error())
     }
 
@@ -143,13 +323,38 @@ func (s *AppService) Delete(req *ApplicationReferenceRequest, reply *ServiceRepl
   return nil
 }
 
+// Assign the virtual host for an application.
+func (s *AppService) SetHost(req *ApplicationHostRequest, reply *ServiceReply) *StatusError {
+  ref := &AssetReference{}
+  ref.ParseUrl(req.Ref)
+  if container, app, err := ref.FindApplication(s.Host); err != nil {
+    return err
+  } else {
+    if err := s.Policy.Authorize(req.User, PermissionAdmin, container.Name, app.Name); err != nil {
+      return err
+    }
+    if !s.Mountpoints.HasMountpoint(app.Url) {
+      return CommandError(http.StatusForbidden, "Cannot set the host for application %s", app.Url)
+    }
+    if err := s.Mountpoints.SetHost(app, req.Host); err != nil {
+      return CommandError(http.StatusPreconditionFailed, err.Error())
+    }
+    reply.Reply = app
+  }
+  return nil
+}
+
 // Batch delete files.
 func (s *AppService) DeleteFiles(req *ApplicationBatchRequest, reply *ServiceReply) *StatusError {
   ref := &AssetReference{}
   ref.ParseUrl(req.Ref)
-  if _, app, err := ref.FindApplication(s.Host); err != nil {
+  if container, app, err := ref.FindApplication(s.Host); err != nil {
     return err
   } else {
+    if err := s.Policy.Authorize(req.User, PermissionWrite, container.Name, app.Name); err != nil {
+      return err
+    }
+
     var file *File
     var files []*File
     for _, url := range *req.Batch {
@@ -158,7 +363,11 @@ func (s *AppService) DeleteFiles(req *ApplicationBatchRequest, reply *ServiceRep
         return CommandError(http.StatusNotFound, "File not found for url %s", url)
       }
 
-      if err := app.Del(file); err != nil {
+      if s.Trash.Enabled() {
+        if _, err := s.Trash.AddFile(app, file, req.User); err != nil {
+          return CommandError(http.StatusInternalServerError, err.Error())
+        }
+      } else if err := app.Del(file); err != nil {
         return CommandError(http.StatusInternalServerError, err.Error())
       }
 
@@ -174,10 +383,19 @@ func(s *AppService) RunTask(req *ApplicationTaskRequest, reply *ServiceReply) *S
   task := req.Task
   ref := &AssetReference{}
   ref.ParseUrl(req.Ref)
-  if _, app, err := ref.FindApplication(s.Host); err != nil {
+  if container, app, err := ref.FindApplication(s.Host); err != nil {
     return err
   } else {
     task = strings.TrimPrefix(task, SLASH)
+
+    // The main build task publishes the application
+    perm := PermissionRunTask
+    if task == "publish" {
+      perm = PermissionPublish
+    }
+    if err := s.Policy.Authorize(req.User, perm, container.Name, app.Name); err != nil {
+      return err
+    }
     // No build configuration of missing build task
     if !app.HasBuilder() {
       return CommandError(
@@ -190,13 +408,13 @@ func(s *AppService) RunTask(req *ApplicationTaskRequest, reply *ServiceReply) *S
     }
 
     // Run the task and get a job
-    if job, err := app.Builder.Run(task, &TaskJobComplete{}); err != nil {
+    if job, err := app.Builder.Run(task, &TaskJobComplete{RequestId: req.RequestId()}); err != nil {
       // Send conflict if job already running, this is a bit flaky is Run()
       // starts returning errors for other reasons :(
       return CommandError(http.StatusConflict, err.Error())
     } else {
       // Accepted for processing
-      fmt.Printf("[job:%d] started %s\n", job.Number, job.Id)
+      Log.Info("job started", Fields{"request-id": req.RequestId(), "job": job.Number, "id": job.Id})
 
       reply.Reply = job
       reply.Status = http.StatusAccepted
@@ -9,6 +9,7 @@ import(
   "archive/zip"
   "net/http"
   "path/filepath"
+  . "github.com/tmpfs/pageloop/core"
   . "github.com/tmpfs/pageloop/model"
   . "github.com/tmpfs/pageloop/util"
 )
@@ -22,17 +23,24 @@ const(
 type ArchiveService struct {
   // Reference to the host
   Host *Host
+
+  // Access policy
+  Policy *Policy
 }
 
 type ArchiveRequest struct {
+  Caller
+
   // Name of the output file
   Name string `json:"name"`
   // Type of archive to create. Full, source only or public only.
   Type int `json:"type"`
+  // Archive type by name (source or public), takes precedence over Type
+  Filter string `json:"filter,omitempty" bind:"path:item"`
   // A reference to an application in the form: file://pageloop.com/{container}/{application}
-  Ref string `json:"ref,omitempty"`
+  Ref string `json:"ref,omitempty" bind:"ref:app"`
   // Output stream
-  Writer io.Writer
+  Writer io.Writer `json:"-" bind:"writer"`
 }
 
 // Export a zip archive of application files.
@@ -104,9 +112,31 @@ func (s *ArchiveService) Export(archive *ArchiveRequest, reply *ServiceReply) *S
 
   ref := &AssetReference{}
   ref.ParseUrl(archive.Ref)
-  if _, a, err := ref.FindApplication(s.Host); err != nil {
+  if container, a, err := ref.FindApplication(s.Host); err != nil {
     return err
   } else {
+    if err := s.Policy.Authorize(archive.User, PermissionRead, container.Name, a.Name); err != nil {
+      return err
+    }
+
+    name := a.Name
+    switch strings.Trim(archive.Filter, SLASH) {
+      case "source":
+        archive.Type = ArchiveSource
+        name += "-source"
+      case "public":
+        archive.Type = ArchivePublic
+        name += "-public"
+    }
+    if archive.Name == "" {
+      archive.Name = name + ".zip"
+    }
+
+    // Download file name for HTTP responses
+    if res, ok := archive.Writer.(http.ResponseWriter); ok {
+      res.Header().Set("Content-Disposition", "attachment; filename=" + archive.Name)
+    }
+
     z := zip.NewWriter(archive.Writer)
     if archive.Type == ArchiveFull {
       if err := source(z, a, "/source"); err != nil {
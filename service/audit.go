@@ -0,0 +1,57 @@
+package service
+
+import(
+  "net/http"
+  . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+type AuditRequest struct {
+  Caller
+
+  // Filter by user name
+  Actor string `json:"user,omitempty" bind:"query:user"`
+  // Filter by service method name
+  Method string `json:"method,omitempty" bind:"query:method"`
+  // Filter by records whose target contains this string
+  Target string `json:"target,omitempty" bind:"query:target"`
+  // Filter by outcome status code
+  Status int `json:"status,omitempty" bind:"query:status"`
+  // Number of records to skip
+  Offset int `json:"offset,omitempty" bind:"query:offset"`
+  // Maximum number of records to return
+  Limit int `json:"limit,omitempty" bind:"query:limit"`
+}
+
+type AuditService struct {
+  // Access policy
+  Policy *Policy
+}
+
+// List audit records, most recent first.
+func (s *AuditService) List(req *AuditRequest, reply *ServiceReply) *StatusError {
+  if err := s.Policy.Authorize(req.User, PermissionAdmin, "", ""); err != nil {
+    return err
+  }
+
+  if req.Offset < 0 || req.Limit < 0 {
+    return CommandError(http.StatusBadRequest, "Offset and limit may not be negative")
+  }
+
+  limit := req.Limit
+  if limit == 0 {
+    limit = 100
+  }
+
+  filter := &AuditFilter{
+    User: req.Actor,
+    ServiceMethod: req.Method,
+    Target: req.Target,
+    Status: req.Status}
+  if page, err := Audit.List(filter, req.Offset, limit); err != nil {
+    return CommandError(http.StatusInternalServerError, err.Error())
+  } else {
+    reply.Reply = page
+  }
+  return nil
+}
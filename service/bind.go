@@ -0,0 +1,60 @@
+package service
+
+import(
+  "reflect"
+  "strings"
+  "net/http"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+// Sources for REST request data assigned to service method argument
+// fields using the bind struct tag, eg: `bind:"path:context"`.
+//
+// Fields without a bind tag are decoded from a JSON request body in
+// the same way that websocket params are decoded.
+const(
+  // Route path parameter: context, target, filter or item.
+  BindPath = "path"
+  // Asset reference built from the route path: app or file.
+  BindRef = "ref"
+  // Query string parameter.
+  BindQuery = "query"
+  // Request header.
+  BindHeader = "header"
+  // Request body, raw for byte slices otherwise decoded as JSON.
+  BindBody = "body"
+  // Output stream for the response.
+  BindWriter = "writer"
+)
+
+// Get the source and name from the bind tag of a field, the source is
+// the empty string when the field is not bound.
+func BindTag(field reflect.StructField) (source string, name string) {
+  tag := field.Tag.Get("bind")
+  if tag == "" {
+    return "", ""
+  }
+  parts := strings.SplitN(tag, ":", 2)
+  source = parts[0]
+  if len(parts) > 1 {
+    name = parts[1]
+  }
+  return source, name
+}
+
+// Validate service method arguments against the JSON schema declared
+// in the service meta information, methods without a schema are valid.
+func ValidateArgs(method string, argv interface{}) *StatusError {
+  meta := ServicesMetaInfo[method]
+  if meta == nil || meta.Schema == nil {
+    return nil
+  }
+  result, err := HttpUtil{}.ValidateInterface(meta.Schema, argv)
+  if err != nil {
+    return CommandError(http.StatusBadRequest, err.Error())
+  }
+  if result != nil && !result.Valid() {
+    return CommandError(http.StatusBadRequest, result.Errors()[0].String())
+  }
+  return nil
+}
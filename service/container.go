@@ -14,10 +14,14 @@ type ContainerService struct {
 
   // Reference to the mountpoint manager
   Mountpoints *MountpointManager
+
+  // Access policy
+  Policy *Policy
 }
 
 type ContainerRequest struct {
-  Name string `json:"name"`
+  Caller
+  Name string `json:"name" bind:"path:context"`
 }
 
 // Read a container.
@@ -25,6 +29,9 @@ func (s *ContainerService) Read(container *ContainerRequest, reply *ServiceReply
   if c, err := LookupContainer(s.Host, container); err != nil {
     return err
   } else {
+    if err := s.Policy.Authorize(container.User, PermissionRead, c.Name, ""); err != nil {
+      return err
+    }
     reply.Reply = c
   }
   return nil
@@ -36,9 +43,8 @@ func (s *ContainerService) CreateApp(req *ApplicationRequest, reply *ServiceRepl
   if container, err := LookupContainer(s.Host, cr); err != nil {
     return err
   } else {
-    // TODO: do not allow creating apps on non-user containers!
-    if container.Protected {
-      return CommandError(http.StatusForbidden, "Cannot create applications in a protected container.")
+    if err := s.Policy.Authorize(req.User, PermissionAdmin, container.Name, ""); err != nil {
+      return err
     }
 
     app := req.ToApplication(container)
@@ -57,6 +63,14 @@ func (s *ContainerService) CreateApp(req *ApplicationRequest, reply *ServiceRepl
       return CommandError(http.StatusPreconditionFailed, "Mountpoint URL %s already exists", app.Url)
     }
 
+    // Virtual host must be valid and unused, the normalized name is persisted
+    if app.Host != "" {
+      var err error
+      if app.Host, err = s.Mountpoints.CheckHost(app.Host, nil); err != nil {
+        return CommandError(http.StatusBadRequest, err.Error())
+      }
+    }
+
     // Create and save a mountpoint for the application.
     if mountpoint, err := s.Mountpoints.CreateMountpoint(app); err != nil {
       return CommandError(http.StatusInternalServerError, err.Error())
@@ -65,10 +79,12 @@ func (s *ContainerService) CreateApp(req *ApplicationRequest, reply *ServiceRepl
       if req.Template != nil {
         // Find the template application.
         if source, err := s.Host.LookupTemplate(req.Template); err != nil {
+          s.Mountpoints.DeleteApplicationMountpoint(mountpoint.Url)
           return CommandError(http.StatusBadRequest, err.Error())
         } else {
           // Copy template source files.
           if err := app.CopyApplicationTemplate(source); err != nil {
+            s.Mountpoints.DeleteApplicationMountpoint(mountpoint.Url)
             return CommandError(http.StatusInternalServerError, err.Error())
           }
         }
@@ -77,8 +93,13 @@ func (s *ContainerService) CreateApp(req *ApplicationRequest, reply *ServiceRepl
       // Load and publish the app source files, note that we get a new application back
       // after loading the mountpoint.
       if app, err = s.Mountpoints.LoadMountpoint(*mountpoint, container); err != nil {
+        // Do not keep a mountpoint that prevents the server from starting
+        s.Mountpoints.DeleteApplicationMountpoint(mountpoint.Url)
         return CommandError(http.StatusInternalServerError, err.Error())
       } else {
+        // Assign the protected flag for the new application
+        s.Policy.Protect(container)
+
         // Reply with the new application reference
         reply.Reply = app
         reply.Status = http.StatusCreated
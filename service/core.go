@@ -6,18 +6,35 @@
 //
 // Currently the fields of the method argument must be simple types and slices
 // nested structs are not currently supported.
+//
+// Argument types are taken from the method signature, for REST requests the
+// bind struct tag declares where a field value comes from (path, query, header
+// or body) and for websocket requests the JSON-RPC params are decoded. Methods
+// may declare a JSON schema that the arguments are validated against for
+// both transports.
 package service
 
 import(
-  //"fmt"
+  "net/http"
   . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/util"
 )
 
 // Type for service methods that do not accept any arguments.
 type VoidArgs struct {}
 
+// Arguments for service methods that only require the caller.
+type CallerArgs struct {
+  Caller
+}
+
 // CoreService service.
-type CoreService struct {}
+type CoreService struct {
+  // Mountpoint manager
+  Mountpoints *MountpointManager
+  // Access policy
+  Policy *Policy
+}
 
 // Meta information (/).
 func (s *CoreService) Meta(argv *VoidArgs, reply *MetaInfo) error {
@@ -39,3 +56,22 @@ func (c *CoreService) Stats(argv *VoidArgs, reply *Statistics) error {
 
   return nil
 }
+
+// Reload the configuration file and apply mountpoint changes (/config/reload).
+func (s *CoreService) ReloadConfig(argv *CallerArgs, reply *ServiceReply) *StatusError {
+  if err := s.Policy.Authorize(argv.User, PermissionAdmin, "", ""); err != nil {
+    return err
+  }
+
+  changes, err := s.Mountpoints.Reload()
+  if err != nil {
+    if changes == nil {
+      // Invalid configuration, nothing was changed
+      return CommandError(http.StatusBadRequest, err.Error())
+    }
+    return CommandError(http.StatusInternalServerError, err.Error())
+  }
+
+  reply.Reply = changes
+  return nil
+}
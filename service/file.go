@@ -5,6 +5,7 @@ import(
   // "strings"
   "net/http"
   // "net/url"
+  . "github.com/tmpfs/pageloop/core"
   . "github.com/tmpfs/pageloop/model"
   . "github.com/tmpfs/pageloop/util"
 )
@@ -18,42 +19,90 @@ type FileRef struct {
 */
 
 type FileReferenceRequest struct {
+  Caller
+
+  // A reference to a file in the form: file://pageloop.com/{container}/{application}#{url}
+  Ref string `json:"ref,omitempty" bind:"ref:file"`
+}
+
+// Target reference for audit records.
+func (req *FileReferenceRequest) Target() string {
+  return req.Ref
+}
+
+type FileDeleteRequest struct {
+  Caller
+
   // A reference to a file in the form: file://pageloop.com/{container}/{application}#{url}
-  Ref string `json:"ref,omitempty"`
+  Ref string `json:"ref,omitempty" bind:"ref:file"`
+  // Delete a directory and all the files below it
+  Recursive bool `json:"recursive,omitempty" bind:"query:recursive"`
+}
+
+// Target reference for audit records.
+func (req *FileDeleteRequest) Target() string {
+  return req.Ref
 }
 
 type FileMoveRequest struct {
+  Caller
+
   // A reference to a file in the form: file://pageloop.com/{container}/{application}#{url}
-  Ref string `json:"ref,omitempty"`
-  // Destination for file move operations
-  Destination string `json:"destination,omitempty"`
+  Ref string `json:"ref,omitempty" bind:"ref:file"`
+  // Destination for file move and copy operations
+  Destination string `json:"destination,omitempty" bind:"header:Location"`
+}
+
+// Target reference for audit records.
+func (req *FileMoveRequest) Target() string {
+  return req.Ref
 }
 
 type FileContentRequest struct {
+  Caller
+
   // A reference to a file in the form: file://pageloop.com/{container}/{application}#{url}
-  Ref string `json:"ref,omitempty"`
+  Ref string `json:"ref,omitempty" bind:"ref:file"`
 
   // An input value for the file content, passed in when creating or
   // updating files that are not binary
   Value string `json:"value,omitempty"`
 
   // Value specified as a byte slice, when receiving POST and PUT requests
-  Bytes []byte
+  Bytes []byte `bind:"body"`
+}
+
+// Target reference for audit records.
+func (req *FileContentRequest) Target() string {
+  return req.Ref
 }
 
 type FileTemplateRequest struct {
+  Caller
+
   // A reference to a file in the form: file://pageloop.com/{container}/{application}#{url}
-  Ref string `json:"ref,omitempty"`
+  Ref string `json:"ref,omitempty" bind:"ref:file"`
 
   // Value specified as a byte slice, used when creating files from templates
   Bytes []byte
 
 	// A source template for this file
-	Template *ApplicationTemplate `json:"template,omitempty"`
+	Template *ApplicationTemplate `json:"template,omitempty" bind:"body"`
+}
+
+// Target reference for audit records.
+func (req *FileTemplateRequest) Target() string {
+  return req.Ref
 }
 
 type FileService struct {
   Host *Host
+
+  // Access policy
+  Policy *Policy
+
+  // Deleted files are moved to the trash when enabled
+  Trash *Trash
 }
 
 // Read a file.
@@ -63,10 +112,29 @@ func (s *FileService) Read(req *FileReferenceRequest, reply *ServiceReply) *Stat
   }
   ref := &AssetReference{}
   ref.ParseUrl(req.Ref)
-  if _, _, file, err := ref.FindFile(s.Host); err != nil {
+  if container, app, file, err := ref.FindFile(s.Host); err != nil {
     return err
   } else {
+    if err := s.Policy.Authorize(req.User, PermissionRead, container.Name, app.Name); err != nil {
+      return err
+    }
     reply.Reply = file
+    reply.Modified = file.ModTime()
+  }
+  return nil
+}
+
+// List the files in a directory.
+func (s *FileService) ReadChildren(req *FileReferenceRequest, reply *ServiceReply) *StatusError {
+  ref := &AssetReference{}
+  ref.ParseUrl(req.Ref)
+  if container, app, dir, err := ref.FindDirectory(s.Host); err != nil {
+    return err
+  } else {
+    if err := s.Policy.Authorize(req.User, PermissionRead, container.Name, app.Name); err != nil {
+      return err
+    }
+    reply.Reply = dir.Children()
   }
   return nil
 }
@@ -78,28 +146,46 @@ func (s *FileService) ReadPage(req *FileReferenceRequest, reply *ServiceReply) *
   }
   ref := &AssetReference{}
   ref.ParseUrl(req.Ref)
-  if _, _, file, err := ref.FindFile(s.Host); err != nil {
+  if container, app, file, err := ref.FindFile(s.Host); err != nil {
     return err
   } else {
+    if err := s.Policy.Authorize(req.User, PermissionRead, container.Name, app.Name); err != nil {
+      return err
+    }
     if file.Page() == nil {
       return CommandError(http.StatusNotFound, "Page %s not found", ref.Url())
     }
     reply.Reply = file.Page()
+    reply.Modified = file.ModTime()
   }
   return nil
 }
 
-// Delete a file.
-func (s *FileService) Delete(req *FileReferenceRequest, reply *ServiceReply) *StatusError {
+// Delete a file, a directory that is not empty is only
+// deleted when the recursive flag is set. When the trash is
+// enabled the file is moved to the trash.
+func (s *FileService) Delete(req *FileDeleteRequest, reply *ServiceReply) *StatusError {
   if req.Ref == "" {
     return CommandError(http.StatusBadRequest, "No file reference for delete operation")
   }
   ref := &AssetReference{}
   ref.ParseUrl(req.Ref)
-  if _, app, file, err := ref.FindFile(s.Host); err != nil {
+  if container, app, file, err := ref.FindFile(s.Host); err != nil {
     return err
   } else {
-    if err := app.Del(file); err != nil {
+    if err := s.Policy.Authorize(req.User, PermissionWrite, container.Name, app.Name); err != nil {
+      return err
+    }
+
+    if file.Directory && len(file.Children()) > 0 && !req.Recursive {
+      return CommandError(http.StatusConflict, "Directory %s is not empty", file.Url)
+    }
+
+    if s.Trash.Enabled() {
+      if _, err := s.Trash.AddFile(app, file, req.User); err != nil {
+        return CommandError(http.StatusInternalServerError, err.Error())
+      }
+    } else if err := app.Del(file); err != nil {
       return CommandError(http.StatusInternalServerError, err.Error())
     }
     reply.Reply = file
@@ -117,9 +203,13 @@ func (s *FileService) Move(req *FileMoveRequest, reply *ServiceReply) *StatusErr
   }
   ref := &AssetReference{}
   ref.ParseUrl(req.Ref)
-  if _, app, file, err := ref.FindFile(s.Host); err != nil {
+  if container, app, file, err := ref.FindFile(s.Host); err != nil {
     return err
   } else {
+    if err := s.Policy.Authorize(req.User, PermissionWrite, container.Name, app.Name); err != nil {
+      return err
+    }
+
     if err := app.Move(file, req.Destination); err != nil {
       return CommandError(http.StatusInternalServerError, err.Error())
     }
@@ -128,6 +218,33 @@ func (s *FileService) Move(req *FileMoveRequest, reply *ServiceReply) *StatusErr
   return nil
 }
 
+// Copy a file or directory.
+func (s *FileService) Copy(req *FileMoveRequest, reply *ServiceReply) *StatusError {
+  if req.Ref == "" {
+    return CommandError(http.StatusBadRequest, "No file reference for copy operation")
+  }
+  if req.Destination == "" {
+    return CommandError(http.StatusBadRequest, "No destination for copy operation")
+  }
+  ref := &AssetReference{}
+  ref.ParseUrl(req.Ref)
+  if container, app, file, err := ref.FindFile(s.Host); err != nil {
+    return err
+  } else {
+    if err := s.Policy.Authorize(req.User, PermissionWrite, container.Name, app.Name); err != nil {
+      return err
+    }
+
+    if copied, err := app.Copy(file, req.Destination); err != nil {
+      return CommandError(http.StatusInternalServerError, err.Error())
+    } else {
+      reply.Reply = copied
+      reply.Status = http.StatusCreated
+    }
+  }
+  return nil
+}
+
 // Read file content.
 func (s *FileService) ReadSource(req *FileReferenceRequest, reply *ServiceReply) *StatusError {
   if req.Ref == "" {
@@ -135,10 +252,14 @@ func (s *FileService) ReadSource(req *FileReferenceRequest, reply *ServiceReply)
   }
   ref := &AssetReference{}
   ref.ParseUrl(req.Ref)
-  if _, _, file, err := ref.FindFile(s.Host); err != nil {
+  if container, app, file, err := ref.FindFile(s.Host); err != nil {
     return err
   } else {
+    if err := s.Policy.Authorize(req.User, PermissionRead, container.Name, app.Name); err != nil {
+      return err
+    }
     reply.Reply = file.Source(false)
+    reply.Modified = file.ModTime()
   }
   return nil
 }
@@ -150,10 +271,37 @@ func (s *FileService) ReadSourceRaw(req *FileReferenceRequest, reply *ServiceRep
   }
   ref := &AssetReference{}
   ref.ParseUrl(req.Ref)
-  if _, _, file, err := ref.FindFile(s.Host); err != nil {
+  if container, app, file, err := ref.FindFile(s.Host); err != nil {
     return err
   } else {
+    if err := s.Policy.Authorize(req.User, PermissionRead, container.Name, app.Name); err != nil {
+      return err
+    }
     reply.Reply = file.Source(true)
+    reply.Modified = file.ModTime()
+  }
+  return nil
+}
+
+// Read the rendered page, pages that are not published
+// can be previewed by users with write permission.
+func (s *FileService) Preview(req *FileReferenceRequest, reply *ServiceReply) *StatusError {
+  if req.Ref == "" {
+    return CommandError(http.StatusBadRequest, "No file reference for preview operation")
+  }
+  ref := &AssetReference{}
+  ref.ParseUrl(req.Ref)
+  if container, app, file, err := ref.FindFile(s.Host); err != nil {
+    return err
+  } else {
+    if err := s.Policy.Authorize(req.User, PermissionWrite, container.Name, app.Name); err != nil {
+      return err
+    }
+    if file.Page() == nil {
+      return CommandError(http.StatusBadRequest, "File %s is not a page", file.Url)
+    }
+    reply.Reply = file.Data()
+    reply.Modified = file.ModTime()
   }
   return nil
 }
@@ -165,12 +313,18 @@ func (s *FileService) Save(req *FileContentRequest, reply *ServiceReply) *Status
   }
   ref := &AssetReference{}
   ref.ParseUrl(req.Ref)
-  if _, app, file, err := ref.FindFile(s.Host); err != nil {
+  if container, app, file, err := ref.FindFile(s.Host); err != nil {
     return err
   } else {
-    // File content from string value
+    if err := s.Policy.Authorize(req.User, PermissionWrite, container.Name, app.Name); err != nil {
+      return err
+    }
+
+    // File content from string value or the request body
     if req.Value != "" {
       file.Bytes([]byte(req.Value))
+    } else if req.Bytes != nil {
+      file.Bytes(req.Bytes)
     }
 
     var content []byte = file.Source(false)
@@ -196,9 +350,13 @@ func (s *FileService) Create(req *FileContentRequest, reply *ServiceReply) *Stat
   }
   ref := &AssetReference{}
   ref.ParseUrl(req.Ref)
-  if _, app, err := ref.FindApplication(s.Host); err != nil {
+  if container, app, err := ref.FindApplication(s.Host); err != nil {
     return err
   } else {
+    if err := s.Policy.Authorize(req.User, PermissionWrite, container.Name, app.Name); err != nil {
+      return err
+    }
+
     var exists *File = app.Urls[ref.Url()]
     if exists != nil {
       return CommandError(http.StatusConflict,"File already exists %s", ref.Url())
@@ -229,13 +387,17 @@ func (s *FileService) CreateTemplate(req *FileTemplateRequest, reply *ServiceRep
     return CommandError(http.StatusBadRequest, "No template given")
   }
 
+  if err := s.Policy.Authorize(req.User, PermissionRead, template.Container, template.Application); err != nil {
+    return err
+  }
+
   if tpl, err := s.Host.LookupTemplateFile(template); err != nil {
     return CommandError(http.StatusInternalServerError, err.Error())
   } else {
     if tpl == nil {
       return CommandError(http.StatusNotFound, "Template file %s does not exist", template.File)
     }
-    creq := &FileContentRequest{Ref: req.Ref}
+    creq := &FileContentRequest{Caller: req.Caller, Ref: req.Ref}
     creq.Bytes = tpl.Source(true)
     return s.Create(creq, reply)
   }
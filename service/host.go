@@ -2,16 +2,69 @@ package service
 
 import(
   //"fmt"
+  "net/http"
+  . "github.com/tmpfs/pageloop/core"
   . "github.com/tmpfs/pageloop/model"
   . "github.com/tmpfs/pageloop/util"
 )
 
+type SearchRequest struct {
+  Caller
+
+  // Words to find, quoted words match a phrase
+  Query string `json:"query" bind:"query:q"`
+  // Filter by MIME type, eg: text/html or text/*
+  Mime string `json:"mime,omitempty" bind:"query:mime"`
+  // Filter by a glob matched against file URLs or names, eg: /docs/* or *.md
+  Path string `json:"path,omitempty" bind:"query:path"`
+  // Maximum number of results
+  Limit int `json:"limit,omitempty" bind:"query:limit"`
+}
+
+// Get the search options for the request.
+func (req *SearchRequest) Options() *SearchOptions {
+  return &SearchOptions{Query: req.Query, Mime: req.Mime, Path: req.Path, Limit: req.Limit}
+}
+
 type HostService struct {
   Host *Host
+
+  // Access policy
+  Policy *Policy
+}
+
+// List the containers and applications the caller can read.
+func (s *HostService) List(argv *CallerArgs, reply *ServiceReply) *StatusError {
+  list := make([]*Container, 0)
+  for _, c := range s.Host.Containers {
+    apps := make([]*Application, 0)
+    for _, app := range c.Apps {
+      if s.Policy.Allow(argv.User, PermissionRead, c.Name, app.Name) {
+        apps = append(apps, app)
+      }
+    }
+    if len(apps) == 0 && !s.Policy.Allow(argv.User, PermissionRead, c.Name, "") {
+      continue
+    }
+    visible := *c
+    visible.Apps = apps
+    list = append(list, &visible)
+  }
+  reply.Reply = list
+  return nil
 }
 
-// List containers.
-func (s *HostService) List(argv *VoidArgs, reply *ServiceReply) *StatusError {
-  reply.Reply = s.Host.Containers
+// Search the files of the applications the caller can read.
+func (s *HostService) Search(req *SearchRequest, reply *ServiceReply) *StatusError {
+  if req.Limit < 0 {
+    return CommandError(http.StatusBadRequest, "Limit may not be negative")
+  }
+  results, err := s.Host.Search(req.Options(), func(app *Application) bool {
+    return s.Policy.Allow(req.User, PermissionRead, app.Container.Name, app.Name)
+  })
+  if err != nil {
+    return CommandError(http.StatusBadRequest, err.Error())
+  }
+  reply.Reply = results
   return nil
 }
@@ -1,20 +1,36 @@
 package service
 
 import(
-  "fmt"
   "net/http"
+  . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/model"
   . "github.com/tmpfs/pageloop/util"
 )
 
 type JobRequest struct {
-  Id string `json:"id"`
+  Caller
+  Id string `json:"id" bind:"path:context"`
 }
 
-type JobService struct {}
+// Target job identifier for audit records.
+func (req *JobRequest) Target() string {
+  return req.Id
+}
+
+type JobService struct {
+  // Access policy
+  Policy *Policy
+}
 
-// List active jobs.
-func (s *JobService) List(argv *VoidArgs, reply *ServiceReply) *StatusError {
-  reply.Reply = Jobs.Active
+// List active jobs for the applications the caller can read.
+func (s *JobService) List(argv *CallerArgs, reply *ServiceReply) *StatusError {
+  list := make([]*Job, 0)
+  for _, job := range Jobs.List() {
+    if s.authorize(argv.User, PermissionRead, job) == nil {
+      list = append(list, job)
+    }
+  }
+  reply.Reply = list
   return nil
 }
 
@@ -23,16 +39,26 @@ func (s *JobService) Read(req *JobRequest, reply *ServiceReply) *StatusError {
   if job, err := LookupJob(req.Id); err != nil {
     return err
   } else {
+    if err := s.authorize(req.User, PermissionRead, job); err != nil {
+      return err
+    }
     reply.Reply = job
   }
   return nil
 }
 
-// Abort an active job.
+// Abort an active job, requires the permission to run the task.
 func(s *JobService) Delete(req *JobRequest, reply *ServiceReply) *StatusError {
   if job, err := LookupJob(req.Id); err != nil {
     return err
   } else {
+    perm := PermissionRunTask
+    if task, ok := job.Runner.(*Task); ok && task.Key == "publish" {
+      perm = PermissionPublish
+    }
+    if err := s.authorize(req.User, perm, job); err != nil {
+      return err
+    }
     if err := Jobs.Abort(job); err != nil {
       return CommandError(http.StatusConflict, err.Error())
     }
@@ -41,13 +67,23 @@ func(s *JobService) Delete(req *JobRequest, reply *ServiceReply) *StatusError {
     reply.Status = http.StatusAccepted
 
     // Accepted for processing
-    fmt.Printf("[job:%d] aborted %s\n", job.Number, job.Id)
+    Log.Info("job aborted", Fields{"request-id": req.RequestId(), "job": job.Number, "id": job.Id})
   }
   return nil
 }
 
 // Private
 
+// Check a permission for the application that started a job, other
+// jobs require the permission for the host.
+func (s *JobService) authorize(user string, perm Permission, job *Job) *StatusError {
+  var container, application string
+  if task, ok := job.Runner.(*Task); ok {
+    container, application = task.Target()
+  }
+  return s.Policy.Authorize(user, perm, container, application)
+}
+
 func LookupJob(id string) (*Job, *StatusError) {
   var job *Job = Jobs.ActiveJob(id)
   if job == nil {
@@ -0,0 +1,445 @@
+package service
+
+import(
+  "fmt"
+  "time"
+  "reflect"
+  "strings"
+  "net/http"
+  "encoding/json"
+  . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/rpc"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+const(
+  OpenApiVersion = "3.0.0"
+)
+
+var(
+  serviceReplyType = reflect.TypeOf(ServiceReply{})
+  timeType = reflect.TypeOf(time.Time{})
+  bytesType = reflect.TypeOf([]byte{})
+  marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+  // Names for wildcard path segments keyed by the first path segment,
+  // the values are the names for the context and target segments.
+  openApiSegments = map[string][]string{
+    "apps": []string{"container", "application"},
+    "jobs": []string{"id"},
+    "services": []string{"service", "method"},
+    "trash": []string{"id"}}
+
+  // Names for item wildcards keyed by the preceding path segment.
+  openApiItems = map[string]string{
+    "files": "file",
+    "pages": "page",
+    "src": "file",
+    "raw": "file",
+    "children": "url",
+    "copy": "url",
+    "preview": "url",
+    "tasks": "task"}
+)
+
+// A JSON schema object.
+type Schema map[string]interface{}
+
+type OpenApi struct {
+  OpenApi string `json:"openapi"`
+  Info OpenApiInfo `json:"info"`
+  Servers []OpenApiServer `json:"servers"`
+  Paths map[string]map[string]*OpenApiOperation `json:"paths"`
+  Components OpenApiComponents `json:"components"`
+  Security []map[string][]string `json:"security"`
+}
+
+type OpenApiInfo struct {
+  Title string `json:"title"`
+  Version string `json:"version"`
+}
+
+type OpenApiServer struct {
+  Url string `json:"url"`
+}
+
+type OpenApiOperation struct {
+  OperationId string `json:"operationId"`
+  Summary string `json:"summary,omitempty"`
+  Description string `json:"description,omitempty"`
+  Tags []string `json:"tags"`
+  Parameters []*OpenApiParameter `json:"parameters,omitempty"`
+  RequestBody *OpenApiBody `json:"requestBody,omitempty"`
+  Responses map[string]*OpenApiResponse `json:"responses"`
+  // Service method invoked by the operation
+  ServiceMethod string `json:"x-service-method"`
+}
+
+type OpenApiParameter struct {
+  Name string `json:"name"`
+  In string `json:"in"`
+  Description string `json:"description,omitempty"`
+  Required bool `json:"required"`
+  Schema Schema `json:"schema"`
+}
+
+type OpenApiBody struct {
+  Required bool `json:"required"`
+  Content map[string]*OpenApiMedia `json:"content"`
+}
+
+type OpenApiResponse struct {
+  Description string `json:"description"`
+  Content map[string]*OpenApiMedia `json:"content,omitempty"`
+}
+
+type OpenApiMedia struct {
+  Schema Schema `json:"schema"`
+}
+
+type OpenApiComponents struct {
+  Schemas map[string]Schema `json:"schemas"`
+  SecuritySchemes map[string]Schema `json:"securitySchemes"`
+}
+
+// Generate an OpenAPI document for the REST API by walking the
+// routes in router and the registered services.
+//
+// Wildcard path segments become named path parameters, argument
+// structs become request schemas and reply types become response
+// schemas. Service methods that reply with ServiceReply use the
+// reply type declared in the service meta information.
+func NewOpenApi(services map[string]*ServiceInfo, router *Router) *OpenApi {
+  doc := &OpenApi{
+    OpenApi: OpenApiVersion,
+    Info: OpenApiInfo{Title: MetaData.Name, Version: MetaData.Version},
+    Servers: []OpenApiServer{OpenApiServer{Url: strings.TrimSuffix(API_URL, "/")}},
+    Paths: make(map[string]map[string]*OpenApiOperation),
+    Components: OpenApiComponents{
+      Schemas: make(map[string]Schema),
+      SecuritySchemes: map[string]Schema{"basic": Schema{"type": "http", "scheme": "basic"}}},
+    // Anonymous or basic authentication
+    Security: []map[string][]string{map[string][]string{}, map[string][]string{"basic": []string{}}}}
+
+  gen := &schemaGenerator{schemas: doc.Components.Schemas, types: make(map[string]reflect.Type)}
+  doc.Components.Schemas["StatusError"] = gen.schema(reflect.TypeOf(StatusError{}))
+
+  ids := make(map[string]int)
+  for _, route := range router.Routes() {
+    method := lookupRouteMethod(services, route.ServiceMethod)
+    if method == nil {
+      continue
+    }
+
+    path, params := openApiPath(route)
+    verb := strings.ToLower(route.Method)
+    if doc.Paths[path] == nil {
+      doc.Paths[path] = make(map[string]*OpenApiOperation)
+    }
+
+    meta := ServicesMetaInfo[route.ServiceMethod]
+
+    // Several service methods share a path and verb and are
+    // selected on the request, document the alternatives
+    if existing := doc.Paths[path][verb]; existing != nil {
+      if existing.ServiceMethod != route.ServiceMethod {
+        line := fmt.Sprintf("Calls %s when the request matches", route.ServiceMethod)
+        if meta != nil {
+          line += ": " + meta.Description
+        }
+        existing.Description = strings.TrimSpace(existing.Description + "\n\n" + line)
+      }
+      continue
+    }
+
+    op := &OpenApiOperation{
+      ServiceMethod: route.ServiceMethod,
+      Tags: []string{method.Service},
+      Parameters: params,
+      Responses: make(map[string]*OpenApiResponse)}
+
+    // Operation identifiers must be unique
+    op.OperationId = route.ServiceMethod
+    if n := ids[route.ServiceMethod]; n > 0 {
+      op.OperationId = fmt.Sprintf("%s.%d", route.ServiceMethod, n)
+    }
+    ids[route.ServiceMethod]++
+
+    if meta != nil {
+      op.Summary = meta.Description
+    }
+
+    // Request arguments from the bind tags
+    op.Parameters = append(op.Parameters, gen.parameters(method.Arg)...)
+    op.RequestBody = gen.body(method.Arg, route.Method)
+
+    // Response
+    status := route.Status
+    if status == 0 {
+      status = http.StatusOK
+    }
+    res := &OpenApiResponse{Description: http.StatusText(status)}
+    switch route.ResponseType {
+      case ResponseTypeByte:
+        res.Content = map[string]*OpenApiMedia{
+          "application/octet-stream": &OpenApiMedia{Schema: Schema{"type": "string", "format": "binary"}}}
+      case ResponseTypeNone:
+        res.Content = map[string]*OpenApiMedia{
+          "application/zip": &OpenApiMedia{Schema: Schema{"type": "string", "format": "binary"}}}
+      default:
+        reply := method.Reply
+        if reply != nil && reply.Elem() == serviceReplyType {
+          reply = nil
+          if meta != nil {
+            reply = meta.Reply
+          }
+        }
+        schema := Schema{}
+        if reply != nil {
+          schema = gen.schema(reply)
+        }
+        res.Content = map[string]*OpenApiMedia{"application/json": &OpenApiMedia{Schema: schema}}
+    }
+    op.Responses[fmt.Sprintf("%d", status)] = res
+    op.Responses["default"] = &OpenApiResponse{
+      Description: "Error",
+      Content: map[string]*OpenApiMedia{
+        "application/json": &OpenApiMedia{Schema: Schema{"$ref": "#/components/schemas/StatusError"}}}}
+
+    doc.Paths[path][verb] = op
+  }
+  return doc
+}
+
+// Private
+
+// Find the service method information for a route.
+func lookupRouteMethod(services map[string]*ServiceInfo, serviceMethod string) *ServiceMethodInfo {
+  parts := strings.SplitN(serviceMethod, ".", 2)
+  if len(parts) != 2 {
+    return nil
+  }
+  method, err := LookupServiceMethod(services, strings.ToLower(parts[0]), parts[1])
+  if err != nil {
+    return nil
+  }
+  return method
+}
+
+// Convert a route definition path to an OpenAPI path with named parameters.
+func openApiPath(route *Route) (string, []*OpenApiParameter) {
+  var params []*OpenApiParameter
+  if route.Parameters == nil || len(route.Parameters.Parts) == 0 || route.Path == "" {
+    return "/", params
+  }
+
+  parts := route.Parameters.Parts
+  names := openApiSegments[parts[0]]
+  var out []string
+  for i, part := range parts {
+    part = strings.TrimPrefix(part, "/")
+    if part != "*" {
+      out = append(out, part)
+      continue
+    }
+
+    var name, desc string
+    if i > 0 && i <= len(names) {
+      name = names[i - 1]
+    } else if item, ok := openApiItems[parts[i - 1]]; ok {
+      name = item
+    } else {
+      name = fmt.Sprintf("param%d", i)
+    }
+    if i == 4 {
+      desc = "Path to the item, slashes must be encoded"
+    }
+    out = append(out, "{" + name + "}")
+    params = append(params, &OpenApiParameter{
+      Name: name, In: "path", Required: true, Description: desc, Schema: Schema{"type": "string"}})
+  }
+
+  path := "/" + strings.Join(out, "/")
+  if strings.HasSuffix(route.Path, "/") {
+    path += "/"
+  }
+  return path, params
+}
+
+// Generates schemas for Go types, named struct types are
+// added to the components and referenced.
+type schemaGenerator struct {
+  schemas map[string]Schema
+  types map[string]reflect.Type
+}
+
+// Get the request body for an argument type.
+//
+// When a field is bound to the body it's type is used, otherwise PUT and
+// POST requests decode unbound fields from a JSON body. Returns nil when
+// there is no body.
+func (g *schemaGenerator) body(t reflect.Type, method string) *OpenApiBody {
+  for t.Kind() == reflect.Ptr {
+    t = t.Elem()
+  }
+  if t.Kind() != reflect.Struct {
+    return nil
+  }
+
+  var schema Schema
+  var binary bool
+  for i := 0; i < t.NumField(); i++ {
+    if source, _ := BindTag(t.Field(i)); source == BindBody {
+      if t.Field(i).Type == bytesType {
+        binary = true
+      } else {
+        schema = g.schema(t.Field(i).Type)
+      }
+    }
+  }
+
+  if binary {
+    return &OpenApiBody{
+      Required: true,
+      Content: map[string]*OpenApiMedia{
+        "application/octet-stream": &OpenApiMedia{Schema: Schema{"type": "string", "format": "binary"}}}}
+  }
+
+  if schema == nil && (method == http.MethodPut || method == http.MethodPost) {
+    if props := g.properties(t, true); len(props) > 0 {
+      schema = Schema{"type": "object", "properties": props}
+    }
+  }
+
+  if schema == nil {
+    return nil
+  }
+  return &OpenApiBody{
+    Required: true,
+    Content: map[string]*OpenApiMedia{"application/json": &OpenApiMedia{Schema: schema}}}
+}
+
+// Get query and header parameters for the bound fields of an argument type.
+func (g *schemaGenerator) parameters(t reflect.Type) []*OpenApiParameter {
+  for t.Kind() == reflect.Ptr {
+    t = t.Elem()
+  }
+  var params []*OpenApiParameter
+  if t.Kind() != reflect.Struct {
+    return params
+  }
+  for i := 0; i < t.NumField(); i++ {
+    source, name := BindTag(t.Field(i))
+    if source == BindQuery || source == BindHeader {
+      params = append(params, &OpenApiParameter{
+        Name: name, In: source, Required: source == BindHeader, Schema: g.schema(t.Field(i).Type)})
+    }
+  }
+  return params
+}
+
+// Get the schema for a type.
+func (g *schemaGenerator) schema(t reflect.Type) Schema {
+  for t.Kind() == reflect.Ptr {
+    t = t.Elem()
+  }
+
+  if t == timeType {
+    return Schema{"type": "string", "format": "date-time"}
+  }
+  if t == bytesType {
+    return Schema{"type": "string", "format": "byte"}
+  }
+  if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+    return Schema{}
+  }
+
+  switch t.Kind() {
+    case reflect.String:
+      return Schema{"type": "string"}
+    case reflect.Bool:
+      return Schema{"type": "boolean"}
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+      reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+      return Schema{"type": "integer"}
+    case reflect.Float32, reflect.Float64:
+      return Schema{"type": "number"}
+    case reflect.Slice, reflect.Array:
+      return Schema{"type": "array", "items": g.schema(t.Elem())}
+    case reflect.Map:
+      return Schema{"type": "object", "additionalProperties": g.schema(t.Elem())}
+    case reflect.Struct:
+      if t.Name() == "" {
+        return g.object(t)
+      }
+      name := g.name(t)
+      if _, ok := g.schemas[name]; !ok {
+        // Register before generating so recursive types terminate
+        g.schemas[name] = Schema{}
+        g.schemas[name] = g.object(t)
+      }
+      return Schema{"$ref": "#/components/schemas/" + name}
+  }
+  // Interfaces and other types accept any value
+  return Schema{}
+}
+
+// Get an object schema for a struct type.
+func (g *schemaGenerator) object(t reflect.Type) Schema {
+  schema := Schema{"type": "object"}
+  if props := g.properties(t, false); len(props) > 0 {
+    schema["properties"] = props
+  }
+  return schema
+}
+
+// Get the properties for a struct following the encoding/json rules
+// for field names, embedded structs are flattened. Fields with a bind
+// tag are skipped when unbound is set.
+func (g *schemaGenerator) properties(t reflect.Type, unbound bool) map[string]Schema {
+  props := make(map[string]Schema)
+  for i := 0; i < t.NumField(); i++ {
+    field := t.Field(i)
+    tag := field.Tag.Get("json")
+    if tag == "-" {
+      continue
+    }
+    name := strings.Split(tag, ",")[0]
+
+    if field.Anonymous && name == "" {
+      ft := field.Type
+      if ft.Kind() == reflect.Ptr {
+        ft = ft.Elem()
+      }
+      if ft.Kind() == reflect.Struct {
+        for k, v := range g.properties(ft, unbound) {
+          props[k] = v
+        }
+        continue
+      }
+    }
+
+    if field.PkgPath != "" {
+      continue
+    }
+    if source, _ := BindTag(field); unbound && source != "" {
+      continue
+    }
+    if name == "" {
+      name = field.Name
+    }
+    props[name] = g.schema(field.Type)
+  }
+  return props
+}
+
+// Get a unique component name for a named type.
+func (g *schemaGenerator) name(t reflect.Type) string {
+  name := t.Name()
+  if existing, ok := g.types[name]; ok && existing != t {
+    pkg := t.PkgPath()
+    name = pkg[strings.LastIndex(pkg, "/") + 1:] + "." + name
+  }
+  g.types[name] = t
+  return name
+}
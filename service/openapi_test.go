@@ -0,0 +1,66 @@
+package service
+
+import (
+  "regexp"
+  "testing"
+  . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/rpc"
+)
+
+var pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+var unnamedParamPattern = regexp.MustCompile(`^param[0-9]+$`)
+
+func TestOpenApiPathParameters(t *testing.T) {
+  services := &ServiceMap{}
+  services.MustRegister(new(CoreService), "Core")
+  services.MustRegister(new(HostService), "Host")
+  services.MustRegister(new(ContainerService), "Container")
+  services.MustRegister(new(AppService), "Application")
+  services.MustRegister(new(ArchiveService), "Archive")
+  services.MustRegister(new(FileService), "File")
+  services.MustRegister(new(JobService), "Job")
+  services.MustRegister(new(TemplateService), "Template")
+  services.MustRegister(new(AuditService), "Audit")
+  services.MustRegister(new(ProxyService), "Proxy")
+  services.MustRegister(new(TrashService), "Trash")
+  services.MustRegister(new(RpcServices), "Service")
+
+  doc := NewOpenApi(services.Map(), DefaultRouter)
+
+  // Every route must be documented
+  for _, route := range DefaultRouter.Routes() {
+    path, _ := openApiPath(route)
+    if doc.Paths[path] == nil {
+      t.Errorf("Route %s %s (%s) is missing from the document", route.Method, route.Path, route.ServiceMethod)
+    }
+  }
+
+  for path, operations := range doc.Paths {
+    for verb, op := range operations {
+      params := make(map[string]int)
+      for _, param := range op.Parameters {
+        if param.In == "path" {
+          params[param.Name]++
+        }
+      }
+
+      names := make(map[string]bool)
+      for _, match := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+        name := match[1]
+        names[name] = true
+        if unnamedParamPattern.MatchString(name) {
+          t.Errorf("%s %s has an unnamed parameter {%s}", verb, path, name)
+        }
+        if params[name] != 1 {
+          t.Errorf("%s %s expected one path parameter named %s, got %d", verb, path, name, params[name])
+        }
+      }
+
+      for name := range params {
+        if !names[name] {
+          t.Errorf("%s %s has a path parameter %s that is not in the path", verb, path, name)
+        }
+      }
+    }
+  }
+}
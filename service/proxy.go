@@ -0,0 +1,84 @@
+package service
+
+import(
+  "net/http"
+  . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+type ProxyRequest struct {
+  Caller
+
+  // Mountpoint URL for the proxy
+  Url string `json:"url"`
+
+  // Upstream address, eg: http://127.0.0.1:8081
+  Proxy string `json:"proxy"`
+
+  // Request headers set when proxying
+  Headers map[string]string `json:"proxy-headers,omitempty"`
+}
+
+// Target reference for audit records.
+func (req *ProxyRequest) Target() string {
+  return req.Url
+}
+
+type ProxyReferenceRequest struct {
+  Caller
+
+  // Mountpoint URL for the proxy
+  Url string `json:"url" bind:"query:url"`
+}
+
+// Target reference for audit records.
+func (req *ProxyReferenceRequest) Target() string {
+  return req.Url
+}
+
+type ProxyService struct {
+  // Reference to the mountpoint manager
+  Mountpoints *MountpointManager
+
+  // Access policy
+  Policy *Policy
+}
+
+// List proxy mountpoints.
+func (s *ProxyService) List(req *CallerArgs, reply *ServiceReply) *StatusError {
+  if err := s.Policy.Authorize(req.User, PermissionAdmin, "", ""); err != nil {
+    return err
+  }
+  reply.Reply = s.Mountpoints.ProxyList()
+  return nil
+}
+
+// Create a proxy mountpoint.
+func (s *ProxyService) Create(req *ProxyRequest, reply *ServiceReply) *StatusError {
+  if err := s.Policy.Authorize(req.User, PermissionAdmin, "", ""); err != nil {
+    return err
+  }
+  mt := Mountpoint{Url: req.Url, Proxy: req.Proxy, ProxyHeaders: req.Headers}
+  if err := s.Mountpoints.CreateProxy(mt); err != nil {
+    return CommandError(http.StatusPreconditionFailed, err.Error())
+  }
+  reply.Reply = &mt
+  reply.Status = http.StatusCreated
+  return nil
+}
+
+// Delete a proxy mountpoint.
+func (s *ProxyService) Delete(req *ProxyReferenceRequest, reply *ServiceReply) *StatusError {
+  if err := s.Policy.Authorize(req.User, PermissionAdmin, "", ""); err != nil {
+    return err
+  }
+  if req.Url == "" {
+    return CommandError(http.StatusBadRequest, "No URL for proxy delete operation")
+  }
+  if mt, err := s.Mountpoints.DeleteProxy(req.Url); err != nil {
+    return CommandError(http.StatusNotFound, err.Error())
+  } else {
+    reply.Reply = mt
+  }
+  return nil
+}
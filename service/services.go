@@ -2,9 +2,11 @@ package service
 
 import(
   //"fmt"
+  "reflect"
   "strings"
   "net/http"
   . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/model"
   . "github.com/tmpfs/pageloop/rpc"
   . "github.com/tmpfs/pageloop/util"
 )
@@ -15,15 +17,19 @@ var(
 
 type ServiceMeta struct {
   Description string `json:"description"`
+  // Reply type for methods that reply with ServiceReply
+  Reply reflect.Type `json:"-"`
+  // JSON schema the method arguments must match
+  Schema []byte `json:"-"`
 }
 
 type ServiceRequest struct {
-  Service string `json:"service"`
+  Service string `json:"service" bind:"path:context"`
 }
 
 type ServiceMethodRequest struct {
-  Service string `json:"service"`
-  Method string `json:"method"`
+  Service string `json:"service" bind:"path:context"`
+  Method string `json:"method" bind:"path:target"`
 }
 
 type RpcServices struct {
@@ -74,11 +80,17 @@ func (s *RpcServices) ReadMethodCalls(req *ServiceMethodRequest, reply *ServiceR
   if method, err := LookupServiceMethod(m, req.Service, req.Method); err != nil {
     return err
   } else {
-    reply.Reply = method.Calls
+    reply.Reply = method.NumCalls()
   }
   return nil
 }
 
+// Get an OpenAPI document for the REST API (/openapi.json).
+func (s *RpcServices) OpenApi(argv *VoidArgs, reply *ServiceReply) *StatusError {
+  reply.Reply = NewOpenApi(s.Services.Map(), s.Router)
+  return nil
+}
+
 // Inject service meta and route information.
 func InjectServiceMeta(srv *ServiceInfo, router *Router) {
   for _, method := range srv.Methods {
@@ -128,7 +140,9 @@ func init () {
 
   describe("Core.Meta", `Get server meta information.`)
   describe("Core.Stats", `Get server statistics.`)
+  describe("Core.ReloadConfig", `Reload the configuration file and apply mountpoint changes.`)
   describe("Service.List", `List available services.`)
+  describe("Service.OpenApi", `Get an OpenAPI document for the REST API.`)
   describe("Service.Read", `Get service information.`)
   describe("Service.ReadMethod", `Get service method information.`)
   describe("Service.ReadMethodCalls", `Get the number of calls for a service method.`)
@@ -137,22 +151,90 @@ func init () {
   describe("Job.Read", `Get an active job.`)
   describe("Job.Delete", `Delete an active job.`)
   describe("Host.List", `List application containers.`)
+  describe("Host.Search", `Search the files of all applications.`)
   describe("Container.Read", `Get container information.`)
   describe("Container.CreateApp", `Create a new application.`)
   describe("Application.Read", `Get an application.`)
-  describe("Application.Delete", `Delete an application.`)
+  describe("Application.Delete", `Delete an application, it is moved to the trash when enabled.`)
+  describe("Application.SetHost", `Assign the virtual host for an application.`)
   describe("Application.ReadFiles", `Get the files list for an application.`)
   describe("Application.ReadPages", `Get the pages list for an application.`)
+  describe("Application.Search", `Search the files of an application.`)
+  describe("Application.Replace", `Find and replace text in the files of an application.`)
   describe("Application.DeleteFiles", `Delete files from an application.`)
   describe("Application.RunTask", `Run an application build task.`)
   describe("File.Read", `Get file information.`)
   describe("File.ReadPage", `Get page information.`)
+  describe("File.ReadChildren", `List the files in a directory.`)
   describe("File.Create", `Create a new file.`)
   describe("File.Save", `Save file content.`)
-  describe("File.Delete", `Delete a file.`)
+  describe("File.Delete", `Delete a file or directory, it is moved to the trash when enabled.`)
   describe("File.ReadSource", `Get the contents of a file.`)
   describe("File.ReadSourceRaw", `Get the raw contents of a file.`)
-  describe("File.Move", `Move a file.`)
+  describe("File.Preview", `Get a rendered page, including drafts and scheduled pages.`)
+  describe("File.Move", `Move a file or directory.`)
+  describe("File.Copy", `Copy a file or directory.`)
   describe("File.CreateTemplate", `Create a file from a template.`)
   describe("Archive.Export", `Export a zip archive.`)
+  describe("Audit.List", `List audit records for mutating service calls.`)
+  describe("Proxy.List", `List proxy mountpoints.`)
+  describe("Proxy.Create", `Create a proxy mountpoint.`)
+  describe("Proxy.Delete", `Delete a proxy mountpoint.`)
+  describe("Trash.List", `List deleted files and applications.`)
+  describe("Trash.Restore", `Restore a deleted file or application.`)
+  describe("Trash.Purge", `Permanently delete items in the trash.`)
+
+  // Reply types for methods that reply with ServiceReply
+  reply := func (name string, value interface{}) {
+    ServicesMetaInfo[name].Reply = reflect.TypeOf(value)
+  }
+
+  reply("Core.ReloadConfig", &MountpointChanges{})
+  reply("Service.List", map[string]*ServiceInfo{})
+  reply("Service.OpenApi", &OpenApi{})
+  reply("Service.Read", &ServiceInfo{})
+  reply("Service.ReadMethod", &ServiceMethodInfo{})
+  reply("Service.ReadMethodCalls", uint(0))
+  reply("Template.List", []*Application{})
+  reply("Job.List", []*Job{})
+  reply("Job.Read", &Job{})
+  reply("Job.Delete", &Job{})
+  reply("Host.List", []*Container{})
+  reply("Host.Search", []*SearchResult{})
+  reply("Container.Read", &Container{})
+  reply("Container.CreateApp", &Application{})
+  reply("Application.Read", &Application{})
+  reply("Application.SetHost", &Application{})
+  reply("Application.ReadFiles", []*File{})
+  reply("Application.ReadPages", []*Page{})
+  reply("Application.Search", []*SearchResult{})
+  reply("Application.Replace", []*ReplaceResult{})
+  reply("Application.DeleteFiles", []*File{})
+  reply("Application.RunTask", &Job{})
+  reply("File.Read", &File{})
+  reply("File.ReadPage", &Page{})
+  reply("File.ReadChildren", []*File{})
+  reply("File.Create", &File{})
+  reply("File.Save", &File{})
+  reply("File.Delete", &File{})
+  reply("File.Move", &File{})
+  reply("File.Copy", &File{})
+  reply("File.CreateTemplate", &File{})
+  reply("Audit.List", &AuditPage{})
+  reply("Proxy.List", []Mountpoint{})
+  reply("Proxy.Create", &Mountpoint{})
+  reply("Proxy.Delete", &Mountpoint{})
+  reply("Trash.List", []*TrashItem{})
+  reply("Trash.Restore", &TrashItem{})
+  reply("Trash.Purge", []*TrashItem{})
+
+  // Argument schemas, validated for all transports
+  schema := func (name string, asset string) {
+    ServicesMetaInfo[name].Schema = MustAsset(asset)
+  }
+
+  schema("Container.CreateApp", "schema/app-new.json")
+  schema("Application.SetHost", "schema/app-host.json")
+  schema("Application.Replace", "schema/app-replace.json")
+  schema("Proxy.Create", "schema/proxy-new.json")
 }
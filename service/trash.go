@@ -0,0 +1,140 @@
+package service
+
+import(
+  "net/http"
+  . "github.com/tmpfs/pageloop/core"
+  . "github.com/tmpfs/pageloop/model"
+  . "github.com/tmpfs/pageloop/util"
+)
+
+type TrashRequest struct {
+  Caller
+
+  // Identifier for a trash item, when purging an empty
+  // identifier purges all items
+  Id string `json:"id,omitempty" bind:"path:context"`
+}
+
+// Target trash item identifier for audit records.
+func (req *TrashRequest) Target() string {
+  return req.Id
+}
+
+type TrashService struct {
+  Host *Host
+
+  // Reference to the mountpoint manager
+  Mountpoints *MountpointManager
+
+  // Access policy
+  Policy *Policy
+
+  // Deleted files and applications
+  Trash *Trash
+}
+
+// List items in the trash that the caller can read, most recent first.
+func (s *TrashService) List(req *CallerArgs, reply *ServiceReply) *StatusError {
+  if !s.Trash.Enabled() {
+    return CommandError(http.StatusNotFound, "Trash is not enabled")
+  }
+  items := make([]*TrashItem, 0)
+  for _, item := range s.Trash.List() {
+    if s.Policy.Allow(req.User, PermissionRead, item.Container, item.Application) {
+      items = append(items, item)
+    }
+  }
+  reply.Reply = items
+  return nil
+}
+
+// Restore a file, directory or application to the original location.
+func (s *TrashService) Restore(req *TrashRequest, reply *ServiceReply) *StatusError {
+  item, err := s.lookup(req)
+  if err != nil {
+    return err
+  }
+  container := s.Host.GetByName(item.Container)
+  if container == nil {
+    return CommandError(http.StatusNotFound, "Container %s not found", item.Container)
+  }
+
+  if item.IsApplication() {
+    if container.GetByName(item.Application) != nil || s.Mountpoints.HasMountpoint(item.Mountpoint.Url) {
+      return CommandError(http.StatusConflict, "Application %s already exists", item.Application)
+    }
+    if e := s.Trash.Restore(item, func(src string) error {
+      if err := MoveFile(src, item.Path); err != nil {
+        return err
+      }
+      if err := s.Mountpoints.RestoreMountpoint(*item.Mountpoint); err != nil {
+        MoveFile(item.Path, src)
+        return err
+      }
+      return nil
+    }); e != nil {
+      return CommandError(http.StatusInternalServerError, e.Error())
+    }
+  } else {
+    app := container.GetByName(item.Application)
+    if app == nil {
+      return CommandError(http.StatusNotFound, "Application %s not found, restore the application first", item.Application)
+    }
+    if app.Urls[item.Url] != nil {
+      return CommandError(http.StatusConflict, "File %s already exists", item.Url)
+    }
+    if e := s.Trash.Restore(item, func(src string) error {
+      _, err := app.Restore(src, item.Url)
+      return err
+    }); e != nil {
+      return CommandError(http.StatusInternalServerError, e.Error())
+    }
+  }
+  reply.Reply = item
+  return nil
+}
+
+// Permanently delete an item, without an identifier all the items are deleted.
+func (s *TrashService) Purge(req *TrashRequest, reply *ServiceReply) *StatusError {
+  if req.Id == "" {
+    if err := s.Policy.Authorize(req.User, PermissionAdmin, "", ""); err != nil {
+      return err
+    }
+  } else if _, err := s.lookup(req); err != nil {
+    return err
+  }
+  if purged, err := s.Trash.Purge(req.Id); err != nil {
+    return CommandError(http.StatusInternalServerError, err.Error())
+  } else {
+    if purged == nil {
+      purged = make([]*TrashItem, 0)
+    }
+    reply.Reply = purged
+  }
+  return nil
+}
+
+// Find an item and authorize the caller to change it, files
+// require write permission and applications require admin.
+func (s *TrashService) lookup(req *TrashRequest) (*TrashItem, *StatusError) {
+  if !s.Trash.Enabled() {
+    return nil, CommandError(http.StatusNotFound, "Trash is not enabled")
+  }
+  if req.Id == "" {
+    return nil, CommandError(http.StatusBadRequest, "No trash item identifier")
+  }
+  item := s.Trash.Find(req.Id)
+  if item == nil {
+    return nil, CommandError(http.StatusNotFound, "Trash item %s not found", req.Id)
+  }
+  perm := PermissionWrite
+  app := item.Application
+  if item.IsApplication() {
+    perm = PermissionAdmin
+    app = ""
+  }
+  if err := s.Policy.Authorize(req.User, perm, item.Container, app); err != nil {
+    return nil, err
+  }
+  return item, nil
+}
@@ -1,5 +1,9 @@
 package service
 
+import(
+  "time"
+)
+
 // A helper type for service methods to declare as the
 // reply (second) argument. When this type is used the
 // Result assigned to the ServiceReply is used as the
@@ -11,4 +15,55 @@ package service
 type ServiceReply struct {
   Status int
   Reply interface{}
+  // When the reply document was last modified, sent as the
+  // Last-Modified header for REST requests
+  Modified time.Time
+}
+
+// Embedded in service method arguments to identify the user
+// making the call. The user is assigned by the transport after
+// authenticating the request and cannot be set by the client.
+type Caller struct {
+  User string `json:"-"`
+  // Request identifier assigned by the transport.
+  Request string `json:"-"`
+}
+
+// Assign the calling user.
+func (c *Caller) SetUser(user string) {
+  c.User = user
+}
+
+// Get the calling user.
+func (c *Caller) UserName() string {
+  return c.User
+}
+
+// Assign the request identifier.
+func (c *Caller) SetRequestId(id string) {
+  c.Request = id
+}
+
+// Get the request identifier.
+func (c *Caller) RequestId() string {
+  return c.Request
+}
+
+// Implemented by service method arguments that embed Caller.
+type UserArgs interface {
+  SetUser(user string)
+  UserName() string
+}
+
+// Implemented by service method arguments that embed Caller, used
+// to carry the request identifier into log records.
+type TracedArgs interface {
+  SetRequestId(id string)
+  RequestId() string
+}
+
+// Implemented by service method arguments that target an
+// asset, used to identify the target in audit records.
+type TargetArgs interface {
+  Target() string
 }
@@ -0,0 +1,103 @@
+package util
+
+import(
+  "os"
+  "mime"
+  "bytes"
+  "strconv"
+  "strings"
+  "net/http"
+  "io/ioutil"
+  "compress/gzip"
+)
+
+const(
+  // Content smaller than this is not compressed.
+  CompressMinSize = 1024
+
+  // Extension for precompressed gzip files.
+  GzipExt = ".gz"
+
+  // Extension for precompressed brotli files.
+  BrotliExt = ".br"
+)
+
+var(
+  // Media types that are compressed in addition to text types.
+  compressibleTypes = []string{
+    "application/json",
+    "application/javascript",
+    "application/x-javascript",
+    "application/xml",
+    "application/manifest+json",
+    "image/svg+xml",
+  }
+)
+
+// Determine if content of a media type benefits from compression,
+// parameters such as the charset are ignored.
+func Compressible(contentType string) bool {
+  mediaType, _, err := mime.ParseMediaType(contentType)
+  if err != nil {
+    return false
+  }
+  if strings.HasPrefix(mediaType, "text/") {
+    return true
+  }
+  for _, t := range compressibleTypes {
+    if mediaType == t {
+      return true
+    }
+  }
+  return false
+}
+
+// Determine if a request accepts a content encoding, an encoding
+// is not accepted when it has a quality value of zero. An entry for
+// the encoding takes precedence over the * wildcard.
+func AcceptsEncoding(req *http.Request, encoding string) bool {
+  var wildcard, explicit *bool
+  for _, value := range req.Header["Accept-Encoding"] {
+    for _, part := range strings.Split(value, ",") {
+      fields := strings.Split(part, ";")
+      name := strings.TrimSpace(fields[0])
+      if name != encoding && name != "*" {
+        continue
+      }
+      accepted := true
+      for _, param := range fields[1:] {
+        param = strings.TrimSpace(param)
+        if strings.HasPrefix(param, "q=") {
+          if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+            accepted = false
+          }
+        }
+      }
+      if name == encoding {
+        explicit = &accepted
+      } else {
+        wildcard = &accepted
+      }
+    }
+  }
+  if explicit != nil {
+    return *explicit
+  }
+  return wildcard != nil && *wildcard
+}
+
+// Write a gzip compressed copy of content to a file.
+func WriteGzip(path string, content []byte, mode os.FileMode) error {
+  var b bytes.Buffer
+  gz, err := gzip.NewWriterLevel(&b, gzip.BestCompression)
+  if err != nil {
+    return err
+  }
+  if _, err = gz.Write(content); err != nil {
+    return err
+  }
+  if err = gz.Close(); err != nil {
+    return err
+  }
+  return ioutil.WriteFile(path, b.Bytes(), mode)
+}
@@ -0,0 +1,186 @@
+package util
+
+import(
+  "fmt"
+  "bytes"
+)
+
+const(
+  // Number of unchanged lines around each hunk of a diff.
+  DiffContext = 3
+
+  // Edit distance after which a diff replaces the entire content.
+  diffMaxEdits = 1000
+)
+
+type diffLine struct {
+  // One of ' ', '-' or '+'
+  op byte
+  text string
+}
+
+// Compare two versions of some text and return a unified diff
+// of the changed lines, an empty string when the text is equal.
+func UnifiedDiff(name string, a, b []byte) string {
+  if bytes.Equal(a, b) {
+    return ""
+  }
+  lines := diffLines(splitLines(a), splitLines(b))
+
+  var buf bytes.Buffer
+  fmt.Fprintf(&buf, "--- %s\n+++ %s\n", name, name)
+  for start := 0; start < len(lines); {
+    // Find the next change
+    for start < len(lines) && lines[start].op == ' ' {
+      start++
+    }
+    if start == len(lines) {
+      break
+    }
+    // Extend the hunk while changes are separated by less
+    // than twice the context
+    end := start
+    for i := start; i < len(lines) && i - end <= 2 * DiffContext; i++ {
+      if lines[i].op != ' ' {
+        end = i + 1
+      }
+    }
+    from := start - DiffContext
+    if from < 0 {
+      from = 0
+    }
+    to := end + DiffContext
+    if to > len(lines) {
+      to = len(lines)
+    }
+
+    // Line numbers in both versions at the start of the hunk
+    oldLine, newLine := 1, 1
+    for _, l := range lines[:from] {
+      if l.op != '+' {
+        oldLine++
+      }
+      if l.op != '-' {
+        newLine++
+      }
+    }
+    var oldCount, newCount int
+    for _, l := range lines[from:to] {
+      if l.op != '+' {
+        oldCount++
+      }
+      if l.op != '-' {
+        newCount++
+      }
+    }
+    fmt.Fprintf(&buf, "@@ -%s +%s @@\n", diffRange(oldLine, oldCount), diffRange(newLine, newCount))
+    for _, l := range lines[from:to] {
+      buf.WriteByte(l.op)
+      buf.WriteString(l.text)
+      buf.WriteByte('\n')
+    }
+    start = to
+  }
+  return buf.String()
+}
+
+// Format the line range of a hunk, an empty range refers
+// to the line before it.
+func diffRange(line, count int) string {
+  if count == 0 {
+    line--
+  }
+  if count == 1 {
+    return fmt.Sprintf("%d", line)
+  }
+  return fmt.Sprintf("%d,%d", line, count)
+}
+
+func splitLines(b []byte) []string {
+  if len(b) == 0 {
+    return nil
+  }
+  lines := bytes.Split(bytes.TrimSuffix(b, []byte("\n")), []byte("\n"))
+  out := make([]string, len(lines))
+  for i, l := range lines {
+    out[i] = string(l)
+  }
+  return out
+}
+
+// Shortest edit script between two lists of lines using the
+// Myers algorithm, when the lists differ too much all the lines
+// are deleted and inserted.
+func diffLines(a, b []string) []diffLine {
+  n, m := len(a), len(b)
+  max := n + m
+  if max > diffMaxEdits {
+    max = diffMaxEdits
+  }
+  offset := max + 1
+  v := make([]int, 2 * max + 3)
+  var trace [][]int
+  for d := 0; d <= max; d++ {
+    trace = append(trace, append([]int(nil), v...))
+    for k := -d; k <= d; k += 2 {
+      var x int
+      if k == -d || (k != d && v[offset + k - 1] < v[offset + k + 1]) {
+        x = v[offset + k + 1]
+      } else {
+        x = v[offset + k - 1] + 1
+      }
+      y := x - k
+      for x < n && y < m && a[x] == b[y] {
+        x++
+        y++
+      }
+      v[offset + k] = x
+      if x >= n && y >= m {
+        return diffBacktrack(trace, a, b, offset)
+      }
+    }
+  }
+
+  lines := make([]diffLine, 0, n + m)
+  for _, l := range a {
+    lines = append(lines, diffLine{'-', l})
+  }
+  for _, l := range b {
+    lines = append(lines, diffLine{'+', l})
+  }
+  return lines
+}
+
+func diffBacktrack(trace [][]int, a, b []string, offset int) []diffLine {
+  var lines []diffLine
+  x, y := len(a), len(b)
+  for d := len(trace) - 1; d >= 0; d-- {
+    v := trace[d]
+    k := x - y
+    var prev int
+    if k == -d || (k != d && v[offset + k - 1] < v[offset + k + 1]) {
+      prev = k + 1
+    } else {
+      prev = k - 1
+    }
+    px := v[offset + prev]
+    py := px - prev
+    for x > px && y > py {
+      lines = append(lines, diffLine{' ', a[x - 1]})
+      x--
+      y--
+    }
+    if d > 0 {
+      if x == px {
+        lines = append(lines, diffLine{'+', b[y - 1]})
+      } else {
+        lines = append(lines, diffLine{'-', a[x - 1]})
+      }
+      x, y = px, py
+    }
+  }
+  for i, j := 0, len(lines) - 1; i < j; i, j = i + 1, j - 1 {
+    lines[i], lines[j] = lines[j], lines[i]
+  }
+  return lines
+}
@@ -0,0 +1,24 @@
+package util
+
+import (
+  "testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+  a := []byte("one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n")
+  b := []byte("one\n2\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\n")
+
+  expected := "--- /a.txt\n+++ /a.txt\n" +
+    "@@ -1,5 +1,5 @@\n one\n-two\n+2\n three\n four\n five\n" +
+    "@@ -8,3 +8,4 @@\n eight\n nine\n ten\n+eleven\n"
+  if out := UnifiedDiff("/a.txt", a, b); out != expected {
+    t.Errorf("Unexpected diff %q", out)
+  }
+
+  if out := UnifiedDiff("/a.txt", a, a); out != "" {
+    t.Errorf("Expected empty diff for equal content, got %q", out)
+  }
+  if out := UnifiedDiff("/a.txt", nil, []byte("new\n")); out != "--- /a.txt\n+++ /a.txt\n@@ -0,0 +1 @@\n+new\n" {
+    t.Errorf("Unexpected diff for new content %q", out)
+  }
+}
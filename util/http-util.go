@@ -2,7 +2,11 @@ package util
 
 import (
 	"errors"
+  "time"
+  "strings"
   "strconv"
+  "crypto/sha256"
+  "encoding/hex"
 	"io/ioutil"
 	"net/http"
 	"encoding/json"
@@ -68,6 +72,49 @@ func (h HttpUtil) Write(res http.ResponseWriter, status int, data []byte) (int,
 	return res.Write(data)
 }
 
+// Get a strong entity tag for content.
+func (h HttpUtil) ETag(content []byte) string {
+  sum := sha256.Sum256(content)
+  return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// Set the validator headers for a response and determine if the
+// client already has the content.
+//
+// The ETag header is computed from the content and Last-Modified is set
+// when the modification time is not zero. When If-None-Match lists the
+// entity tag or If-Modified-Since is not before the modification time a
+// 304 (Not Modified) response is sent and the caller should not write the
+// content. If-Modified-Since is ignored when If-None-Match is present.
+func (h HttpUtil) NotModified(res http.ResponseWriter, req *http.Request, content []byte, modified time.Time) bool {
+  etag := h.ETag(content)
+  res.Header().Set("ETag", etag)
+  if !modified.IsZero() {
+    res.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+  }
+
+  if req.Method != http.MethodGet && req.Method != http.MethodHead {
+    return false
+  }
+
+  var match bool
+  if inm := req.Header.Get("If-None-Match"); inm != "" {
+    match = matchETag(inm, etag)
+  } else if ims := req.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+    if since, err := http.ParseTime(ims); err == nil {
+      // Header dates have a resolution of one second
+      match = !modified.Truncate(time.Second).After(since)
+    }
+  }
+
+  if match {
+    res.Header().Del("Content-Type")
+    res.Header().Del("Content-Length")
+    res.WriteHeader(http.StatusNotModified)
+  }
+  return match
+}
+
 // Determine if a method exists in a list of allowed methods.
 func (h HttpUtil) IsMethodAllowed(method string, methods []string) bool {
 	for _, m := range methods {
@@ -117,3 +164,15 @@ func (h HttpUtil) Validate(schema []byte, input []byte) (*gojsonschema.Result, e
 	documentLoader := gojsonschema.NewBytesLoader(input)
 	return gojsonschema.Validate(schemaLoader, documentLoader)
 }
+
+// Determine if an If-None-Match header matches an entity tag
+// using the weak comparison.
+func matchETag(header string, etag string) bool {
+  for _, tag := range strings.Split(header, ",") {
+    tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+    if tag == "*" || tag == etag {
+      return true
+    }
+  }
+  return false
+}
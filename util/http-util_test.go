@@ -0,0 +1,48 @@
+package util
+
+import (
+  "time"
+  "testing"
+  "net/http"
+  "net/http/httptest"
+)
+
+func TestNotModified(t *testing.T) {
+  var h HttpUtil
+  content := []byte("# Title")
+  etag := h.ETag(content)
+  modified := time.Date(2026, 1, 2, 3, 4, 5, 600, time.UTC)
+
+  var tests = []struct {
+    header string
+    value string
+    expected bool
+  }{
+    {"", "", false},
+    {"If-None-Match", etag, true},
+    {"If-None-Match", `"other", W/` + etag, true},
+    {"If-None-Match", "*", true},
+    {"If-None-Match", `"other"`, false},
+    {"If-Modified-Since", modified.Format(http.TimeFormat), true},
+    {"If-Modified-Since", modified.Add(-time.Second).Format(http.TimeFormat), false},
+  }
+
+  for _, test := range tests {
+    req := httptest.NewRequest(http.MethodGet, "/api/apps/user/blog/src/index.md", nil)
+    if test.header != "" {
+      req.Header.Set(test.header, test.value)
+    }
+    res := httptest.NewRecorder()
+    if result := h.NotModified(res, req, content, modified); result != test.expected {
+      t.Errorf("Expected %t for %s: %s", test.expected, test.header, test.value)
+    } else if result && res.Code != http.StatusNotModified {
+      t.Errorf("Expected status %d, got %d", http.StatusNotModified, res.Code)
+    }
+    if res.Header().Get("ETag") != etag {
+      t.Errorf("Expected ETag %s, got %s", etag, res.Header().Get("ETag"))
+    }
+    if res.Header().Get("Last-Modified") != modified.Format(http.TimeFormat) {
+      t.Errorf("Unexpected Last-Modified %s", res.Header().Get("Last-Modified"))
+    }
+  }
+}
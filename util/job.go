@@ -2,7 +2,10 @@ package util
 
 import(
   "fmt"
+  "sync"
   "time"
+  "context"
+  "encoding/json"
 )
 
 var(
@@ -46,6 +49,17 @@ type Job struct {
   duration time.Duration
 }
 
+// Decode a job, the runner is only available on the
+// server so it is not decoded.
+func (j *Job) UnmarshalJSON(data []byte) error {
+  type job Job
+  doc := struct {
+    *job
+    Runner json.RawMessage `json:"run"`
+  }{job: (*job)(j)}
+  return json.Unmarshal(data, &doc)
+}
+
 func (j *Job) UpdateDuration() {
   j.duration = time.Since(j.start)
   j.Runtime = j.duration.String()
@@ -67,6 +81,8 @@ func (j *Job) CanAbort() bool {
 type JobManager struct {
   // List of active jobs
   Active []*Job
+  // Protects the list of active jobs
+  mu sync.Mutex
 }
 
 // Create a new job.
@@ -79,6 +95,8 @@ func (j *JobManager) NewJob(id string, runner JobRunner) *Job {
 
 // Find a job by id that is currently active.
 func (j *JobManager) ActiveJob(id string) *Job {
+  j.mu.Lock()
+  defer j.mu.Unlock()
   for _, job := range j.Active {
     if job.Id == id && job.Running() {
       job.UpdateDuration()
@@ -93,7 +111,9 @@ func (j *JobManager) Start(job *Job) {
   job.running = true
   job.start = time.Now()
   job.Timestamp = job.start.Unix()
+  j.mu.Lock()
   j.Active = append(j.Active, job)
+  j.mu.Unlock()
 }
 
 // Stop a job. The job is removed from the list
@@ -101,6 +121,8 @@ func (j *JobManager) Start(job *Job) {
 func (j *JobManager) Stop(job *Job) {
   job.running = false
   job.UpdateDuration()
+  j.mu.Lock()
+  defer j.mu.Unlock()
   for i, cj := range j.Active {
     if job == cj {
       before := j.Active[0:i]
@@ -131,6 +153,52 @@ func (j *JobManager) Abort(job *Job) error {
   return nil
 }
 
+// Get a copy of the list of active jobs.
+func (j *JobManager) List() []*Job {
+  j.mu.Lock()
+  defer j.mu.Unlock()
+  list := make([]*Job, len(j.Active))
+  copy(list, j.Active)
+  return list
+}
+
+// Wait for all active jobs to stop or the context to be done.
+//
+// Returns the jobs that are still active.
+func (j *JobManager) Wait(ctx context.Context) []*Job {
+  ticker := time.NewTicker(100 * time.Millisecond)
+  defer ticker.Stop()
+  for {
+    list := j.List()
+    if len(list) == 0 {
+      return list
+    }
+    select {
+      case <-ticker.C:
+      case <-ctx.Done():
+        return list
+    }
+  }
+}
+
+// Abort all active jobs that can be aborted.
+//
+// Returns the number of jobs that were aborted.
+func (j *JobManager) AbortAll() int {
+  var aborted int
+  for _, job := range j.List() {
+    if !job.CanAbort() {
+      continue
+    }
+    if err := j.Abort(job); err != nil {
+      Log.Warn("job abort failed", Fields{"job": job.Number, "id": job.Id, "error": err})
+      continue
+    }
+    aborted++
+  }
+  return aborted
+}
+
 // Create singleton job manager.
 func init() {
   Jobs = &JobManager{}
@@ -0,0 +1,249 @@
+package util
+
+import(
+  "io"
+  "os"
+  "fmt"
+  "sort"
+  "sync"
+  "time"
+  "bytes"
+  "strings"
+  "context"
+  "crypto/rand"
+  "encoding/hex"
+  "encoding/json"
+)
+
+// Log levels in order of severity.
+const(
+  LevelDebug LogLevel = iota
+  LevelInfo
+  LevelWarn
+  LevelError
+)
+
+const(
+  // Header used to supply and return a request identifier.
+  RequestIdHeader = "X-Request-Id"
+
+  // Maximum length of a request identifier supplied by a client.
+  maxRequestId = 128
+)
+
+var(
+  // Server log.
+  Log *Logger
+
+  levelNames = []string{"debug", "info", "warn", "error"}
+)
+
+type requestIdKey struct {}
+
+// Severity of a log record.
+type LogLevel int
+
+func (l LogLevel) String() string {
+  if l < LevelDebug || l > LevelError {
+    return fmt.Sprintf("level(%d)", int(l))
+  }
+  return levelNames[l]
+}
+
+// Parse a level name, one of debug, info, warn or error.
+func ParseLevel(name string) (LogLevel, error) {
+  for i, n := range levelNames {
+    if strings.EqualFold(name, n) {
+      return LogLevel(i), nil
+    }
+  }
+  return LevelInfo, fmt.Errorf("Unknown log level %s", name)
+}
+
+// Fields added to a log record.
+type Fields map[string]interface{}
+
+// Logger writes records as JSON lines.
+//
+// Each record has the time, level and msg fields followed by the
+// record fields sorted by name. Loggers created with With() share
+// the output and level of the logger they were created from.
+type Logger struct {
+  // Destination for records.
+  Out io.Writer
+  // Records below this level are discarded.
+  Level LogLevel
+
+  parent *Logger
+  fields Fields
+  mu sync.Mutex
+}
+
+// Create a logger.
+func NewLogger(out io.Writer, level LogLevel) *Logger {
+  return &Logger{Out: out, Level: level}
+}
+
+// Get a logger that adds fields to every record.
+func (l *Logger) With(fields Fields) *Logger {
+  merged := make(Fields)
+  for k, v := range l.fields {
+    merged[k] = v
+  }
+  for k, v := range fields {
+    merged[k] = v
+  }
+  return &Logger{parent: l.root(), fields: merged}
+}
+
+// Determine if records at a level are written.
+func (l *Logger) Enabled(level LogLevel) bool {
+  return level >= l.root().Level
+}
+
+func (l *Logger) Debug(msg string, fields ...Fields) {
+  l.Write(LevelDebug, msg, fields...)
+}
+
+func (l *Logger) Info(msg string, fields ...Fields) {
+  l.Write(LevelInfo, msg, fields...)
+}
+
+func (l *Logger) Warn(msg string, fields ...Fields) {
+  l.Write(LevelWarn, msg, fields...)
+}
+
+func (l *Logger) Error(msg string, fields ...Fields) {
+  l.Write(LevelError, msg, fields...)
+}
+
+// Write a record.
+//
+// Error values are written as their message, a field that cannot be
+// encoded is written using it's default string format.
+func (l *Logger) Write(level LogLevel, msg string, fields ...Fields) {
+  root := l.root()
+  if level < root.Level {
+    return
+  }
+
+  all := make(Fields)
+  for k, v := range l.fields {
+    all[k] = v
+  }
+  for _, f := range fields {
+    for k, v := range f {
+      all[k] = v
+    }
+  }
+
+  var keys []string
+  for k := range all {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+
+  var b bytes.Buffer
+  b.WriteString(`{"time":`)
+  writeValue(&b, time.Now().UTC().Format(time.RFC3339Nano))
+  b.WriteString(`,"level":`)
+  writeValue(&b, level.String())
+  b.WriteString(`,"msg":`)
+  writeValue(&b, msg)
+  for _, k := range keys {
+    b.WriteString(",")
+    writeValue(&b, k)
+    b.WriteString(":")
+    writeValue(&b, all[k])
+  }
+  b.WriteString("}\n")
+
+  root.mu.Lock()
+  defer root.mu.Unlock()
+  root.Out.Write(b.Bytes())
+}
+
+// Get a writer that logs each line written to it as a record,
+// used to capture output from packages that use the log package.
+func (l *Logger) Writer(level LogLevel) io.Writer {
+  return &logWriter{logger: l, level: level}
+}
+
+// Generate a random request identifier.
+func NewRequestId() string {
+  b := make([]byte, 8)
+  if _, err := rand.Read(b); err != nil {
+    return fmt.Sprintf("%x", time.Now().UnixNano())
+  }
+  return hex.EncodeToString(b)
+}
+
+// Determine if a request identifier supplied by a client can be used,
+// it must not be too long and only contain letters, digits, hyphens,
+// underscores, periods and colons.
+func ValidRequestId(id string) bool {
+  if id == "" || len(id) > maxRequestId {
+    return false
+  }
+  for _, c := range id {
+    switch {
+      case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+      case c == '-' || c == '_' || c == '.' || c == ':':
+      default:
+        return false
+    }
+  }
+  return true
+}
+
+// Get a context that carries a request identifier.
+func WithRequestId(ctx context.Context, id string) context.Context {
+  return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+// Get the request identifier from a context.
+func ContextRequestId(ctx context.Context) string {
+  id, _ := ctx.Value(requestIdKey{}).(string)
+  return id
+}
+
+// Private
+
+func (l *Logger) root() *Logger {
+  if l.parent != nil {
+    return l.parent
+  }
+  return l
+}
+
+func writeValue(b *bytes.Buffer, v interface{}) {
+  if err, ok := v.(error); ok {
+    v = err.Error()
+  }
+  if s, ok := v.(fmt.Stringer); ok {
+    v = s.String()
+  }
+  content, err := json.Marshal(v)
+  if err != nil {
+    content, _ = json.Marshal(fmt.Sprintf("%v", v))
+  }
+  b.Write(content)
+}
+
+type logWriter struct {
+  logger *Logger
+  level LogLevel
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+  for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+    if line != "" {
+      w.logger.Write(w.level, line)
+    }
+  }
+  return len(p), nil
+}
+
+func init() {
+  Log = NewLogger(os.Stderr, LevelInfo)
+}
@@ -0,0 +1,58 @@
+package util
+
+import (
+  "bytes"
+  "errors"
+  "strings"
+  "testing"
+  "encoding/json"
+)
+
+func TestLoggerWrite(t *testing.T) {
+  var b bytes.Buffer
+  l := NewLogger(&b, LevelInfo)
+  l.Debug("hidden")
+  l.With(Fields{"request-id": "abc"}).Warn("job failed", Fields{"job": 1, "error": errors.New("exit status 1")})
+
+  lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+  if len(lines) != 1 {
+    t.Fatalf("Expected 1 record, got %d: %s", len(lines), b.String())
+  }
+  if !strings.HasPrefix(lines[0], `{"time":`) {
+    t.Errorf("Expected time first, got %s", lines[0])
+  }
+
+  var record map[string]interface{}
+  if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+    t.Fatal(err)
+  }
+  expected := map[string]interface{}{
+    "level": "warn", "msg": "job failed", "request-id": "abc", "job": float64(1), "error": "exit status 1"}
+  for k, v := range expected {
+    if record[k] != v {
+      t.Errorf("Expected %s to be %v, got %v", k, v, record[k])
+    }
+  }
+
+  // Child loggers use the level of the logger they were created from
+  l.Level = LevelError
+  b.Reset()
+  l.With(nil).Warn("hidden")
+  if b.Len() != 0 {
+    t.Errorf("Expected record below level to be discarded, got %s", b.String())
+  }
+}
+
+func TestRequestId(t *testing.T) {
+  if id := NewRequestId(); !ValidRequestId(id) {
+    t.Errorf("Expected generated request id %s to be valid", id)
+  }
+  for _, id := range []string{"", "a b", "a\nb", strings.Repeat("a", 129)} {
+    if ValidRequestId(id) {
+      t.Errorf("Expected request id %q to be invalid", id)
+    }
+  }
+  if !ValidRequestId("client-1.2:3_4") {
+    t.Errorf("Expected client request id to be valid")
+  }
+}
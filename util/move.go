@@ -0,0 +1,67 @@
+package util
+
+import(
+  "io"
+  "os"
+  "syscall"
+  "path/filepath"
+)
+
+// Move a file or directory, when the destination is on another
+// file system the files are copied and the source is removed.
+func MoveFile(src string, dest string) error {
+  err := os.Rename(src, dest)
+  if le, ok := err.(*os.LinkError); !ok || le.Err != syscall.EXDEV {
+    return err
+  }
+  if err := copyAll(src, dest); err != nil {
+    os.RemoveAll(dest)
+    return err
+  }
+  return os.RemoveAll(src)
+}
+
+// Private
+
+// Copy a file or directory tree keeping the file modes,
+// symbolic links are copied as links.
+func copyAll(src string, dest string) error {
+  return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+    if err != nil {
+      return err
+    }
+    rel, err := filepath.Rel(src, path)
+    if err != nil {
+      return err
+    }
+    target := filepath.Join(dest, rel)
+    switch {
+      case info.IsDir():
+        return os.MkdirAll(target, info.Mode().Perm())
+      case info.Mode() & os.ModeSymlink != 0:
+        link, err := os.Readlink(path)
+        if err != nil {
+          return err
+        }
+        return os.Symlink(link, target)
+    }
+    return copyFile(path, target, info.Mode().Perm())
+  })
+}
+
+func copyFile(src string, dest string, mode os.FileMode) error {
+  in, err := os.Open(src)
+  if err != nil {
+    return err
+  }
+  defer in.Close()
+  out, err := os.OpenFile(dest, os.O_WRONLY | os.O_CREATE | os.O_EXCL, mode)
+  if err != nil {
+    return err
+  }
+  if _, err := io.Copy(out, in); err != nil {
+    out.Close()
+    return err
+  }
+  return out.Close()
+}
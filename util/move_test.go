@@ -0,0 +1,50 @@
+package util
+
+import (
+  "os"
+  "testing"
+  "io/ioutil"
+  "path/filepath"
+)
+
+func TestMoveFile(t *testing.T) {
+  dir, err := ioutil.TempDir("", "pageloop-move")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+
+  src := filepath.Join(dir, "src")
+  if err := os.MkdirAll(filepath.Join(src, "docs"), 0755); err != nil {
+    t.Fatal(err)
+  }
+  if err := ioutil.WriteFile(filepath.Join(src, "docs", "index.md"), []byte("# Docs"), 0600); err != nil {
+    t.Fatal(err)
+  }
+  if err := os.Symlink("docs/index.md", filepath.Join(src, "index.md")); err != nil {
+    t.Fatal(err)
+  }
+
+  // Copy used when the destination is on another file system
+  copied := filepath.Join(dir, "copied")
+  if err := copyAll(src, copied); err != nil {
+    t.Fatal(err)
+  }
+  if content, err := ioutil.ReadFile(filepath.Join(copied, "index.md")); err != nil || string(content) != "# Docs" {
+    t.Errorf("Expected copied file through link, got %q %v", content, err)
+  }
+  if info, err := os.Stat(filepath.Join(copied, "docs", "index.md")); err != nil || info.Mode().Perm() != 0600 {
+    t.Errorf("Expected file mode to be kept, got %v", err)
+  }
+
+  moved := filepath.Join(dir, "moved")
+  if err := MoveFile(src, moved); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := os.Stat(src); !os.IsNotExist(err) {
+    t.Errorf("Expected source to be removed")
+  }
+  if _, err := os.Stat(filepath.Join(moved, "docs", "index.md")); err != nil {
+    t.Errorf("Expected moved file, %s", err)
+  }
+}